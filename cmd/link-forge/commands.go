@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/5aradise/link-forge/config"
+	"github.com/5aradise/link-forge/internal/auth"
+	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/storage"
+	"github.com/5aradise/link-forge/internal/transfer"
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+// exportPageSize is the number of urls read at once by list and export.
+const exportPageSize = 500
+
+var ErrUsage = errors.New("usage: link-forge <command> [args]")
+
+// stdin and stdout are where the commands read and write their data.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// command is a subcommand of the binary. Data goes to stdout, logs go to
+// stderr so the output can be piped.
+type command struct {
+	args string
+	help string
+	// nargs are the accepted numbers of arguments.
+	nargs []int
+	run   func(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error
+}
+
+var commands = map[string]command{
+	"migrate": {
+		args:  "up|down|reset|status",
+		help:  "apply or revert the database migrations",
+		nargs: []int{1},
+		run: func(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+			return db.Migrate(ctx, l, args[0])
+		},
+	},
+	"create-key": {
+		args:  "<name> [admin]",
+		help:  "issue an api key, printed once",
+		nargs: []int{1, 2},
+		run:   createKey,
+	},
+	"create": {
+		args:  "<url> [alias]",
+		help:  "shorten a url, printing its alias",
+		nargs: []int{1, 2},
+		run:   createURL,
+	},
+	"delete": {
+		args:  "<alias>",
+		help:  "delete a link",
+		nargs: []int{1},
+		run:   deleteURL,
+	},
+	"list": {
+		help:  "print the links as a table",
+		nargs: []int{0},
+		run:   listURLs,
+	},
+	"export": {
+		args:  "[csv|jsonl]",
+		help:  "write the links to stdout, as JSON lines by default",
+		nargs: []int{0, 1},
+		run:   exportURLs,
+	},
+	"import": {
+		args:  "[csv|jsonl|bitly|yourls]",
+		help:  "create the links read from stdin, as JSON lines by default",
+		nargs: []int{0, 1},
+		run:   importURLs,
+	},
+}
+
+// printUsage runs the help command, it needs neither the config nor the
+// storage.
+func printUsage() error {
+	_, err := fmt.Fprintln(stdout, usage())
+	return err
+}
+
+func runCommand(l *slog.Logger, db storage.Storage, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q\n%s", ErrUsage, name, usage())
+	}
+	if !slices.Contains(cmd.nargs, len(args)) {
+		return fmt.Errorf("%w: link-forge %s %s", ErrUsage, name, cmd.args)
+	}
+	return cmd.run(context.Background(), l, db, args)
+}
+
+// usage lists the commands, serve is the default one.
+func usage() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "  serve\t\trun the server\n")
+	for _, name := range []string{"migrate", "create-key", "create", "delete", "list", "export", "import"} {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", name, cmd.args, cmd.help)
+	}
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func createKey(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+	if len(args) == 2 && args[1] != "admin" {
+		return fmt.Errorf("%w: link-forge create-key <name> [admin]", ErrUsage)
+	}
+
+	key, apiKey, err := auth.CreateKey(ctx, db, args[0], len(args) == 2)
+	if err != nil {
+		return err
+	}
+
+	l.Info("api key created", slog.Int64("id", apiKey.ID), slog.String("name", apiKey.Name), slog.Bool("admin", apiKey.Admin))
+	_, err = fmt.Fprintln(stdout, key)
+	return err
+}
+
+// createURL goes through the same validation and alias generation as the
+// api. Links created from the shell have no owner, so only admins manage
+// them over the api. A single alias is leased, the rest of a larger lease
+// would be lost when the command exits.
+func createURL(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+	s, err := newService(l, db, 1)
+	if err != nil {
+		return err
+	}
+
+	newURL := types.NewURL{Url: args[0]}
+	if len(args) == 2 {
+		newURL.Alias = args[1]
+	}
+	url, finalURL, err := s.Create(ctx, l, newURL)
+	if err != nil {
+		return err
+	}
+
+	l.Info("url added", slog.Int64("id", url.Id), slog.String("alias", url.Alias), slog.String("final_url", finalURL))
+	_, err = fmt.Fprintln(stdout, url.Alias)
+	return err
+}
+
+func deleteURL(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+	url, err := db.DeleteURLByAlias(ctx, args[0], "")
+	if err != nil {
+		return err
+	}
+
+	l.Info("url deleted", slog.Any("url", url))
+	return nil
+}
+
+func listURLs(ctx context.Context, _ *slog.Logger, db storage.Storage, _ []string) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tALIAS\tURL\tOWNER\tCREATED")
+	err := eachURL(ctx, db, func(url types.URL) error {
+		_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", url.Id, url.Alias, url.Url, url.Owner, url.CreatedAt.Format("2006-01-02 15:04:05"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func exportURLs(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+	w, err := transfer.NewWriter(stdout, formatArg(args))
+	if err != nil {
+		return err
+	}
+
+	var n int
+	err = eachURL(ctx, db, func(url types.URL) error {
+		n++
+		return w.Write(url)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.Info("urls exported", slog.Int("count", n))
+	return w.Flush()
+}
+
+// importURLs keeps the aliases, owners and limits of the imported links,
+// ids, versions and timestamps are new. Rows are validated like links
+// imported over the api, taken aliases and invalid rows are skipped.
+func importURLs(ctx context.Context, l *slog.Logger, db storage.Storage, args []string) error {
+	rows, err := transfer.NewReader(bufio.NewReader(stdin), formatArg(args))
+	if err != nil {
+		return err
+	}
+	s, err := newService(l, db, config.Cfg.Alias.LeaseSize)
+	if err != nil {
+		return err
+	}
+
+	report, err := s.Import(ctx, l, rows)
+	for _, row := range report.Rows {
+		l.Warn("row skipped",
+			slog.Int("line", row.Line),
+			slog.String("alias", row.Alias),
+			slog.String("status", row.Status),
+			slog.String("error", row.Error),
+		)
+	}
+	l.Info("urls imported",
+		slog.Int("created", report.Created),
+		slog.Int("conflicts", report.Conflicts),
+		slog.Int("invalid", report.Invalid),
+		slog.Int("failed", report.Failed),
+	)
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d urls failed to import", report.Failed)
+	}
+	return nil
+}
+
+// newService validates links created from the shell like the server does,
+// leasing aliases leaseSize at a time.
+func newService(l *slog.Logger, db storage.Storage, leaseSize uint32) (*urls.URLService, error) {
+	gen, err := newAliasGenerator(db, leaseSize)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := newURLPolicy()
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := newBlocklist(l)
+	if err != nil {
+		return nil, err
+	}
+
+	var block urls.Blocklist
+	if blocked != nil {
+		block = blocked
+	}
+	return urls.NewService(l, db, gen, nil, policy, block, newResolver()), nil
+}
+
+func formatArg(args []string) string {
+	if len(args) == 0 {
+		return transfer.FormatJSONL
+	}
+	return args[0]
+}
+
+// eachURL calls fn for every url in the order of ids.
+func eachURL(ctx context.Context, db storage.Storage, fn func(types.URL) error) error {
+	params := types.ListURLsParams{Limit: exportPageSize}
+	for {
+		page, err := db.ListURLs(ctx, params)
+		if err != nil {
+			return err
+		}
+		for _, url := range page {
+			err = fn(url)
+			if err != nil {
+				return err
+			}
+		}
+		if len(page) < params.Limit {
+			return nil
+		}
+		params.After = page[len(page)-1].Id
+	}
+}
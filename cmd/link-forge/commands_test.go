@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/config"
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/storage"
+	"github.com/5aradise/link-forge/internal/transfer"
+	"github.com/5aradise/link-forge/pkg/logger"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+// openMemory loads the default config and opens an empty memory storage.
+func openMemory(t *testing.T) storage.Storage {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "memory://")
+	require.NoError(t, config.Load())
+
+	db, err := storage.Open(config.Cfg.DB.URL, config.Cfg.DB.Driver)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// run runs the command with the given stdin and returns its stdout.
+func run(t *testing.T, db storage.Storage, name string, args []string, in string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	prevIn, prevOut := stdin, stdout
+	stdin, stdout = strings.NewReader(in), &out
+	defer func() {
+		stdin, stdout = prevIn, prevOut
+	}()
+
+	err := runCommand(logger.NewMock(), db, name, args)
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	db := openMemory(t)
+
+	// The steps run in order against the same storage.
+	steps := []struct {
+		name string
+		cmd  string
+		args []string
+		in   string
+		out  []string
+		err  error
+	}{
+		{name: "Unknown_command", cmd: "shorten", err: ErrUsage},
+		{name: "Missing_args", cmd: "create", err: ErrUsage},
+		{name: "Too_many_args", cmd: "delete", args: []string{"a", "b"}, err: ErrUsage},
+		{name: "Key_not_admin", cmd: "create-key", args: []string{"alice", "root"}, err: ErrUsage},
+		{name: "Create", cmd: "create", args: []string{"https://example.com", "example"}, out: []string{"example\n"}},
+		{name: "Create_taken", cmd: "create", args: []string{"https://other.com", "example"}, err: database.ErrAliasExists},
+		{name: "Create_invalid", cmd: "create", args: []string{"example.com"}, err: urls.ErrInvalidURL},
+		{name: "Create_short_alias", cmd: "create", args: []string{"https://example.com", "ab"}, err: urls.ErrAliasTooShort},
+		{
+			name: "Import",
+			cmd:  "import",
+			in:   `{"alias":"imported","url":"https://imported.com"}` + "\n" + `{"alias":"example","url":"https://taken.com"}` + "\n" + `{"alias":"yr","url":"https://yourls.com"}` + "\n",
+		},
+		{name: "Import_format", cmd: "import", args: []string{"xml"}, err: transfer.ErrUnknownFormat},
+		{name: "List", cmd: "list", out: []string{"ALIAS", "example", "https://example.com", "imported", "yr"}},
+		{name: "Export", cmd: "export", args: []string{"csv"}, out: []string{"alias", "example,https://example.com", "imported,https://imported.com"}},
+		{name: "Export_format", cmd: "export", args: []string{"xml"}, err: transfer.ErrUnknownFormat},
+		{name: "Delete", cmd: "delete", args: []string{"example"}},
+		{name: "Delete_unknown", cmd: "delete", args: []string{"example"}, err: database.ErrURLUnfound},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			out, err := run(t, db, step.cmd, step.args, step.in)
+			if step.err != nil {
+				require.ErrorIs(t, err, step.err)
+				assert.Empty(t, out)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range step.out {
+				assert.Contains(t, out, want)
+			}
+		})
+	}
+}
+
+func TestPrintUsage(t *testing.T) {
+	// help runs before the config is loaded, without DATABASE_URL.
+	var out bytes.Buffer
+	prevOut := stdout
+	stdout = &out
+	defer func() {
+		stdout = prevOut
+	}()
+
+	require.NoError(t, printUsage())
+	for _, want := range []string{"serve", "create-key", "import"} {
+		assert.Contains(t, out.String(), want)
+	}
+}
+
+func TestCreateLeasesOneAlias(t *testing.T) {
+	db := openMemory(t)
+	ctx := context.Background()
+
+	first, err := run(t, db, "create", []string{"https://example.com"}, "")
+	require.NoError(t, err)
+	second, err := run(t, db, "create", []string{"https://example.com"}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	// Two creates leased two aliases, not two leases of ALIAS_LEASE_SIZE.
+	next, err := db.LeaseAliases(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), next)
+}
+
+func TestCreateKey(t *testing.T) {
+	db := openMemory(t)
+
+	out, err := run(t, db, "create-key", []string{"alice", "admin"}, "")
+	require.NoError(t, err)
+	key := strings.TrimSpace(out)
+	require.NotEmpty(t, key)
+
+	apiKey, err := db.GetAPIKeyByHash(context.Background(), middleware.HashKey(key))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", apiKey.Name)
+	assert.True(t, apiKey.Admin)
+}
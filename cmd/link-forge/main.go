@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
@@ -11,40 +12,91 @@ import (
 	"syscall"
 
 	"github.com/5aradise/link-forge/config"
-	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/analytics"
+	"github.com/5aradise/link-forge/internal/auth"
+	"github.com/5aradise/link-forge/internal/blocklist"
+	"github.com/5aradise/link-forge/internal/cache"
+	"github.com/5aradise/link-forge/internal/expiry"
 	"github.com/5aradise/link-forge/internal/handlers"
 	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/idempotency"
+	"github.com/5aradise/link-forge/internal/resolve"
+	"github.com/5aradise/link-forge/internal/storage"
 	"github.com/5aradise/link-forge/internal/util"
 	"github.com/5aradise/link-forge/pkg/httpserver"
 	"github.com/5aradise/link-forge/pkg/logger"
 	"github.com/5aradise/link-forge/pkg/middleware"
+)
 
-	_ "github.com/tursodatabase/libsql-client-go/libsql"
-	// _ "github.com/mattn/go-sqlite3"
+const (
+	rateLimitMemory   = "memory"
+	rateLimitDatabase = "database"
 )
 
+var errUnknownRateLimitBackend = errors.New("unknown rate limit backend, expected memory or database")
+
 func main() {
+	// Print usage
+	if len(os.Args) > 1 && os.Args[1] == "help" {
+		err := printUsage()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Load config
 	err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create logger
-	l := logger.New(os.Stdout, config.Cfg.Env)
+	// Create logger, subcommands keep stdout for their output
+	serve := len(os.Args) < 2 || os.Args[1] == "serve"
+	logOut := os.Stdout
+	if !serve {
+		logOut = os.Stderr
+	}
+	l := logger.New(logOut, config.Cfg.Env)
 
 	// Connect to storage
-	conn, err := sql.Open("libsql", config.Cfg.DB.URL) // sqlite3
+	db, err := storage.Open(config.Cfg.DB.URL, config.Cfg.DB.Driver)
 	if err != nil {
-		l.Error("can't open sql", util.SlErr(err))
+		l.Error("can't open storage", util.SlErr(err))
 		os.Exit(1)
 	}
-	defer conn.Close()
 
-	db := database.Create(conn)
+	// Run subcommand
+	if !serve {
+		cmdErr := runCommand(l, db, os.Args[1], os.Args[2:])
+		err = db.Close()
+		if err != nil {
+			l.Error("can't close storage", util.SlErr(err))
+		}
+		if cmdErr != nil {
+			l.Error("command failed", slog.String("command", os.Args[1]), util.SlErr(cmdErr))
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Apply pending migrations
+	if config.Cfg.DB.AutoMigrate {
+		err = db.Migrate(context.Background(), l, storage.MigrateUp)
+		if err != nil {
+			l.Error("can't migrate storage", util.SlErr(err))
+			os.Exit(1)
+		}
+	}
 
 	// Set handlers
 	router := http.NewServeMux()
+	// Routes anyone may use, bad credentials are ignored there.
+	publicRoutes := []string{
+		"/healthz",
+		http.MethodGet + " /api/v1/urls/{alias}",
+		http.MethodGet + " /api/v1/urls/{alias}/info",
+	}
 	router.HandleFunc("/healthz", handlers.Readiness(l))
 
 	// api
@@ -53,33 +105,95 @@ func main() {
 	// v1
 	v1 := http.NewServeMux()
 
-	aliasCount, err := db.LoadState(context.Background())
+	aliasGen, err := newAliasGenerator(db, config.Cfg.Alias.LeaseSize)
 	if err != nil {
-		l.Error("can't load state", util.SlErr(err))
+		l.Error("can't create alias generator", util.SlErr(err))
 		os.Exit(1)
 	}
 
-	URLService, err := urls.NewService(l, db, aliasCount)
+	// Cache redirects
+	var urlStorage urls.URLStorage = db
+	if config.Cfg.Cache.Size > 0 {
+		urlCache := cache.NewURLs(db, config.Cfg.Cache.Size, config.Cfg.Cache.TTL, config.Cfg.Cache.NegativeTTL)
+		router.HandleFunc(http.MethodGet+" /debug/cache", handlers.CacheStats(l, urlCache.Stats))
+		urlStorage = urlCache
+	}
+
+	// Record clicks
+	recorder, err := analytics.NewRecorder(l, db, []byte(config.Cfg.Clicks.VisitorSecret), config.Cfg.Clicks.QueueSize, config.Cfg.Clicks.BatchSize, config.Cfg.Clicks.FlushInterval)
 	if err != nil {
-		l.Error("can't create url service", util.SlErr(err))
+		l.Error("can't create click recorder", util.SlErr(err))
 		os.Exit(1)
 	}
-	v1.HandleFunc(http.MethodPost+" /urls", URLService.CreateURL)
+	recorder.Start()
+
+	policy, err := newURLPolicy()
+	if err != nil {
+		l.Error("can't create url policy", util.SlErr(err))
+		os.Exit(1)
+	}
+
+	// Load blocklists
+	blocked, err := newBlocklist(l)
+	if err != nil {
+		l.Error("can't load blocklist", util.SlErr(err))
+		os.Exit(1)
+	}
+	var block urls.Blocklist
+	if blocked != nil {
+		block = blocked
+		if config.Cfg.Blocklist.ReloadInterval > 0 {
+			blocked.Start()
+		}
+	}
+
+	URLService := urls.NewService(l, urlStorage, aliasGen, recorder, policy, block, newResolver())
+	// Replay retried creates
+	createURL := URLService.CreateURL
+	if config.Cfg.Idempotency.TTL > 0 {
+		createURL = idempotency.New(l, db, config.Cfg.Idempotency.TTL, config.Cfg.Idempotency.Lease).Wrap(createURL)
+	}
+
+	v1.HandleFunc(http.MethodPost+" /urls", createURL)
+	v1.HandleFunc(http.MethodPost+" /urls:batch", URLService.BatchCreateURLs)
 	v1.HandleFunc(http.MethodGet+" /urls", URLService.ListURLs)
+	v1.HandleFunc(http.MethodPost+" /urls/import", URLService.ImportURLs)
+	v1.HandleFunc(http.MethodGet+" /urls/export", URLService.ExportURLs)
 	v1.HandleFunc(http.MethodGet+" /urls/{alias}", URLService.RedirectURL)
+	v1.HandleFunc(http.MethodGet+" /urls/{alias}/info", URLService.URLInfo)
+	v1.HandleFunc(http.MethodGet+" /urls/{alias}/stats", URLService.URLStats)
 	v1.HandleFunc(http.MethodDelete+" /urls/{alias}", URLService.DeleteURL)
+	v1.HandleFunc(http.MethodPatch+" /urls/{alias}", URLService.UpdateURL)
 
 	api.Handle("/v1/", http.StripPrefix("/v1", v1))
 
 	router.Handle("/api/", http.StripPrefix("/api", api))
 
+	// Limit request rates
+	limitBeforeAuth, limitAfterAuth, err := newRateLimiters(l, db)
+	if err != nil {
+		l.Error("can't create rate limiter", util.SlErr(err))
+		os.Exit(1)
+	}
+
+	// Trust the forwarding headers of the proxies in front
+	proxies, err := middleware.ParseProxies(config.Cfg.Server.TrustedProxies)
+	if err != nil {
+		l.Error("can't parse trusted proxies", util.SlErr(err))
+		os.Exit(1)
+	}
+
 	// Run server
 	server := httpserver.New(
 		middleware.Use(router,
 			middleware.Recoverer(l),
+			middleware.RealIP(l, proxies),
 			middleware.Cors(l),
 			middleware.RequestID(l),
 			middleware.Logger(l),
+			limitBeforeAuth,
+			middleware.Auth(l, auth.Lookup(db), publicRoutes...),
+			limitAfterAuth,
 		),
 		httpserver.Port(config.Cfg.Server.Port),
 		httpserver.ReadTimeout(config.Cfg.Server.Timeout),
@@ -87,6 +201,13 @@ func main() {
 		httpserver.ErrorLog(slog.NewLogLogger(l.With(slog.String("source", "httpserver")).Handler(), slog.LevelError)),
 	)
 
+	// Sweep expired links
+	var sweeper *expiry.Sweeper
+	if config.Cfg.Expiry.SweepInterval > 0 {
+		sweeper = expiry.NewSweeper(l, db, config.Cfg.Expiry.SweepInterval, config.Cfg.Expiry.Retention, config.Cfg.Expiry.Archive)
+		sweeper.Start()
+	}
+
 	l.Info("starting server", slog.String("address", server.Addr()))
 	go server.Run()
 
@@ -107,9 +228,122 @@ func main() {
 		l.Error("can't shutdown server", util.SlErr(err))
 	}
 
-	aliasCount = URLService.AliasCount()
-	err = db.StoreState(context.Background(), aliasCount)
+	// Write queued clicks
+	ctx, cancel := context.WithTimeout(context.Background(), config.Cfg.Server.Timeout)
+	err = recorder.Close(ctx)
+	cancel()
+	if err != nil {
+		l.Error("can't write queued clicks", util.SlErr(err), slog.Uint64("dropped", recorder.Dropped()))
+	}
+
+	// Stop sweeper
+	if sweeper != nil {
+		sweeper.Stop()
+	}
+
+	// Stop blocklist reloads
+	if blocked != nil && config.Cfg.Blocklist.ReloadInterval > 0 {
+		blocked.Stop()
+	}
+
+	// Close storage
+	err = db.Close()
+	if err != nil {
+		l.Error("can't close storage", util.SlErr(err))
+	}
+}
+
+func newAliasGenerator(db storage.Storage, leaseSize uint32) (urls.AliasGenerator, error) {
+	alphabet, err := urls.NewAlphabet(config.Cfg.Alias.Alphabet, config.Cfg.Alias.NoLookalikes)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls.NewAliasGenerator(
+		config.Cfg.Alias.Strategy,
+		alphabet,
+		db,
+		leaseSize,
+		config.Cfg.Alias.Salt,
+	)
+}
+
+func newURLPolicy() (*util.URLPolicy, error) {
+	return util.NewURLPolicy(
+		config.Cfg.URL.Schemes,
+		config.Cfg.URL.MaxLength,
+		config.Cfg.URL.AllowPrivate,
+		config.Cfg.URL.AllowDomains,
+		config.Cfg.URL.DenyDomains,
+		config.Cfg.Server.PublicHosts,
+	)
+}
+
+// newResolver follows the redirects of new links, it returns nil when
+// RESOLVER_MAX_HOPS is 0.
+func newResolver() urls.Resolver {
+	if config.Cfg.Resolver.MaxHops <= 0 {
+		return nil
+	}
+	return resolve.New(config.Cfg.Resolver.MaxHops, config.Cfg.Resolver.Timeout, config.Cfg.Server.PublicHosts, config.Cfg.URL.AllowPrivate)
+}
+
+// newBlocklist loads the configured blocklists, it returns nil without
+// any.
+func newBlocklist(l *slog.Logger) (*blocklist.Blocklist, error) {
+	if len(config.Cfg.Blocklist.Files) == 0 {
+		return nil, nil
+	}
+
+	sources := make([]blocklist.Source, len(config.Cfg.Blocklist.Files))
+	for i, file := range config.Cfg.Blocklist.Files {
+		src, err := blocklist.ParseSource(file)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = src
+	}
+
+	b := blocklist.New(l, sources, config.Cfg.Blocklist.ReloadInterval, config.Cfg.Blocklist.CheckRedirects)
+	err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// newRateLimiters limits requests by the configured limits, with the
+// buckets in process memory or shared by the replicas in the database. The
+// first limiter goes before Auth, the second one, with the limits by api
+// key, after it.
+func newRateLimiters(l *slog.Logger, db storage.Storage) (middleware.Middleware, middleware.Middleware, error) {
+	limits := make([]middleware.RateLimit, len(config.Cfg.RateLimit.Limits))
+	for i, s := range config.Cfg.RateLimit.Limits {
+		limit, err := middleware.ParseRateLimit(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		limits[i] = limit
+	}
+
+	var store middleware.RateLimitStore
+	switch config.Cfg.RateLimit.Backend {
+	case rateLimitMemory:
+		store = middleware.NewMemoryRateLimitStore()
+	case rateLimitDatabase:
+		store = db
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", errUnknownRateLimitBackend, config.Cfg.RateLimit.Backend)
+	}
+
+	beforeAuth, afterAuth := middleware.SplitRateLimits(limits)
+	before, err := middleware.RateLimiter(l, store, beforeAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := middleware.RateLimiter(l, store, afterAuth)
 	if err != nil {
-		l.Error("can't store state", util.SlErr(err), slog.Uint64("alias count", uint64(aliasCount)))
+		return nil, nil, err
 	}
+	return before, after, nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+func TestDefaultRateLimits(t *testing.T) {
+	db := openMemory(t)
+	before, after, err := newRateLimiters(logger.NewMock(), db)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		limiter middleware.Middleware
+		limited bool
+	}{
+		{name: "Redirect", method: http.MethodGet, path: "/api/v1/urls/abc", limiter: before},
+		{name: "Info", method: http.MethodGet, path: "/api/v1/urls/abc/info", limiter: before},
+		{name: "Create", method: http.MethodPost, path: "/api/v1/urls", limiter: before, limited: true},
+		{name: "Update", method: http.MethodPatch, path: "/api/v1/urls/abc", limiter: before, limited: true},
+		{name: "Delete", method: http.MethodDelete, path: "/api/v1/urls/abc", limiter: before, limited: true},
+		{name: "List", method: http.MethodGet, path: "/api/v1/urls", limiter: before, limited: true},
+		{name: "Export", method: http.MethodGet, path: "/api/v1/urls/export", limiter: before, limited: true},
+		{name: "Stats", method: http.MethodGet, path: "/api/v1/urls/abc/stats", limiter: before, limited: true},
+		{name: "Create_by_key", method: http.MethodPost, path: "/api/v1/urls", limiter: after, limited: true},
+		{name: "Batch_by_key", method: http.MethodPost, path: "/api/v1/urls:batch", limiter: after, limited: true},
+		{name: "Import_by_key", method: http.MethodPost, path: "/api/v1/urls/import", limiter: after, limited: true},
+		{name: "Redirect_by_key", method: http.MethodGet, path: "/api/v1/urls/abc", limiter: after},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := tc.limiter(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.limited, w.Header().Get("RateLimit-Limit") != "")
+		})
+	}
+}
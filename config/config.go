@@ -14,16 +14,87 @@ type (
 		Env    string `envconfig:"ENV" default:"local"`
 		DB     DB
 		Server Server
+		Alias  Alias
+		URL    URL
+		Cache  Cache
+		Expiry Expiry
+		Clicks Clicks
+
+		Idempotency Idempotency
+		Blocklist   Blocklist
+		Resolver    Resolver
+		RateLimit   RateLimit
 	}
 
 	DB struct {
-		URL string `envconfig:"DATABASE_URL" required:"true"`
+		URL         string `envconfig:"DATABASE_URL" required:"true"`
+		Driver      string `envconfig:"DATABASE_DRIVER"`
+		AutoMigrate bool   `envconfig:"DATABASE_AUTO_MIGRATE" default:"false"`
 	}
 
 	Server struct {
-		Port        string        `envconfig:"SERVER_PORT" default:"8080"`
-		Timeout     time.Duration `envconfig:"SERVER_TIMEOUT" default:"4s"`
-		IdleTimeout time.Duration `envconfig:"SERVER_IDLE_TIMEOUT" default:"60s"`
+		Port           string        `envconfig:"SERVER_PORT" default:"8080"`
+		Timeout        time.Duration `envconfig:"SERVER_TIMEOUT" default:"4s"`
+		IdleTimeout    time.Duration `envconfig:"SERVER_IDLE_TIMEOUT" default:"60s"`
+		PublicHosts    []string      `envconfig:"SERVER_PUBLIC_HOSTS"`
+		TrustedProxies []string      `envconfig:"SERVER_TRUSTED_PROXIES"`
+	}
+
+	Alias struct {
+		Strategy  string `envconfig:"ALIAS_STRATEGY" default:"sequential"`
+		LeaseSize uint32 `envconfig:"ALIAS_LEASE_SIZE" default:"100"`
+		Salt      string `envconfig:"ALIAS_SALT"`
+
+		Alphabet     string `envconfig:"ALIAS_ALPHABET" default:"abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"`
+		NoLookalikes bool   `envconfig:"ALIAS_NO_LOOKALIKES" default:"false"`
+	}
+
+	URL struct {
+		Schemes      []string `envconfig:"URL_SCHEMES" default:"http,https"`
+		MaxLength    int      `envconfig:"URL_MAX_LENGTH" default:"2048"`
+		AllowPrivate bool     `envconfig:"URL_ALLOW_PRIVATE" default:"false"`
+		AllowDomains []string `envconfig:"URL_ALLOW_DOMAINS"`
+		DenyDomains  []string `envconfig:"URL_DENY_DOMAINS"`
+	}
+
+	Blocklist struct {
+		Files          []string      `envconfig:"BLOCKLIST_FILES"`
+		ReloadInterval time.Duration `envconfig:"BLOCKLIST_RELOAD_INTERVAL" default:"1h"`
+		CheckRedirects bool          `envconfig:"BLOCKLIST_CHECK_REDIRECTS" default:"true"`
+	}
+
+	Resolver struct {
+		MaxHops int           `envconfig:"RESOLVER_MAX_HOPS" default:"0"`
+		Timeout time.Duration `envconfig:"RESOLVER_TIMEOUT" default:"5s"`
+	}
+
+	RateLimit struct {
+		Limits  []string `envconfig:"RATE_LIMITS" default:"POST /api/=120/1m,PATCH /api/=120/1m,DELETE /api/=120/1m,GET /api/v1/urls=120/1m,GET /api/v1/urls/export=120/1m,GET /api/v1/urls/{alias}/stats=120/1m,POST /api/v1/urls=60/1m:key,POST /api/v1/urls:batch=10/1m:key,POST /api/v1/urls/import=5/1m:key"`
+		Backend string   `envconfig:"RATE_LIMIT_BACKEND" default:"memory"`
+	}
+
+	Expiry struct {
+		SweepInterval time.Duration `envconfig:"EXPIRY_SWEEP_INTERVAL" default:"1h"`
+		Retention     time.Duration `envconfig:"EXPIRY_RETENTION" default:"168h"`
+		Archive       bool          `envconfig:"EXPIRY_ARCHIVE" default:"false"`
+	}
+
+	Clicks struct {
+		QueueSize     int           `envconfig:"CLICKS_QUEUE_SIZE" default:"10000"`
+		BatchSize     int           `envconfig:"CLICKS_BATCH_SIZE" default:"500"`
+		FlushInterval time.Duration `envconfig:"CLICKS_FLUSH_INTERVAL" default:"1s"`
+		VisitorSecret string        `envconfig:"CLICKS_VISITOR_SECRET"`
+	}
+
+	Idempotency struct {
+		TTL   time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`
+		Lease time.Duration `envconfig:"IDEMPOTENCY_LEASE" default:"1m"`
+	}
+
+	Cache struct {
+		Size        int           `envconfig:"CACHE_SIZE" default:"10000"`
+		TTL         time.Duration `envconfig:"CACHE_TTL" default:"5m"`
+		NegativeTTL time.Duration `envconfig:"CACHE_NEGATIVE_TTL" default:"30s"`
 	}
 )
 
@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+const (
+	DeviceBot     = "bot"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// countryHeaders are set by CDNs to the country of the client.
+var countryHeaders = []string{
+	"CF-IPCountry",
+	"CloudFront-Viewer-Country",
+	"X-Vercel-IP-Country",
+	"X-Country-Code",
+}
+
+// Country returns the ISO 3166 country code of the client if a CDN in
+// front of the service told it, or an empty string.
+func Country(h http.Header) string {
+	for _, name := range countryHeaders {
+		code := strings.ToUpper(strings.TrimSpace(h.Get(name)))
+		// Cloudflare sends XX for unknown countries and T1 for Tor.
+		if len(code) == 2 && isLetters(code) && code != "XX" {
+			return code
+		}
+	}
+	return ""
+}
+
+// Client addresses are kept truncated to these networks, the full address
+// is only used for the visitor.
+const (
+	keptBitsIPv4 = 24
+	keptBitsIPv6 = 48
+)
+
+// enrich fills the fields of a click derived from the request data and
+// truncates its client address.
+func enrich(c types.Click, secret []byte) types.Click {
+	c.Visitor = visitor(c, secret)
+	c.ReferrerHost = referrerHost(c.Referrer)
+	c.Device = Device(c.UserAgent)
+	c.RemoteAddr = truncateAddr(c.RemoteAddr)
+	return c
+}
+
+// truncateAddr zeroes the host part of an ip address, e.g. 192.0.2.1
+// becomes 192.0.2.0. Anything else is dropped.
+func truncateAddr(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return ""
+	}
+	ip = ip.Unmap().WithZone("")
+	bits := keptBitsIPv6
+	if ip.Is4() {
+		bits = keptBitsIPv4
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+// visitor hashes the client address and user agent with a salt derived
+// from the secret and the day of the click, so a visitor is counted once
+// per day. Without the secret the hash can't be recomputed from a guessed
+// address, nor linked to the hashes of other days.
+func visitor(c types.Click, secret []byte) string {
+	if c.RemoteAddr == "" && c.UserAgent == "" {
+		return ""
+	}
+	salt := hmac.New(sha256.New, secret)
+	salt.Write([]byte(c.At.UTC().Format("2006-01-02")))
+
+	h := hmac.New(sha256.New, salt.Sum(nil))
+	h.Write([]byte(c.RemoteAddr))
+	h.Write([]byte{0})
+	h.Write([]byte(c.UserAgent))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Device classifies a user agent as a bot, mobile, tablet or desktop,
+// an empty user agent is unknown.
+func Device(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ""
+	case containsAny(ua, "bot", "crawl", "spider", "slurp", "curl/", "wget/", "python", "go-http-client", "headless"):
+		return DeviceBot
+	case containsAny(ua, "ipad", "tablet", "kindle", "silk/") ||
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case containsAny(ua, "mobi", "iphone", "ipod", "android", "windows phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
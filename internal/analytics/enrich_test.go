@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+func TestDevice(t *testing.T) {
+	cases := []struct {
+		name string
+		ua   string
+		want string
+	}{
+		{"Empty", "", ""},
+		{"Desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", DeviceDesktop},
+		{"iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", DeviceMobile},
+		{"Android_phone", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", DeviceMobile},
+		{"Android_tablet", "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", DeviceTablet},
+		{"iPad", "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", DeviceTablet},
+		{"Crawler", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"Curl", "curl/8.4.0", DeviceBot},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Device(tc.ua))
+		})
+	}
+}
+
+func TestCountry(t *testing.T) {
+	cases := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"None", http.Header{}, ""},
+		{"Cloudflare", http.Header{"Cf-Ipcountry": {"ua"}}, "UA"},
+		{"Unknown", http.Header{"Cf-Ipcountry": {"XX"}}, ""},
+		{"Tor", http.Header{"Cf-Ipcountry": {"T1"}}, ""},
+		{"CloudFront", http.Header{"Cloudfront-Viewer-Country": {"PL"}}, "PL"},
+		{"Garbage", http.Header{"X-Country-Code": {"<script>"}}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Country(tc.header))
+		})
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := []byte("secret")
+	morning := time.Date(2024, time.January, 1, 8, 0, 0, 0, time.UTC)
+	raw := types.Click{
+		At:         morning,
+		Referrer:   "https://www.News.com/article?id=1",
+		UserAgent:  "curl/8.4.0",
+		RemoteAddr: "192.0.2.1",
+	}
+	c := enrich(raw, secret)
+	assert.Equal("news.com", c.ReferrerHost)
+	assert.Equal(DeviceBot, c.Device)
+	assert.Len(c.Visitor, 32)
+	assert.Equal("192.0.2.0", c.RemoteAddr, "the client address is kept truncated")
+
+	evening := raw
+	evening.At = morning.Add(12 * time.Hour)
+	assert.Equal(c.Visitor, enrich(evening, secret).Visitor, "same visitor within a day")
+
+	nextDay := raw
+	nextDay.At = morning.Add(24 * time.Hour)
+	assert.NotEqual(c.Visitor, enrich(nextDay, secret).Visitor, "new visitor every day")
+
+	other := raw
+	other.RemoteAddr = "192.0.2.2"
+	assert.NotEqual(c.Visitor, enrich(other, secret).Visitor)
+
+	assert.NotEqual(c.Visitor, enrich(raw, []byte("other")).Visitor, "salted with the secret")
+
+	assert.Empty(enrich(types.Click{At: morning}, secret).Visitor)
+}
+
+func TestTruncateAddr(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.123":           "192.0.2.0",
+		"::ffff:192.0.2.123":    "192.0.2.0",
+		"2001:db8:1234:5678::1": "2001:db8:1234::",
+		"fe80::1%eth0":          "fe80::",
+		"":                      "",
+		"not an address":        "",
+	}
+	for addr, want := range cases {
+		assert.Equal(t, want, truncateAddr(addr), addr)
+	}
+}
@@ -0,0 +1,162 @@
+// Package analytics records the clicks of redirects.
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// writeTimeout bounds the write of a single batch.
+const writeTimeout = 5 * time.Second
+
+var (
+	ErrDrainTimeout    = errors.New("clicks left in the queue")
+	ErrInvalidSettings = errors.New("click queue size, batch size and flush interval must be positive")
+)
+
+// Storage writes a batch of clicks at once.
+type Storage interface {
+	InsertClicks(ctx context.Context, clicks []types.Click) error
+}
+
+// Recorder queues clicks and writes them to the storage in batches, so
+// redirects never wait for the storage. When the queue is full new clicks
+// are dropped and counted.
+type Recorder struct {
+	l             *slog.Logger
+	storage       Storage
+	secret        []byte
+	batchSize     int
+	flushInterval time.Duration
+
+	// mu guards closed, so Record never sends to the closed queue.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan types.Click
+	done   chan struct{}
+
+	dropped atomic.Uint64
+}
+
+// NewRecorder creates a recorder hashing visitors with secret. Without one
+// a random secret is used, visitors are then counted apart by every
+// process. The sizes and the interval must be positive.
+func NewRecorder(l *slog.Logger, storage Storage, secret []byte, queueSize, batchSize int, flushInterval time.Duration) (*Recorder, error) {
+	const op = "analytics.NewRecorder"
+
+	if queueSize <= 0 || batchSize <= 0 || flushInterval <= 0 {
+		return nil, util.OpWrap(op, ErrInvalidSettings)
+	}
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Recorder{
+		l:             l.With(slog.String("op", "analytics.recorder")),
+		storage:       storage,
+		secret:        secret,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		queue:         make(chan types.Click, queueSize),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// Record queues the click without blocking.
+func (r *Recorder) Record(c types.Click) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return
+	}
+	select {
+	case r.queue <- c:
+	default:
+		if r.dropped.Add(1)%1000 == 1 {
+			r.l.Warn("click queue is full, clicks are dropped", slog.Uint64("dropped", r.dropped.Load()))
+		}
+	}
+}
+
+// Dropped returns the number of clicks lost to a full queue.
+func (r *Recorder) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Start writes queued clicks in the background, a batch is written when
+// it is full or when the flush interval passes.
+func (r *Recorder) Start() {
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]types.Click, 0, r.batchSize)
+		for {
+			select {
+			case c, ok := <-r.queue:
+				if !ok {
+					r.flush(batch)
+					return
+				}
+				batch = append(batch, c)
+				if len(batch) == r.batchSize {
+					r.flush(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
+
+// Close stops accepting clicks and waits until the queued ones are
+// written, or until ctx is done.
+func (r *Recorder) Close(ctx context.Context) error {
+	const op = "analytics.Close"
+
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return util.OpWrap(op, ErrDrainTimeout)
+	}
+}
+
+func (r *Recorder) flush(batch []types.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	for i := range batch {
+		batch[i] = enrich(batch[i], r.secret)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	err := r.storage.InsertClicks(ctx, batch)
+	if err != nil {
+		r.l.Error("failed to write clicks", slog.Int("count", len(batch)), util.SlErr(err))
+	}
+}
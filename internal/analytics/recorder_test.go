@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+// batchStorage keeps the written batches. Writes wait for release when
+// it is set.
+type batchStorage struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	batches [][]types.Click
+}
+
+func (s *batchStorage) InsertClicks(_ context.Context, clicks []types.Click) error {
+	if s.release != nil {
+		<-s.release
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]types.Click(nil), clicks...))
+	return nil
+}
+
+func (s *batchStorage) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := make([]int, 0, len(s.batches))
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func click(i int) types.Click {
+	return types.Click{URLID: int64(i), Alias: strconv.Itoa(i)}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("Batches", func(t *testing.T) {
+		storage := &batchStorage{}
+		r, err := NewRecorder(logger.NewMock(), storage, nil, 100, 3, time.Hour)
+		require.NoError(t, err)
+		r.Start()
+
+		for i := range 7 {
+			r.Record(click(i))
+		}
+		require.Eventually(t, func() bool {
+			return len(storage.sizes()) == 2
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, r.Close(context.Background()))
+		assert.Equal(t, []int{3, 3, 1}, storage.sizes(), "close writes the rest")
+		assert.Zero(t, r.Dropped())
+	})
+
+	t.Run("Flush_interval", func(t *testing.T) {
+		storage := &batchStorage{}
+		r, err := NewRecorder(logger.NewMock(), storage, nil, 100, 100, time.Millisecond)
+		require.NoError(t, err)
+		r.Start()
+		defer r.Close(context.Background())
+
+		r.Record(click(1))
+		require.Eventually(t, func() bool {
+			return len(storage.sizes()) == 1
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Drops_when_full", func(t *testing.T) {
+		storage := &batchStorage{release: make(chan struct{})}
+		r, err := NewRecorder(logger.NewMock(), storage, nil, 2, 1, time.Hour)
+		require.NoError(t, err)
+		r.Start()
+
+		// The first click is taken by the writer, which then waits.
+		r.Record(click(0))
+		require.Eventually(t, func() bool {
+			return len(r.queue) == 0
+		}, time.Second, time.Millisecond)
+
+		for i := range 5 {
+			r.Record(click(i + 1))
+		}
+		assert.Equal(t, uint64(3), r.Dropped())
+
+		close(storage.release)
+		require.NoError(t, r.Close(context.Background()))
+		assert.Equal(t, []int{1, 1, 1}, storage.sizes())
+
+		r.Record(click(6))
+		assert.Equal(t, uint64(4), r.Dropped(), "closed recorder drops clicks")
+	})
+
+	t.Run("Drain_timeout", func(t *testing.T) {
+		storage := &batchStorage{release: make(chan struct{})}
+		defer close(storage.release)
+		r, err := NewRecorder(logger.NewMock(), storage, nil, 10, 1, time.Hour)
+		require.NoError(t, err)
+		r.Start()
+		r.Record(click(0))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, r.Close(ctx), ErrDrainTimeout)
+	})
+
+	t.Run("Invalid_settings", func(t *testing.T) {
+		for _, settings := range [][3]int{{0, 1, 1}, {1, 0, 1}, {1, 1, 0}, {1, 1, -1}} {
+			_, err := NewRecorder(logger.NewMock(), &batchStorage{}, nil, settings[0], settings[1], time.Duration(settings[2]))
+			assert.ErrorIs(t, err, ErrInvalidSettings, settings)
+		}
+	})
+}
@@ -0,0 +1,350 @@
+// Package blocklist keeps lists of malicious domains and urls loaded from
+// local files, such as phishing and malware feeds, and reloads them in the
+// background.
+package blocklist
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/idna"
+
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+const (
+	// FormatHosts is a hosts file, "0.0.0.0 example.com" per line.
+	FormatHosts = "hosts"
+	// FormatDomains is a domain or a url without scheme per line.
+	FormatDomains = "domains"
+	// FormatHashPrefix is a hex SHA-256 prefix per line of a url
+	// expression ("example.com/path/"), the way Safe Browsing lists are
+	// distributed.
+	FormatHashPrefix = "hashprefix"
+
+	// minPrefixLen and maxPrefixLen bound the hex length of hash prefixes,
+	// 4 to 32 bytes.
+	minPrefixLen = 8
+	maxPrefixLen = 64
+
+	// maxPathPrefixes is the number of leading path segments tried.
+	maxPathPrefixes = 4
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown blocklist format, expected one of: hosts, domains, hashprefix")
+	ErrInvalidSource = errors.New("blocklist source must be <format>:<path>")
+)
+
+// hostsSkipped are the names hosts files map to themselves.
+var hostsSkipped = []string{"localhost", "localhost.localdomain", "local", "broadcasthost", "ip6-localhost", "ip6-loopback", "0.0.0.0"}
+
+// Source is a blocklist file and its format.
+type Source struct {
+	Format string
+	Path   string
+}
+
+// ParseSource parses a "<format>:<path>" source, e.g. "hosts:/etc/block".
+func ParseSource(s string) (Source, error) {
+	format, path, ok := strings.Cut(s, ":")
+	if !ok || path == "" {
+		return Source{}, fmt.Errorf("%w: %q", ErrInvalidSource, s)
+	}
+	if format != FormatHosts && format != FormatDomains && format != FormatHashPrefix {
+		return Source{}, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	return Source{format, path}, nil
+}
+
+// name is how matches of the source are reported.
+func (s Source) name() string {
+	return filepath.Base(s.Path)
+}
+
+// index is the content of all the sources, replaced as a whole on reload.
+type index struct {
+	// expressions are the listed domains ("example.com/") and urls
+	// ("example.com/path"), with the source listing them.
+	expressions map[string]string
+	// prefixes are the listed hash prefixes by length.
+	prefixes   map[string]string
+	prefixLens []int
+}
+
+// Blocklist answers whether urls are listed by one of its sources.
+type Blocklist struct {
+	l              *slog.Logger
+	sources        []Source
+	interval       time.Duration
+	checkRedirects bool
+
+	index atomic.Pointer[index]
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a blocklist of the sources, empty until Load is called.
+// checkRedirects tells the service to check links again when followed.
+func New(l *slog.Logger, sources []Source, interval time.Duration, checkRedirects bool) *Blocklist {
+	b := &Blocklist{
+		l:              l.With(slog.String("op", "blocklist")),
+		sources:        sources,
+		interval:       interval,
+		checkRedirects: checkRedirects,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	b.index.Store(&index{})
+	return b
+}
+
+// Load reads all the sources and swaps them in at once. On error the
+// lists loaded before are kept.
+func (b *Blocklist) Load() error {
+	const op = "blocklist.Load"
+
+	idx := &index{
+		expressions: make(map[string]string),
+		prefixes:    make(map[string]string),
+	}
+	for _, src := range b.sources {
+		n, err := idx.load(src)
+		if err != nil {
+			return util.OpWrap(op, err)
+		}
+		b.l.Info("blocklist loaded", slog.String("path", src.Path), slog.String("format", src.Format), slog.Int("entries", n))
+	}
+	slices.Sort(idx.prefixLens)
+
+	b.index.Store(idx)
+	return nil
+}
+
+// Start reloads the sources every interval in the background until Stop
+// is called.
+func (b *Blocklist) Start() {
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+				err := b.Load()
+				if err != nil {
+					b.l.Error("failed to reload blocklist, keeping the previous one", util.SlErr(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the background reloads and waits for them to exit.
+func (b *Blocklist) Stop() {
+	close(b.stop)
+	<-b.done
+}
+
+// CheckRedirects reports whether links are to be checked when followed,
+// catching the ones created before their destination was listed.
+func (b *Blocklist) CheckRedirects() bool {
+	return b.checkRedirects
+}
+
+// Blocked returns the name of the source listing rawURL, if one does. A
+// domain blocks its subdomains, a url ending with a slash blocks the urls
+// below it, other urls block themselves only, with or without query.
+// Hash prefixes are matched locally, a prefix match counts as listed.
+func (b *Blocklist) Blocked(rawURL string) (string, bool) {
+	idx := b.index.Load()
+	if len(idx.expressions) == 0 && len(idx.prefixes) == 0 {
+		return "", false
+	}
+
+	for _, expr := range expressions(rawURL) {
+		if name, ok := idx.expressions[expr]; ok {
+			return name, true
+		}
+		if len(idx.prefixLens) == 0 {
+			continue
+		}
+		sum := sha256.Sum256([]byte(expr))
+		hash := hex.EncodeToString(sum[:])
+		for _, n := range idx.prefixLens {
+			if name, ok := idx.prefixes[hash[:n]]; ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (idx *index) load(src Source) (int, error) {
+	f, err := os.Open(src.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := idx.read(f, src)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", src.Path, err)
+	}
+	return n, nil
+}
+
+// read adds the entries of r, invalid lines are skipped.
+func (idx *index) read(r io.Reader, src Source) (int, error) {
+	name := src.name()
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch src.Format {
+		case FormatHosts:
+			// The first field is the address the names are mapped to.
+			for _, field := range fields[1:] {
+				if slices.Contains(hostsSkipped, strings.ToLower(field)) {
+					continue
+				}
+				if expr, ok := entryExpression(field); ok {
+					idx.expressions[expr] = name
+					n++
+				}
+			}
+		case FormatDomains:
+			if expr, ok := entryExpression(fields[0]); ok {
+				idx.expressions[expr] = name
+				n++
+			}
+		case FormatHashPrefix:
+			prefix := strings.ToLower(fields[0])
+			if len(prefix) < minPrefixLen || len(prefix) > maxPrefixLen || len(prefix)%2 != 0 {
+				continue
+			}
+			if _, err := hex.DecodeString(prefix); err != nil {
+				continue
+			}
+			idx.prefixes[prefix] = name
+			if !slices.Contains(idx.prefixLens, len(prefix)) {
+				idx.prefixLens = append(idx.prefixLens, len(prefix))
+			}
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// entryExpression returns the expression of a listed domain or url.
+func entryExpression(entry string) (string, bool) {
+	if !strings.Contains(entry, "://") {
+		entry = "http://" + entry
+	}
+	u, err := url.Parse(entry)
+	if err != nil {
+		return "", false
+	}
+	host, ok := canonicalHost(u.Hostname())
+	if !ok {
+		return "", false
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return host + path, true
+}
+
+// expressions returns the expressions a url is looked up by: its host and
+// parent domains combined with its path, query included, and the leading
+// segments of its path.
+func expressions(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host, ok := canonicalHost(u.Hostname())
+	if !ok {
+		return nil
+	}
+
+	hosts := []string{host}
+	if _, err := netip.ParseAddr(host); err != nil {
+		labels := strings.Split(host, ".")
+		for i := 1; i < len(labels)-1; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	// The last segment is the path itself.
+	prefix := "/"
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < maxPathPrefixes; i++ {
+		if !slices.Contains(paths, prefix) {
+			paths = append(paths, prefix)
+		}
+		if i >= len(segments)-1 {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+	return exprs
+}
+
+func canonicalHost(host string) (string, bool) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String(), true
+	}
+	host, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", false
+	}
+	return host, true
+}
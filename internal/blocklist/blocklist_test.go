@@ -0,0 +1,117 @@
+package blocklist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+func hashPrefix(expr string, n int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestBlocked(t *testing.T) {
+	dir := t.TempDir()
+	hosts := writeFile(t, dir, "hosts.txt", "# ads\n"+
+		"127.0.0.1 localhost\n"+
+		"0.0.0.0 ads.example.com tracker.example.net # inline\n")
+	domains := writeFile(t, dir, "phishing.txt", "Evil.COM\n"+
+		"example.org/phish/\n"+
+		"https://example.org/login?next=1\n"+
+		"пример.рф\n")
+	prefixes := writeFile(t, dir, "malware.txt", hashPrefix("malware.test/", 8)+"\n"+
+		hashPrefix("example.io/dl/bad.exe", 64)+"\n"+
+		"not-hex\n")
+
+	b := New(logger.NewMock(), []Source{
+		{FormatHosts, hosts},
+		{FormatDomains, domains},
+		{FormatHashPrefix, prefixes},
+	}, time.Hour, true)
+	require.NoError(t, b.Load())
+
+	cases := []struct {
+		url  string
+		list string
+	}{
+		{"https://ads.example.com/banner.js", "hosts.txt"},
+		{"https://x.tracker.example.net", "hosts.txt"},
+		{"https://example.com", ""},
+		{"http://localhost", ""},
+		{"https://evil.com", "phishing.txt"},
+		{"https://a.b.evil.com/path?q=1", "phishing.txt"},
+		{"https://notevil.com", ""},
+		{"https://example.org/phish/", "phishing.txt"},
+		{"https://example.org/phish/deep/er/page.html", "phishing.txt"},
+		{"https://example.org/phishing", ""},
+		{"https://example.org/login?next=1", "phishing.txt"},
+		{"https://example.org/login?next=2", ""},
+		{"https://xn--e1afmkfd.xn--p1ai/", "phishing.txt"},
+		{"https://cdn.malware.test/x", "malware.txt"},
+		{"https://example.io/dl/bad.exe", "malware.txt"},
+		{"https://example.io/dl/good.exe", ""},
+		{"not a url", ""},
+	}
+	for _, tc := range cases {
+		list, blocked := b.Blocked(tc.url)
+		assert.Equal(t, tc.list != "", blocked, tc.url)
+		assert.Equal(t, tc.list, list, tc.url)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "list.txt", "evil.com\n")
+
+	b := New(logger.NewMock(), []Source{{FormatDomains, path}}, time.Millisecond, false)
+	_, blocked := b.Blocked("https://evil.com")
+	assert.False(t, blocked, "nothing is blocked before the first load")
+
+	require.NoError(t, b.Load())
+	_, blocked = b.Blocked("https://evil.com")
+	assert.True(t, blocked)
+
+	writeFile(t, dir, "list.txt", "worse.com\n")
+	b.Start()
+	require.Eventually(t, func() bool {
+		_, blocked := b.Blocked("https://worse.com")
+		return blocked
+	}, time.Second, time.Millisecond)
+	_, blocked = b.Blocked("https://evil.com")
+	assert.False(t, blocked)
+
+	// A failing reload keeps the lists loaded before.
+	require.NoError(t, os.Remove(path))
+	time.Sleep(10 * time.Millisecond)
+	b.Stop()
+	_, blocked = b.Blocked("https://worse.com")
+	assert.True(t, blocked)
+	assert.Error(t, b.Load())
+}
+
+func TestParseSource(t *testing.T) {
+	src, err := ParseSource("hosts:/etc/hosts.block")
+	require.NoError(t, err)
+	assert.Equal(t, Source{FormatHosts, "/etc/hosts.block"}, src)
+
+	_, err = ParseSource("/etc/hosts.block")
+	assert.ErrorIs(t, err, ErrInvalidSource)
+
+	_, err = ParseSource("xml:/etc/hosts.block")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := NewLRU[string, int](2)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1, time.Minute)
+	c.Add("b", 2, time.Minute)
+	_, _ = c.Get("a")
+	c.Add("c", 3, time.Minute)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok, "least recently used entry is evicted")
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.Add("c", 4, time.Second)
+	v, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 4, v)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("c")
+	assert.False(t, ok, "entry expires after its ttl")
+	assert.Equal(t, 1, c.Len())
+
+	c.Remove("a")
+	assert.Equal(t, 0, c.Len())
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+// URLs is a read-through cache of GetURLByAlias in front of the storage.
+// Concurrent misses of the same alias share one query, and unknown aliases
+// are cached for negativeTTL. Changes made through URLs invalidate their
+// entries, changes made by other instances are seen once entries expire.
+type URLs struct {
+	urls.URLStorage
+
+	lru         *LRU[string, cached]
+	ttl         time.Duration
+	negativeTTL time.Duration
+	group       singleflight.Group
+
+	// mu orders invalidations against loads: a load stores its result only
+	// if no invalidation happened since it started.
+	mu    sync.Mutex
+	epoch uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cached is a url or the fact there is no url with the alias.
+type cached struct {
+	url   types.URL
+	found bool
+}
+
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+func NewURLs(storage urls.URLStorage, size int, ttl, negativeTTL time.Duration) *URLs {
+	return &URLs{
+		URLStorage:  storage,
+		lru:         NewLRU[string, cached](size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+func (c *URLs) GetURLByAlias(ctx context.Context, alias string) (types.URL, error) {
+	if entry, ok := c.lru.Get(alias); ok {
+		c.hits.Add(1)
+		if !entry.found {
+			return types.URL{}, database.ErrURLUnfound
+		}
+		return entry.url, nil
+	}
+	c.misses.Add(1)
+
+	c.mu.Lock()
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	// The shared query must not be canceled when the request that started
+	// it goes away, the other waiters still need the result.
+	v, err, _ := c.group.Do(alias, func() (any, error) {
+		url, err := c.URLStorage.GetURLByAlias(context.WithoutCancel(ctx), alias)
+		switch {
+		case err == nil:
+			c.store(epoch, alias, cached{url, true}, c.ttl)
+		case errors.Is(err, database.ErrURLUnfound):
+			c.store(epoch, alias, cached{}, c.negativeTTL)
+		}
+		return url, err
+	})
+	if err != nil {
+		return types.URL{}, err
+	}
+	return v.(types.URL), nil
+}
+
+func (c *URLs) CreateURL(ctx context.Context, newURL types.NewURL) (types.URL, error) {
+	url, err := c.URLStorage.CreateURL(ctx, newURL)
+	c.invalidate(newURL.Alias)
+	return url, err
+}
+
+func (c *URLs) CreateURLs(ctx context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error) {
+	urls, err := c.URLStorage.CreateURLs(ctx, newURLs, atomic)
+	for _, newURL := range newURLs {
+		c.invalidate(newURL.Alias)
+	}
+	return urls, err
+}
+
+func (c *URLs) ConsumeClick(ctx context.Context, alias string) (types.URL, error) {
+	url, err := c.URLStorage.ConsumeClick(ctx, alias)
+	c.invalidate(alias)
+	return url, err
+}
+
+func (c *URLs) DeleteURLByAlias(ctx context.Context, alias, owner string) (types.URL, error) {
+	url, err := c.URLStorage.DeleteURLByAlias(ctx, alias, owner)
+	c.invalidate(alias)
+	return url, err
+}
+
+func (c *URLs) UpdateURL(ctx context.Context, alias, url string, version int64, owner string) (types.URL, error) {
+	updated, err := c.URLStorage.UpdateURL(ctx, alias, url, version, owner)
+	c.invalidate(alias)
+	return updated, err
+}
+
+func (c *URLs) Stats() Stats {
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.lru.Len(),
+	}
+}
+
+func (c *URLs) store(epoch uint64, alias string, entry cached, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch == epoch {
+		c.lru.Add(alias, entry, ttl)
+	}
+}
+
+func (c *URLs) invalidate(alias string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.lru.Remove(alias)
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/database/memory"
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+// countingStorage counts the lookups that reach the storage, and holds
+// them until release is closed.
+type countingStorage struct {
+	*memory.DB
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (s *countingStorage) GetURLByAlias(ctx context.Context, alias string) (types.URL, error) {
+	s.gets.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.DB.GetURLByAlias(ctx, alias)
+}
+
+func newCountingStorage(t *testing.T) *countingStorage {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	return &countingStorage{DB: db}
+}
+
+func TestURLsReadThrough(t *testing.T) {
+	ctx := context.Background()
+	storage := newCountingStorage(t)
+	c := NewURLs(storage, 10, time.Minute, time.Minute)
+
+	created, err := c.CreateURL(ctx, types.NewURL{Alias: "abc", Url: "https://example.com"})
+	require.NoError(t, err)
+
+	for range 3 {
+		url, err := c.GetURLByAlias(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, created, url)
+	}
+	assert.EqualValues(t, 1, storage.gets.Load())
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Size: 1}, c.Stats())
+
+	updated, err := c.UpdateURL(ctx, "abc", "https://example.org", 0, "")
+	require.NoError(t, err)
+	url, err := c.GetURLByAlias(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, updated, url)
+
+	_, err = c.DeleteURLByAlias(ctx, "abc", "")
+	require.NoError(t, err)
+	_, err = c.GetURLByAlias(ctx, "abc")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+	assert.EqualValues(t, 3, storage.gets.Load())
+}
+
+func TestURLsNegative(t *testing.T) {
+	ctx := context.Background()
+	storage := newCountingStorage(t)
+	c := NewURLs(storage, 10, time.Minute, time.Minute)
+
+	for range 3 {
+		_, err := c.GetURLByAlias(ctx, "abc")
+		require.ErrorIs(t, err, database.ErrURLUnfound)
+	}
+	assert.EqualValues(t, 1, storage.gets.Load())
+
+	// Creating the alias must not leave the negative entry behind.
+	created, err := c.CreateURL(ctx, types.NewURL{Alias: "abc", Url: "https://example.com"})
+	require.NoError(t, err)
+	url, err := c.GetURLByAlias(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, created, url)
+}
+
+func TestURLsSingleflight(t *testing.T) {
+	const workers = 16
+
+	ctx := context.Background()
+	storage := newCountingStorage(t)
+	_, err := storage.CreateURL(ctx, types.NewURL{Alias: "abc", Url: "https://example.com"})
+	require.NoError(t, err)
+	storage.release = make(chan struct{})
+	c := NewURLs(storage, 10, time.Minute, time.Minute)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetURLByAlias(ctx, "abc")
+			assert.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return c.Stats().Misses == workers
+	}, time.Second, time.Millisecond)
+	// Give the last ones the time to join the pending query.
+	time.Sleep(10 * time.Millisecond)
+	close(storage.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, storage.gets.Load())
+}
@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"math"
-	"strings"
+	"time"
 
 	"github.com/5aradise/link-forge/internal/types"
 	"github.com/5aradise/link-forge/internal/util"
@@ -11,44 +13,129 @@ import (
 
 func URLtoTypes(dbURL Url) types.URL {
 	return types.URL{
-		Id:    dbURL.ID,
-		Alias: dbURL.Alias,
-		Url:   dbURL.Url,
+		Id:      dbURL.ID,
+		Alias:   dbURL.Alias,
+		Url:     dbURL.Url,
+		Version: dbURL.Version,
+
+		CreatedAt: time.UnixMilli(dbURL.CreatedAt).UTC(),
+		UpdatedAt: time.UnixMilli(dbURL.UpdatedAt).UTC(),
+
+		ExpiresAt:  fromNullMilli(dbURL.ExpiresAt),
+		MaxClicks:  fromNullInt(dbURL.MaxClicks),
+		UsedClicks: dbURL.UsedClicks,
+
+		Owner: dbURL.Owner,
 	}
 }
 
 type DB struct {
-	q *Queries
+	conn *sql.DB
+	q    *Queries
 }
 
-func Create(db DBTX) *DB {
-	return &DB{New(db)}
+func Create(conn *sql.DB) *DB {
+	return &DB{conn, New(conn)}
 }
 
-func (db *DB) CreateURL(ctx context.Context, alias, url string) (types.URL, error) {
+func (db *DB) CreateURL(ctx context.Context, newURL types.NewURL) (types.URL, error) {
 	const op = "database.CreateURL"
 
+	now := time.Now().UnixMilli()
 	dbURL, err := db.q.CreateURL(ctx, CreateURLParams{
-		Alias: alias,
-		Url:   url,
+		Alias:     newURL.Alias,
+		Url:       newURL.Url,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: toNullMilli(newURL.ExpiresAt),
+		MaxClicks: toNullInt(newURL.MaxClicks),
+		Owner:     newURL.Owner,
 	})
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint") {
-			return types.URL{}, util.OpWrap(op, ErrAliasExists)
-		}
-
-		return types.URL{}, util.OpWrap(op, err)
+		return types.URL{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, ErrAliasExists))
 	}
 
 	return URLtoTypes(dbURL), nil
 }
 
-func (db *DB) ListURLs(ctx context.Context) ([]types.URL, error) {
+// CreateURLs creates the urls in one transaction. Urls whose alias is
+// taken are skipped and left zero in the result. With atomic set a taken
+// alias rolls the whole batch back and fails with ErrAliasExists, the
+// result still tells which urls were skipped.
+func (db *DB) CreateURLs(ctx context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error) {
+	const op = "database.CreateURLs"
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	defer tx.Rollback()
+
+	q := db.q.WithTx(tx)
+	now := time.Now().UnixMilli()
+	urls := make([]types.URL, len(newURLs))
+	skipped := false
+	for i, newURL := range newURLs {
+		dbURL, err := q.CreateURLIfAbsent(ctx, CreateURLIfAbsentParams{
+			Alias:     newURL.Alias,
+			Url:       newURL.Url,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: toNullMilli(newURL.ExpiresAt),
+			MaxClicks: toNullInt(newURL.MaxClicks),
+			Owner:     newURL.Owner,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			skipped = true
+			continue
+		}
+		if err != nil {
+			return nil, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, ErrAliasExists))
+		}
+		urls[i] = URLtoTypes(dbURL)
+	}
+	if atomic && skipped {
+		return urls, util.OpWrap(op, ErrAliasExists)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return urls, nil
+}
+
+// ListURLs returns a page of the urls matching params.
+func (db *DB) ListURLs(ctx context.Context, params types.ListURLsParams) ([]types.URL, error) {
 	const op = "database.ListURLs"
 
-	dbURLs, err := db.q.ListURLs(ctx)
+	var (
+		dbURLs []Url
+		err    error
+	)
+	if params.Desc {
+		before := params.After
+		if before == 0 {
+			before = math.MaxInt64
+		}
+		dbURLs, err = db.q.ListURLsDesc(ctx, ListURLsDescParams{
+			Before:      before,
+			AliasPrefix: params.AliasPrefix,
+			Host:        params.Host,
+			Owner:       params.Owner,
+			PageSize:    int64(params.Limit),
+		})
+	} else {
+		dbURLs, err = db.q.ListURLsAsc(ctx, ListURLsAscParams{
+			After:       params.After,
+			AliasPrefix: params.AliasPrefix,
+			Host:        params.Host,
+			Owner:       params.Owner,
+			PageSize:    int64(params.Limit),
+		})
+	}
 	if err != nil {
-		return nil, util.OpWrap(op, err)
+		return nil, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
 	}
 
 	urls := make([]types.URL, 0, len(dbURLs))
@@ -58,56 +145,201 @@ func (db *DB) ListURLs(ctx context.Context) ([]types.URL, error) {
 	return urls, nil
 }
 
+// CountURLs returns the number of urls matching filter.
+func (db *DB) CountURLs(ctx context.Context, filter types.URLFilter) (int64, error) {
+	const op = "database.CountURLs"
+
+	count, err := db.q.CountURLs(ctx, CountURLsParams{
+		AliasPrefix: filter.AliasPrefix,
+		Host:        filter.Host,
+		Owner:       filter.Owner,
+	})
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	return count, nil
+}
+
 func (db *DB) GetURLByAlias(ctx context.Context, alias string) (types.URL, error) {
 	const op = "database.GetURLByAlias"
 
 	dbURL, err := db.q.GetURLByAlias(ctx, alias)
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return types.URL{}, util.OpWrap(op, ErrURLUnfound)
-		}
+		return types.URL{}, util.OpWrap(op, MapErr(err, ClassifySQLite, ErrURLUnfound, nil))
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// DeleteURLByAlias deletes the url of alias. With a non empty owner only
+// a url of that owner is deleted, others fail with ErrNotOwner.
+func (db *DB) DeleteURLByAlias(ctx context.Context, alias, owner string) (types.URL, error) {
+	const op = "database.DeleteURLByAlias"
 
+	dbURL, err := db.q.DeleteURLByAlias(ctx, DeleteURLByAliasParams{
+		Alias: alias,
+		Owner: owner,
+	})
+	if err != nil {
+		err = MapErr(err, ClassifySQLite, ErrURLUnfound, nil)
+		if owner != "" && errors.Is(err, ErrURLUnfound) {
+			err = db.whyUnchanged(ctx, alias, owner, 0)
+		}
 		return types.URL{}, util.OpWrap(op, err)
 	}
 
 	return URLtoTypes(dbURL), nil
 }
 
-func (db *DB) DeleteURLByAlias(ctx context.Context, alias string) (types.URL, error) {
-	const op = "database.DeleteURLByAlias"
+// UpdateURL sets the url of alias. With a non zero version the update is
+// applied only if the stored url is still of that version, with a non
+// empty owner only if it is of that owner.
+func (db *DB) UpdateURL(ctx context.Context, alias, url string, version int64, owner string) (types.URL, error) {
+	const op = "database.UpdateURL"
 
-	dbURL, err := db.q.DeleteURLByAlias(ctx, alias)
+	dbURL, err := db.q.UpdateURL(ctx, UpdateURLParams{
+		Url:       url,
+		UpdatedAt: time.Now().UnixMilli(),
+		Alias:     alias,
+		Version:   version,
+		Owner:     owner,
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return types.URL{}, util.OpWrap(op, ErrURLUnfound)
+		err = MapErr(err, ClassifySQLite, ErrURLUnfound, nil)
+		if (version != 0 || owner != "") && errors.Is(err, ErrURLUnfound) {
+			err = db.whyUnchanged(ctx, alias, owner, version)
 		}
+		return types.URL{}, util.OpWrap(op, err)
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// whyUnchanged tells apart the reasons a conditional write of alias
+// changed nothing: the alias is unknown, of another owner or of another
+// version. The write itself is already done, so the url may have changed
+// since, the reason is only reported.
+func (db *DB) whyUnchanged(ctx context.Context, alias, owner string, version int64) error {
+	stored, err := db.q.GetURLByAlias(ctx, alias)
+	switch {
+	case err != nil:
+		return ErrURLUnfound
+	case owner != "" && stored.Owner != owner:
+		return ErrNotOwner
+	case version != 0 && stored.Version != version:
+		return ErrVersionMismatch
+	}
+	// Replaced in between by a url the write would have matched.
+	return ErrURLUnfound
+}
+
+// ConsumeClick counts a redirect against the click budget of alias. It
+// fails with ErrURLExpired when the url has no clicks left or is expired.
+func (db *DB) ConsumeClick(ctx context.Context, alias string) (types.URL, error) {
+	const op = "database.ConsumeClick"
 
+	dbURL, err := db.q.ConsumeClick(ctx, ConsumeClickParams{
+		Now:   sql.NullInt64{Int64: time.Now().UnixMilli(), Valid: true},
+		Alias: alias,
+	})
+	if err != nil {
+		err = MapErr(err, ClassifySQLite, ErrURLUnfound, nil)
+		if errors.Is(err, ErrURLUnfound) {
+			_, getErr := db.q.GetURLByAlias(ctx, alias)
+			if getErr == nil {
+				err = ErrURLExpired
+			}
+		}
 		return types.URL{}, util.OpWrap(op, err)
 	}
 
 	return URLtoTypes(dbURL), nil
 }
 
-func (db *DB) LoadState(ctx context.Context) (uint32, error) {
-	const op = "database.LoadState"
+// SweepExpiredURLs removes the urls expired before the given time, moving
+// them to the archive if asked to, and returns how many were removed.
+func (db *DB) SweepExpiredURLs(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	const op = "database.SweepExpiredURLs"
+
+	cutoff := sql.NullInt64{Int64: before.UnixMilli(), Valid: true}
+	if !archive {
+		n, err := db.q.DeleteExpiredURLs(ctx, cutoff)
+		if err != nil {
+			return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+		}
+		return n, nil
+	}
 
-	aliasCount, err := db.q.LoadState(ctx)
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, util.OpWrap(op, err)
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
 	}
-	if aliasCount < 0 || aliasCount > math.MaxUint32 {
-		return 0, util.OpWrap(op, ErrIntOverflow)
+	defer tx.Rollback()
+
+	q := db.q.WithTx(tx)
+	err = q.ArchiveExpiredURLs(ctx, ArchiveExpiredURLsParams{
+		ArchivedAt: time.Now().UnixMilli(),
+		Before:     cutoff,
+	})
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	n, err := q.DeleteExpiredURLs(ctx, cutoff)
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
 	}
 
-	return uint32(aliasCount), nil
+	err = tx.Commit()
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return n, nil
 }
 
-func (db *DB) StoreState(ctx context.Context, aliasCount uint32) error {
-	const op = "database.StoreState"
+// LeaseAliases reserves n alias counter values and returns the first one.
+// The counter is advanced by a single UPDATE ... RETURNING, so concurrent
+// instances sharing the database always get disjoint ranges.
+func (db *DB) LeaseAliases(ctx context.Context, n uint32) (uint32, error) {
+	const op = "database.LeaseAliases"
 
-	err := db.q.StoreState(ctx, int64(aliasCount))
+	aliasCount, err := db.q.LeaseAliases(ctx, int64(n))
 	if err != nil {
-		return util.OpWrap(op, err)
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	start := aliasCount - int64(n)
+	if start < 0 || aliasCount > math.MaxUint32 {
+		return 0, util.OpWrap(op, ErrIntOverflow)
+	}
+
+	return uint32(start), nil
+}
+
+func toNullMilli(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+func fromNullMilli(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.UnixMilli(v.Int64).UTC()
+	return &t
+}
+
+func toNullInt(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
+
+func fromNullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
 	}
-	return nil
+	return &v.Int64
 }
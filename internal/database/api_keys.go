@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+func (db *DB) CreateAPIKey(ctx context.Context, name, keyHash string, admin bool) (types.APIKey, error) {
+	const op = "database.CreateAPIKey"
+
+	var isAdmin int64
+	if admin {
+		isAdmin = 1
+	}
+	key, err := db.q.CreateAPIKey(ctx, CreateAPIKeyParams{
+		Name:      name,
+		KeyHash:   keyHash,
+		Admin:     isAdmin,
+		CreatedAt: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return types.APIKey{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	return apiKeyToTypes(key), nil
+}
+
+func (db *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (types.APIKey, error) {
+	const op = "database.GetAPIKeyByHash"
+
+	key, err := db.q.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		return types.APIKey{}, util.OpWrap(op, MapErr(err, ClassifySQLite, ErrKeyUnfound, nil))
+	}
+
+	return apiKeyToTypes(key), nil
+}
+
+func apiKeyToTypes(key ApiKey) types.APIKey {
+	return types.APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Admin:     key.Admin != 0,
+		CreatedAt: time.UnixMilli(key.CreatedAt).UTC(),
+	}
+}
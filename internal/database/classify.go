@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrKind is the class of a driver error the adapters act on.
+type ErrKind int
+
+const (
+	KindUnknown ErrKind = iota
+	KindNoRows
+	KindUniqueViolation
+	KindTimeout
+	KindUnavailable
+)
+
+// Classifier recognizes the errors of a particular driver by their codes.
+// It returns KindUnknown for the errors it doesn't know.
+type Classifier func(err error) ErrKind
+
+// Classify finds the kind of err. The errors every driver shares through
+// database/sql, context and net are checked first, then the driver ones.
+func Classify(err error, c Classifier) ErrKind {
+	switch {
+	case err == nil:
+		return KindUnknown
+	case errors.Is(err, sql.ErrNoRows):
+		return KindNoRows
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return KindUnavailable
+	}
+
+	if c != nil {
+		if kind := c(err); kind != KindUnknown {
+			return kind
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return KindTimeout
+		}
+		return KindUnavailable
+	}
+	return KindUnknown
+}
+
+// MapErr maps err to the sentinel error of its kind: notFound for no rows,
+// conflict for unique violations and ErrTimeout or ErrUnavailable when the
+// database can't serve the query. A nil sentinel leaves the kind unmapped.
+// The driver error stays in the chain.
+func MapErr(err error, c Classifier, notFound, conflict error) error {
+	var sentinel error
+	switch Classify(err, c) {
+	case KindNoRows:
+		sentinel = notFound
+	case KindUniqueViolation:
+		sentinel = conflict
+	case KindTimeout:
+		sentinel = ErrTimeout
+	case KindUnavailable:
+		sentinel = ErrUnavailable
+	}
+
+	if sentinel == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
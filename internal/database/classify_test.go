@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := map[string]struct {
+		err  error
+		want ErrKind
+	}{
+		"no_rows":       {err: fmt.Errorf("query: %w", sql.ErrNoRows), want: KindNoRows},
+		"deadline":      {err: context.DeadlineExceeded, want: KindTimeout},
+		"bad_conn":      {err: fmt.Errorf("%w: closed", driver.ErrBadConn), want: KindUnavailable},
+		"conn_done":     {err: sql.ErrConnDone, want: KindUnavailable},
+		"net_timeout":   {err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, want: KindTimeout},
+		"conn_refused":  {err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, want: KindUnavailable},
+		"libsql_unique": {err: errors.New("failed to execute SQL: INSERT\nSQLite error: UNIQUE constraint failed: urls.alias"), want: KindUniqueViolation},
+		"libsql_busy":   {err: errors.New("error code SQLITE_BUSY: database is locked"), want: KindTimeout},
+		"unknown":       {err: errors.New("something else"), want: KindUnknown},
+		"nil":           {err: nil, want: KindUnknown},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Classify(tc.err, ClassifySQLite))
+		})
+	}
+}
+
+func TestClassifySQLiteDriver(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	_, err = conn.Exec(`CREATE TABLE t (v TEXT NOT NULL UNIQUE)`)
+	require.NoError(t, err)
+	_, err = conn.Exec(`INSERT INTO t (v) VALUES ('a')`)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(`INSERT INTO t (v) VALUES ('a')`)
+	assert.Equal(t, KindUniqueViolation, Classify(err, ClassifySQLite))
+
+	err = conn.QueryRow(`SELECT v FROM t WHERE v = 'b'`).Scan(new(string))
+	assert.Equal(t, KindNoRows, Classify(err, ClassifySQLite))
+}
+
+func TestMapErr(t *testing.T) {
+	driverErr := fmt.Errorf("%w: closed", driver.ErrBadConn)
+
+	err := MapErr(driverErr, ClassifySQLite, ErrURLUnfound, ErrAliasExists)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, driverErr)
+
+	err = MapErr(sql.ErrNoRows, ClassifySQLite, ErrURLUnfound, ErrAliasExists)
+	assert.ErrorIs(t, err, ErrURLUnfound)
+
+	err = MapErr(sql.ErrNoRows, ClassifySQLite, nil, ErrAliasExists)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
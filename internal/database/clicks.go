@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// InsertClicks writes a batch of clicks in one transaction.
+func (db *DB) InsertClicks(ctx context.Context, clicks []types.Click) error {
+	const op = "database.InsertClicks"
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	defer tx.Rollback()
+
+	q := db.q.WithTx(tx)
+	for _, c := range clicks {
+		err = q.InsertClick(ctx, InsertClickParams{
+			UrlID:      c.URLID,
+			Alias:      c.Alias,
+			ClickedAt:  c.At.UnixMilli(),
+			Referrer:   c.Referrer,
+			UserAgent:  c.UserAgent,
+			RemoteAddr: c.RemoteAddr,
+			RequestID:  c.RequestID,
+
+			Visitor:      c.Visitor,
+			ReferrerHost: c.ReferrerHost,
+			Country:      c.Country,
+			Device:       c.Device,
+		})
+		if err != nil {
+			return util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return nil
+}
+
+// CountClicks returns the number of clicks recorded for the url.
+func (db *DB) CountClicks(ctx context.Context, urlID int64) (int64, error) {
+	const op = "database.CountClicks"
+
+	count, err := db.q.CountClicks(ctx, urlID)
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return count, nil
+}
+
+// ClickStats aggregates the clicks of a url made in the selected range.
+func (db *DB) ClickStats(ctx context.Context, params types.ClickStatsParams) (types.ClickStats, error) {
+	const op = "database.ClickStats"
+
+	totals, err := db.q.ClickTotals(ctx, ClickTotalsParams{
+		UrlID:    params.URLID,
+		FromTime: params.From.UnixMilli(),
+		ToTime:   params.To.UnixMilli(),
+	})
+	if err != nil {
+		return types.ClickStats{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	series, err := db.q.ClickSeries(ctx, ClickSeriesParams{
+		Origin:   types.BucketOrigin.UnixMilli(),
+		Width:    params.Bucket.Milliseconds(),
+		UrlID:    params.URLID,
+		FromTime: params.From.UnixMilli(),
+		ToTime:   params.To.UnixMilli(),
+	})
+	if err != nil {
+		return types.ClickStats{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	referrers, err := db.q.TopReferrers(ctx, TopReferrersParams{
+		UrlID:    params.URLID,
+		FromTime: params.From.UnixMilli(),
+		ToTime:   params.To.UnixMilli(),
+		Top:      int64(params.Top),
+	})
+	if err != nil {
+		return types.ClickStats{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	countries, err := db.q.TopCountries(ctx, TopCountriesParams{
+		UrlID:    params.URLID,
+		FromTime: params.From.UnixMilli(),
+		ToTime:   params.To.UnixMilli(),
+		Top:      int64(params.Top),
+	})
+	if err != nil {
+		return types.ClickStats{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	devices, err := db.q.TopDevices(ctx, TopDevicesParams{
+		UrlID:    params.URLID,
+		FromTime: params.From.UnixMilli(),
+		ToTime:   params.To.UnixMilli(),
+		Top:      int64(params.Top),
+	})
+	if err != nil {
+		return types.ClickStats{}, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	stats := types.ClickStats{
+		Clicks:    totals.Clicks,
+		Visitors:  totals.Visitors,
+		Series:    make([]types.ClickBucket, 0, len(series)),
+		Referrers: make([]types.ClickCount, 0, len(referrers)),
+		Countries: make([]types.ClickCount, 0, len(countries)),
+		Devices:   make([]types.ClickCount, 0, len(devices)),
+	}
+	for _, b := range series {
+		stats.Series = append(stats.Series, types.ClickBucket{Start: time.UnixMilli(b.Bucket).UTC(), Clicks: b.Clicks})
+	}
+	for _, r := range referrers {
+		stats.Referrers = append(stats.Referrers, types.ClickCount{Value: r.Value, Clicks: r.Clicks})
+	}
+	for _, c := range countries {
+		stats.Countries = append(stats.Countries, types.ClickCount{Value: c.Value, Clicks: c.Clicks})
+	}
+	for _, d := range devices {
+		stats.Devices = append(stats.Devices, types.ClickCount{Value: d.Value, Clicks: d.Clicks})
+	}
+	return stats, nil
+}
@@ -3,7 +3,16 @@ package database
 import "errors"
 
 var (
-	ErrAliasExists = errors.New("alias exists")
-	ErrURLUnfound  = errors.New("url unfound")
+	ErrAliasExists     = errors.New("alias exists")
+	ErrURLUnfound      = errors.New("url unfound")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrNotOwner        = errors.New("url owned by someone else")
+	ErrURLExpired      = errors.New("url expired")
+	ErrKeyUnfound      = errors.New("api key unfound")
+	// ErrKeyReleased is returned when an idempotency key is released
+	// between a failed claim and the read of the request holding it.
+	ErrKeyReleased = errors.New("idempotency key released")
 	ErrIntOverflow = errors.New("integer overflow: aliasCount is out of range for uint32")
+	ErrTimeout     = errors.New("database timeout")
+	ErrUnavailable = errors.New("database unavailable")
 )
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// ClaimIdempotencyKey stores req unless a request with the same owner and
+// key, made after expiredBefore, is stored, or still in progress and made
+// after abandonedBefore. Then it returns that request and false, or fails
+// with ErrKeyReleased if the request was removed in between.
+func (db *DB) ClaimIdempotencyKey(ctx context.Context, req types.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (types.IdempotentRequest, bool, error) {
+	const op = "database.ClaimIdempotencyKey"
+
+	key, err := db.q.ClaimIdempotencyKey(ctx, ClaimIdempotencyKeyParams{
+		Owner:           req.Owner,
+		IdempotencyKey:  req.Key,
+		RequestHash:     req.RequestHash,
+		CreatedAt:       req.CreatedAt.UnixMilli(),
+		ExpiredBefore:   expiredBefore.UnixMilli(),
+		AbandonedBefore: abandonedBefore.UnixMilli(),
+	})
+	if err == nil {
+		return idempotencyKeyToTypes(key), true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return types.IdempotentRequest{}, false, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+
+	key, err = db.q.GetIdempotencyKey(ctx, GetIdempotencyKeyParams{
+		Owner:          req.Owner,
+		IdempotencyKey: req.Key,
+	})
+	if err != nil {
+		return types.IdempotentRequest{}, false, util.OpWrap(op, MapErr(err, ClassifySQLite, ErrKeyReleased, nil))
+	}
+	return idempotencyKeyToTypes(key), false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the claimed request. It
+// does nothing once the key is claimed by another request.
+func (db *DB) CompleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest, statusCode int, response []byte) error {
+	const op = "database.CompleteIdempotencyKey"
+
+	err := db.q.CompleteIdempotencyKey(ctx, CompleteIdempotencyKeyParams{
+		StatusCode:     int64(statusCode),
+		Response:       response,
+		Owner:          claim.Owner,
+		IdempotencyKey: claim.Key,
+		RequestHash:    claim.RequestHash,
+		CreatedAt:      claim.CreatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases the key of the claimed request, so the
+// request can be retried. It does nothing once the key is claimed by
+// another request.
+func (db *DB) DeleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest) error {
+	const op = "database.DeleteIdempotencyKey"
+
+	err := db.q.DeleteIdempotencyKey(ctx, DeleteIdempotencyKeyParams{
+		Owner:          claim.Owner,
+		IdempotencyKey: claim.Key,
+		RequestHash:    claim.RequestHash,
+		CreatedAt:      claim.CreatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the requests made before the given
+// time and returns how many were removed.
+func (db *DB) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	const op = "database.DeleteExpiredIdempotencyKeys"
+
+	n, err := db.q.DeleteExpiredIdempotencyKeys(ctx, before.UnixMilli())
+	if err != nil {
+		return 0, util.OpWrap(op, MapErr(err, ClassifySQLite, nil, nil))
+	}
+	return n, nil
+}
+
+func idempotencyKeyToTypes(key IdempotencyKey) types.IdempotentRequest {
+	return types.IdempotentRequest{
+		Owner:       key.Owner,
+		Key:         key.IdempotencyKey,
+		RequestHash: key.RequestHash,
+		CreatedAt:   time.UnixMilli(key.CreatedAt).UTC(),
+		StatusCode:  int(key.StatusCode),
+		Response:    key.Response,
+	}
+}
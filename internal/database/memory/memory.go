@@ -0,0 +1,622 @@
+// Package memory is a storage kept in process memory, for tests, demos and
+// local development. It can be snapshotted to a file on close and loaded
+// back on open. Only the last maxClicks clicks are kept.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+// maxClicks is how many clicks are kept, older ones are dropped so that a
+// long running storage and its snapshots do not grow without bound.
+const maxClicks = 100_000
+
+type DB struct {
+	path string
+
+	mu       sync.RWMutex
+	urls     map[string]types.URL
+	archived []types.URL
+	clicks   []types.Click
+	keys     map[string]types.APIKey
+	// requests are not snapshotted, replays are lost on restart.
+	requests map[requestKey]types.IdempotentRequest
+	// The buckets of the rate limiter are not snapshotted either.
+	*middleware.MemoryRateLimitStore
+	lastID     int64
+	lastKeyID  int64
+	aliasCount int64
+}
+
+// snapshot is the file format of the storage.
+type snapshot struct {
+	LastID     int64         `json:"last_id"`
+	AliasCount int64         `json:"alias_count"`
+	URLs       []types.URL   `json:"urls"`
+	Archived   []types.URL   `json:"archived,omitempty"`
+	Clicks     []types.Click `json:"clicks,omitempty"`
+	Keys       []snapshotKey `json:"keys,omitempty"`
+}
+
+type requestKey struct {
+	owner string
+	key   string
+}
+
+type snapshotKey struct {
+	types.APIKey
+	Hash string `json:"hash"`
+}
+
+// Open creates an empty storage, or loads it from the snapshot at path
+// when the file exists. With an empty path nothing survives Close.
+func Open(path string) (*DB, error) {
+	const op = "memory.Open"
+
+	db := &DB{
+		path: path,
+		urls: make(map[string]types.URL),
+		keys: make(map[string]types.APIKey),
+
+		requests: make(map[requestKey]types.IdempotentRequest),
+
+		MemoryRateLimitStore: middleware.NewMemoryRateLimitStore(),
+	}
+	if path == "" {
+		return db, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return db, nil
+		}
+		return nil, util.OpWrap(op, err)
+	}
+
+	var snap snapshot
+	err = json.Unmarshal(data, &snap)
+	if err != nil {
+		return nil, util.OpWrap(op, err)
+	}
+
+	db.lastID = snap.LastID
+	db.aliasCount = snap.AliasCount
+	db.archived = snap.Archived
+	db.clicks = trimClicks(snap.Clicks)
+	for _, key := range snap.Keys {
+		db.keys[key.Hash] = key.APIKey
+		db.lastKeyID = max(db.lastKeyID, key.ID)
+	}
+	for _, url := range snap.URLs {
+		// Snapshots written before urls were versioned.
+		url.Version = max(url.Version, 1)
+		db.urls[url.Alias] = url
+	}
+	return db, nil
+}
+
+// Close writes the snapshot if the storage was opened with a path.
+func (db *DB) Close() error {
+	const op = "memory.Close"
+
+	if db.path == "" {
+		return nil
+	}
+
+	db.mu.RLock()
+	snap := snapshot{
+		LastID:     db.lastID,
+		AliasCount: db.aliasCount,
+		URLs:       db.sorted(),
+		Archived:   db.archived,
+		Clicks:     db.clicks,
+	}
+	for hash, key := range db.keys {
+		snap.Keys = append(snap.Keys, snapshotKey{key, hash})
+	}
+	db.mu.RUnlock()
+	slices.SortFunc(snap.Keys, func(a, b snapshotKey) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return util.OpWrap(op, err)
+	}
+
+	// Write next to the target and rename, so a crash while writing
+	// never leaves a truncated snapshot behind.
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*")
+	if err != nil {
+		return util.OpWrap(op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return util.OpWrap(op, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return util.OpWrap(op, err)
+	}
+
+	err = os.Rename(tmp.Name(), db.path)
+	if err != nil {
+		return util.OpWrap(op, err)
+	}
+	return nil
+}
+
+func (db *DB) CreateURL(_ context.Context, newURL types.NewURL) (types.URL, error) {
+	const op = "memory.CreateURL"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.urls[newURL.Alias]; ok {
+		return types.URL{}, util.OpWrap(op, database.ErrAliasExists)
+	}
+
+	return db.insert(newURL, time.Now().UTC()), nil
+}
+
+// CreateURLs creates the urls at once. Urls whose alias is taken are
+// skipped and left zero in the result. With atomic set a taken alias
+// creates none of them and fails with database.ErrAliasExists, the result
+// still tells which urls were skipped.
+func (db *DB) CreateURLs(_ context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error) {
+	const op = "memory.CreateURLs"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now().UTC()
+	urls := make([]types.URL, len(newURLs))
+	if atomic {
+		taken := make(map[string]bool, len(newURLs))
+		id := db.lastID
+		skipped := false
+		for i, newURL := range newURLs {
+			_, exists := db.urls[newURL.Alias]
+			if exists || taken[newURL.Alias] {
+				skipped = true
+				continue
+			}
+			taken[newURL.Alias] = true
+			id++
+			urls[i] = newRecord(id, newURL, now)
+		}
+		if skipped {
+			return urls, util.OpWrap(op, database.ErrAliasExists)
+		}
+	}
+
+	for i, newURL := range newURLs {
+		if _, ok := db.urls[newURL.Alias]; ok {
+			continue
+		}
+		urls[i] = db.insert(newURL, now)
+	}
+	return urls, nil
+}
+
+func (db *DB) insert(newURL types.NewURL, now time.Time) types.URL {
+	db.lastID++
+	url := newRecord(db.lastID, newURL, now)
+	db.urls[url.Alias] = url
+	return url
+}
+
+func newRecord(id int64, newURL types.NewURL, now time.Time) types.URL {
+	return types.URL{
+		Id:      id,
+		Alias:   newURL.Alias,
+		Url:     newURL.Url,
+		Version: 1,
+
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		ExpiresAt: newURL.ExpiresAt,
+		MaxClicks: newURL.MaxClicks,
+
+		Owner: newURL.Owner,
+	}
+}
+
+// ListURLs returns a page of the urls matching params.
+func (db *DB) ListURLs(_ context.Context, params types.ListURLsParams) ([]types.URL, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	sorted := db.sorted()
+	if params.Desc {
+		slices.Reverse(sorted)
+	}
+
+	urls := make([]types.URL, 0, params.Limit)
+	for _, url := range sorted {
+		if len(urls) == params.Limit {
+			break
+		}
+		if params.After != 0 && (params.Desc && url.Id >= params.After || !params.Desc && url.Id <= params.After) {
+			continue
+		}
+		if matches(url, params.URLFilter) {
+			urls = append(urls, url)
+		}
+	}
+	return urls, nil
+}
+
+// CountURLs returns the number of urls matching filter.
+func (db *DB) CountURLs(_ context.Context, filter types.URLFilter) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var count int64
+	for _, url := range db.urls {
+		if matches(url, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (db *DB) GetURLByAlias(_ context.Context, alias string) (types.URL, error) {
+	const op = "memory.GetURLByAlias"
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	url, ok := db.urls[alias]
+	if !ok {
+		return types.URL{}, util.OpWrap(op, database.ErrURLUnfound)
+	}
+
+	return url, nil
+}
+
+// DeleteURLByAlias deletes the url of alias. With a non empty owner only
+// a url of that owner is deleted, others fail with database.ErrNotOwner.
+func (db *DB) DeleteURLByAlias(_ context.Context, alias, owner string) (types.URL, error) {
+	const op = "memory.DeleteURLByAlias"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	url, ok := db.urls[alias]
+	if !ok {
+		return types.URL{}, util.OpWrap(op, database.ErrURLUnfound)
+	}
+	if owner != "" && url.Owner != owner {
+		return types.URL{}, util.OpWrap(op, database.ErrNotOwner)
+	}
+	delete(db.urls, alias)
+
+	return url, nil
+}
+
+// UpdateURL sets the url of alias. With a non zero version the update is
+// applied only if the stored url is still of that version, with a non
+// empty owner only if it is of that owner.
+func (db *DB) UpdateURL(_ context.Context, alias, url string, version int64, owner string) (types.URL, error) {
+	const op = "memory.UpdateURL"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.urls[alias]
+	if !ok {
+		return types.URL{}, util.OpWrap(op, database.ErrURLUnfound)
+	}
+	if owner != "" && stored.Owner != owner {
+		return types.URL{}, util.OpWrap(op, database.ErrNotOwner)
+	}
+	if version != 0 && stored.Version != version {
+		return types.URL{}, util.OpWrap(op, database.ErrVersionMismatch)
+	}
+
+	stored.Url = url
+	stored.Version++
+	stored.UpdatedAt = time.Now().UTC()
+	db.urls[alias] = stored
+
+	return stored, nil
+}
+
+// ConsumeClick counts a redirect against the click budget of alias. It
+// fails with database.ErrURLExpired when the url has no clicks left or is
+// expired.
+func (db *DB) ConsumeClick(_ context.Context, alias string) (types.URL, error) {
+	const op = "memory.ConsumeClick"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	url, ok := db.urls[alias]
+	if !ok {
+		return types.URL{}, util.OpWrap(op, database.ErrURLUnfound)
+	}
+	now := time.Now().UTC()
+	if url.MaxClicks == nil || url.UsedClicks >= *url.MaxClicks || url.Expired(now) {
+		return types.URL{}, util.OpWrap(op, database.ErrURLExpired)
+	}
+
+	url.UsedClicks++
+	if url.UsedClicks >= *url.MaxClicks {
+		url.ExpiresAt = &now
+	}
+	db.urls[alias] = url
+
+	return url, nil
+}
+
+// SweepExpiredURLs removes the urls expired before the given time, moving
+// them to the archive if asked to, and returns how many were removed.
+func (db *DB) SweepExpiredURLs(_ context.Context, before time.Time, archive bool) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var n int64
+	for alias, url := range db.urls {
+		if url.ExpiresAt == nil || url.ExpiresAt.After(before) {
+			continue
+		}
+		if archive {
+			db.archived = append(db.archived, url)
+		}
+		delete(db.urls, alias)
+		n++
+	}
+	return n, nil
+}
+
+// InsertClicks records a batch of clicks.
+func (db *DB) InsertClicks(_ context.Context, clicks []types.Click) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.clicks = trimClicks(append(db.clicks, clicks...))
+	return nil
+}
+
+// trimClicks drops the oldest clicks beyond maxClicks.
+func trimClicks(clicks []types.Click) []types.Click {
+	if len(clicks) <= maxClicks {
+		return clicks
+	}
+	n := copy(clicks, clicks[len(clicks)-maxClicks:])
+	return clicks[:n]
+}
+
+// CountClicks returns the number of clicks recorded for the url.
+func (db *DB) CountClicks(_ context.Context, urlID int64) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var count int64
+	for _, c := range db.clicks {
+		if c.URLID == urlID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ClickStats aggregates the clicks of a url made in the selected range.
+func (db *DB) ClickStats(_ context.Context, params types.ClickStatsParams) (types.ClickStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var (
+		stats     types.ClickStats
+		visitors  = make(map[string]struct{})
+		buckets   = make(map[time.Time]int64)
+		referrers = make(map[string]int64)
+		countries = make(map[string]int64)
+		devices   = make(map[string]int64)
+	)
+	for _, c := range db.clicks {
+		if c.URLID != params.URLID || c.At.Before(params.From) || !c.At.Before(params.To) {
+			continue
+		}
+		stats.Clicks++
+		if c.Visitor != "" {
+			visitors[c.Visitor] = struct{}{}
+		}
+		start := types.BucketOrigin.Add(c.At.Sub(types.BucketOrigin).Truncate(params.Bucket))
+		buckets[start]++
+		referrers[c.ReferrerHost]++
+		countries[c.Country]++
+		devices[c.Device]++
+	}
+	stats.Visitors = int64(len(visitors))
+
+	stats.Series = make([]types.ClickBucket, 0, len(buckets))
+	for start, clicks := range buckets {
+		stats.Series = append(stats.Series, types.ClickBucket{Start: start.UTC(), Clicks: clicks})
+	}
+	slices.SortFunc(stats.Series, func(a, b types.ClickBucket) int {
+		return a.Start.Compare(b.Start)
+	})
+	stats.Referrers = top(referrers, params.Top)
+	stats.Countries = top(countries, params.Top)
+	stats.Devices = top(devices, params.Top)
+	return stats, nil
+}
+
+func (db *DB) CreateAPIKey(_ context.Context, name, keyHash string, admin bool) (types.APIKey, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.lastKeyID++
+	key := types.APIKey{
+		ID:        db.lastKeyID,
+		Name:      name,
+		Admin:     admin,
+		CreatedAt: time.Now().UTC(),
+	}
+	db.keys[keyHash] = key
+
+	return key, nil
+}
+
+func (db *DB) GetAPIKeyByHash(_ context.Context, keyHash string) (types.APIKey, error) {
+	const op = "memory.GetAPIKeyByHash"
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	key, ok := db.keys[keyHash]
+	if !ok {
+		return types.APIKey{}, util.OpWrap(op, database.ErrKeyUnfound)
+	}
+
+	return key, nil
+}
+
+// ClaimIdempotencyKey stores req unless a request with the same owner and
+// key, made after expiredBefore, is stored, or still in progress and made
+// after abandonedBefore. Then it returns that request and false.
+func (db *DB) ClaimIdempotencyKey(_ context.Context, req types.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (types.IdempotentRequest, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k := requestKey{req.Owner, req.Key}
+	stored, ok := db.requests[k]
+	abandoned := stored.StatusCode == 0 && stored.CreatedAt.Before(abandonedBefore)
+	if ok && !stored.CreatedAt.Before(expiredBefore) && !abandoned {
+		return stored, false, nil
+	}
+
+	req.StatusCode = 0
+	req.Response = nil
+	db.requests[k] = req
+	return req, true, nil
+}
+
+// CompleteIdempotencyKey stores the response of the claimed request. It
+// does nothing once the key is claimed by another request.
+func (db *DB) CompleteIdempotencyKey(_ context.Context, claim types.IdempotentRequest, statusCode int, response []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k := requestKey{claim.Owner, claim.Key}
+	req, ok := db.requests[k]
+	if !ok || !sameClaim(req, claim) {
+		return nil
+	}
+	req.StatusCode = statusCode
+	req.Response = slices.Clone(response)
+	db.requests[k] = req
+	return nil
+}
+
+// DeleteIdempotencyKey releases the key of the claimed request, so the
+// request can be retried. It does nothing once the key is claimed by
+// another request.
+func (db *DB) DeleteIdempotencyKey(_ context.Context, claim types.IdempotentRequest) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k := requestKey{claim.Owner, claim.Key}
+	if req, ok := db.requests[k]; ok && sameClaim(req, claim) {
+		delete(db.requests, k)
+	}
+	return nil
+}
+
+func sameClaim(req, claim types.IdempotentRequest) bool {
+	return req.RequestHash == claim.RequestHash && req.CreatedAt.Equal(claim.CreatedAt)
+}
+
+// DeleteExpiredIdempotencyKeys removes the requests made before the given
+// time and returns how many were removed.
+func (db *DB) DeleteExpiredIdempotencyKeys(_ context.Context, before time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var n int64
+	for k, req := range db.requests {
+		if req.CreatedAt.Before(before) {
+			delete(db.requests, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// LeaseAliases reserves n alias counter values and returns the first one.
+func (db *DB) LeaseAliases(_ context.Context, n uint32) (uint32, error) {
+	const op = "memory.LeaseAliases"
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.aliasCount+int64(n) > math.MaxUint32 {
+		return 0, util.OpWrap(op, database.ErrIntOverflow)
+	}
+	start := db.aliasCount
+	db.aliasCount += int64(n)
+
+	return uint32(start), nil
+}
+
+// top returns the n values with the most clicks.
+func top(counts map[string]int64, n int) []types.ClickCount {
+	list := make([]types.ClickCount, 0, len(counts))
+	for value, clicks := range counts {
+		list = append(list, types.ClickCount{Value: value, Clicks: clicks})
+	}
+	slices.SortFunc(list, func(a, b types.ClickCount) int {
+		return cmp.Or(cmp.Compare(b.Clicks, a.Clicks), cmp.Compare(a.Value, b.Value))
+	})
+	return list[:min(n, len(list))]
+}
+
+func matches(url types.URL, filter types.URLFilter) bool {
+	if !strings.HasPrefix(url.Alias, filter.AliasPrefix) {
+		return false
+	}
+	if filter.Owner != "" && url.Owner != filter.Owner {
+		return false
+	}
+	if filter.Host == "" {
+		return true
+	}
+	u, err := neturl.Parse(url.Url)
+	return err == nil && strings.ToLower(u.Hostname()) == filter.Host
+}
+
+// sorted returns the urls ordered by id, db.mu must be held.
+func (db *DB) sorted() []types.URL {
+	urls := make([]types.URL, 0, len(db.urls))
+	for _, url := range db.urls {
+		urls = append(urls, url)
+	}
+	slices.SortFunc(urls, func(a, b types.URL) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return urls
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	first, err := db.CreateURL(ctx, types.NewURL{Alias: "first", Url: "https://first.com"})
+	require.NoError(t, err)
+	second, err := db.CreateURL(ctx, types.NewURL{Alias: "second", Url: "https://second.com"})
+	require.NoError(t, err)
+	_, err = db.DeleteURLByAlias(ctx, "second", "")
+	require.NoError(t, err)
+	_, err = db.LeaseAliases(ctx, 100)
+	require.NoError(t, err)
+	key, err := db.CreateAPIKey(ctx, "alice", "hash", false)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Close())
+
+	db, err = Open(path)
+	require.NoError(t, err)
+
+	list, err := db.ListURLs(ctx, types.ListURLsParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []types.URL{first}, list)
+
+	got, err := db.GetAPIKeyByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+	next, err := db.CreateAPIKey(ctx, "bob", "other", false)
+	require.NoError(t, err)
+	assert.Greater(t, next.ID, key.ID)
+
+	third, err := db.CreateURL(ctx, types.NewURL{Alias: "third", Url: "https://third.com"})
+	require.NoError(t, err)
+	assert.Greater(t, third.Id, second.Id, "ids of deleted urls are not reused")
+
+	start, err := db.LeaseAliases(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(100), start)
+}
+
+func TestWithoutSnapshot(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+
+	_, err = db.CreateURL(context.Background(), types.NewURL{Alias: "first", Url: "https://first.com"})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func TestBrokenSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err := Open(path)
+	require.Error(t, err)
+}
+
+func TestClicksCapped(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open("")
+	require.NoError(t, err)
+
+	clicks := make([]types.Click, maxClicks)
+	for i := range clicks {
+		clicks[i].URLID = 1
+	}
+	require.NoError(t, db.InsertClicks(ctx, clicks))
+	require.NoError(t, db.InsertClicks(ctx, []types.Click{{URLID: 2}, {URLID: 2}}))
+
+	count, err := db.CountClicks(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(maxClicks-2), count, "the oldest clicks are dropped")
+	count, err = db.CountClicks(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -4,13 +4,75 @@
 
 package database
 
+import (
+	"database/sql"
+)
+
+type ApiKey struct {
+	ID        int64
+	Name      string
+	KeyHash   string
+	Admin     int64
+	CreatedAt int64
+}
+
+type ArchivedUrl struct {
+	ID         int64
+	Alias      string
+	Url        string
+	Version    int64
+	CreatedAt  int64
+	UpdatedAt  int64
+	ExpiresAt  int64
+	MaxClicks  sql.NullInt64
+	UsedClicks int64
+	ArchivedAt int64
+	Owner      string
+}
+
+type Click struct {
+	ID           int64
+	UrlID        int64
+	Alias        string
+	ClickedAt    int64
+	Referrer     string
+	UserAgent    string
+	RemoteAddr   string
+	RequestID    string
+	Visitor      string
+	ReferrerHost string
+	Country      string
+	Device       string
+}
+
+type IdempotencyKey struct {
+	Owner          string
+	IdempotencyKey string
+	RequestHash    string
+	CreatedAt      int64
+	StatusCode     int64
+	Response       []byte
+}
+
+type RateLimit struct {
+	Bucket string
+	FullAt int64
+}
+
 type State struct {
 	ID         int64
 	AliasCount int64
 }
 
 type Url struct {
-	ID    int64
-	Alias string
-	Url   string
+	ID         int64
+	Alias      string
+	Url        string
+	Version    int64
+	CreatedAt  int64
+	UpdatedAt  int64
+	ExpiresAt  sql.NullInt64
+	MaxClicks  sql.NullInt64
+	UsedClicks int64
+	Owner      string
 }
@@ -0,0 +1,332 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+func URLtoTypes(dbURL Url) types.URL {
+	return types.URL{
+		Id:      dbURL.ID,
+		Alias:   dbURL.Alias,
+		Url:     dbURL.Url,
+		Version: dbURL.Version,
+
+		CreatedAt: dbURL.CreatedAt.UTC(),
+		UpdatedAt: dbURL.UpdatedAt.UTC(),
+
+		ExpiresAt:  fromNullTime(dbURL.ExpiresAt),
+		MaxClicks:  fromNullInt(dbURL.MaxClicks),
+		UsedClicks: dbURL.UsedClicks,
+
+		Owner: dbURL.Owner,
+	}
+}
+
+type DB struct {
+	conn *sql.DB
+	q    *Queries
+}
+
+func Create(conn *sql.DB) *DB {
+	return &DB{conn, New(conn)}
+}
+
+func (db *DB) CreateURL(ctx context.Context, newURL types.NewURL) (types.URL, error) {
+	const op = "postgres.CreateURL"
+
+	now := time.Now()
+	dbURL, err := db.q.CreateURL(ctx, CreateURLParams{
+		Alias:     newURL.Alias,
+		Url:       newURL.Url,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: toNullTime(newURL.ExpiresAt),
+		MaxClicks: toNullInt(newURL.MaxClicks),
+		Owner:     newURL.Owner,
+	})
+	if err != nil {
+		return types.URL{}, util.OpWrap(op, database.MapErr(err, Classify, nil, database.ErrAliasExists))
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// CreateURLs creates the urls in one transaction. Urls whose alias is
+// taken are skipped and left zero in the result. With atomic set a taken
+// alias rolls the whole batch back and fails with database.ErrAliasExists,
+// the result still tells which urls were skipped.
+func (db *DB) CreateURLs(ctx context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error) {
+	const op = "postgres.CreateURLs"
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	defer tx.Rollback()
+
+	q := db.q.WithTx(tx)
+	now := time.Now()
+	urls := make([]types.URL, len(newURLs))
+	skipped := false
+	for i, newURL := range newURLs {
+		dbURL, err := q.CreateURLIfAbsent(ctx, CreateURLIfAbsentParams{
+			Alias:     newURL.Alias,
+			Url:       newURL.Url,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: toNullTime(newURL.ExpiresAt),
+			MaxClicks: toNullInt(newURL.MaxClicks),
+			Owner:     newURL.Owner,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			skipped = true
+			continue
+		}
+		if err != nil {
+			return nil, util.OpWrap(op, database.MapErr(err, Classify, nil, database.ErrAliasExists))
+		}
+		urls[i] = URLtoTypes(dbURL)
+	}
+	if atomic && skipped {
+		return urls, util.OpWrap(op, database.ErrAliasExists)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return urls, nil
+}
+
+// ListURLs returns a page of the urls matching params.
+func (db *DB) ListURLs(ctx context.Context, params types.ListURLsParams) ([]types.URL, error) {
+	const op = "postgres.ListURLs"
+
+	var (
+		dbURLs []Url
+		err    error
+	)
+	if params.Desc {
+		before := params.After
+		if before == 0 {
+			before = math.MaxInt64
+		}
+		dbURLs, err = db.q.ListURLsDesc(ctx, ListURLsDescParams{
+			Before:      before,
+			AliasPrefix: params.AliasPrefix,
+			Host:        params.Host,
+			Owner:       params.Owner,
+			PageSize:    int32(params.Limit),
+		})
+	} else {
+		dbURLs, err = db.q.ListURLsAsc(ctx, ListURLsAscParams{
+			After:       params.After,
+			AliasPrefix: params.AliasPrefix,
+			Host:        params.Host,
+			Owner:       params.Owner,
+			PageSize:    int32(params.Limit),
+		})
+	}
+	if err != nil {
+		return nil, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	urls := make([]types.URL, 0, len(dbURLs))
+	for _, dbURL := range dbURLs {
+		urls = append(urls, URLtoTypes(dbURL))
+	}
+	return urls, nil
+}
+
+// CountURLs returns the number of urls matching filter.
+func (db *DB) CountURLs(ctx context.Context, filter types.URLFilter) (int64, error) {
+	const op = "postgres.CountURLs"
+
+	count, err := db.q.CountURLs(ctx, CountURLsParams{
+		AliasPrefix: filter.AliasPrefix,
+		Host:        filter.Host,
+		Owner:       filter.Owner,
+	})
+	if err != nil {
+		return 0, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	return count, nil
+}
+
+func (db *DB) GetURLByAlias(ctx context.Context, alias string) (types.URL, error) {
+	const op = "postgres.GetURLByAlias"
+
+	dbURL, err := db.q.GetURLByAlias(ctx, alias)
+	if err != nil {
+		return types.URL{}, util.OpWrap(op, database.MapErr(err, Classify, database.ErrURLUnfound, nil))
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// DeleteURLByAlias deletes the url of alias. With a non empty owner only
+// a url of that owner is deleted, others fail with database.ErrNotOwner.
+func (db *DB) DeleteURLByAlias(ctx context.Context, alias, owner string) (types.URL, error) {
+	const op = "postgres.DeleteURLByAlias"
+
+	dbURL, err := db.q.DeleteURLByAlias(ctx, DeleteURLByAliasParams{
+		Alias: alias,
+		Owner: owner,
+	})
+	if err != nil {
+		err = database.MapErr(err, Classify, database.ErrURLUnfound, nil)
+		if owner != "" && errors.Is(err, database.ErrURLUnfound) {
+			err = db.whyUnchanged(ctx, alias, owner, 0)
+		}
+		return types.URL{}, util.OpWrap(op, err)
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// UpdateURL sets the url of alias. With a non zero version the update is
+// applied only if the stored url is still of that version, with a non
+// empty owner only if it is of that owner.
+func (db *DB) UpdateURL(ctx context.Context, alias, url string, version int64, owner string) (types.URL, error) {
+	const op = "postgres.UpdateURL"
+
+	dbURL, err := db.q.UpdateURL(ctx, UpdateURLParams{
+		Url:       url,
+		UpdatedAt: time.Now(),
+		Alias:     alias,
+		Version:   version,
+		Owner:     owner,
+	})
+	if err != nil {
+		err = database.MapErr(err, Classify, database.ErrURLUnfound, nil)
+		if (version != 0 || owner != "") && errors.Is(err, database.ErrURLUnfound) {
+			err = db.whyUnchanged(ctx, alias, owner, version)
+		}
+		return types.URL{}, util.OpWrap(op, err)
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// whyUnchanged tells apart the reasons a conditional write of alias
+// changed nothing: the alias is unknown, of another owner or of another
+// version. The write itself is already done, so the url may have changed
+// since, the reason is only reported.
+func (db *DB) whyUnchanged(ctx context.Context, alias, owner string, version int64) error {
+	stored, err := db.q.GetURLByAlias(ctx, alias)
+	switch {
+	case err != nil:
+		return database.ErrURLUnfound
+	case owner != "" && stored.Owner != owner:
+		return database.ErrNotOwner
+	case version != 0 && stored.Version != version:
+		return database.ErrVersionMismatch
+	}
+	// Replaced in between by a url the write would have matched.
+	return database.ErrURLUnfound
+}
+
+// ConsumeClick counts a redirect against the click budget of alias. It
+// fails with database.ErrURLExpired when the url has no clicks left or is
+// expired.
+func (db *DB) ConsumeClick(ctx context.Context, alias string) (types.URL, error) {
+	const op = "postgres.ConsumeClick"
+
+	dbURL, err := db.q.ConsumeClick(ctx, ConsumeClickParams{
+		Now:   time.Now(),
+		Alias: alias,
+	})
+	if err != nil {
+		err = database.MapErr(err, Classify, database.ErrURLUnfound, nil)
+		if errors.Is(err, database.ErrURLUnfound) {
+			_, getErr := db.q.GetURLByAlias(ctx, alias)
+			if getErr == nil {
+				err = database.ErrURLExpired
+			}
+		}
+		return types.URL{}, util.OpWrap(op, err)
+	}
+
+	return URLtoTypes(dbURL), nil
+}
+
+// SweepExpiredURLs removes the urls expired before the given time, moving
+// them to the archive if asked to, and returns how many were removed.
+func (db *DB) SweepExpiredURLs(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	const op = "postgres.SweepExpiredURLs"
+
+	var (
+		n   int64
+		err error
+	)
+	cutoff := sql.NullTime{Time: before, Valid: true}
+	if archive {
+		n, err = db.q.ArchiveExpiredURLs(ctx, ArchiveExpiredURLsParams{
+			ArchivedAt: time.Now(),
+			Before:     cutoff,
+		})
+	} else {
+		n, err = db.q.DeleteExpiredURLs(ctx, cutoff)
+	}
+	if err != nil {
+		return 0, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	return n, nil
+}
+
+// LeaseAliases reserves n alias counter values and returns the first one.
+// The counter is advanced by a single UPDATE ... RETURNING, so concurrent
+// instances sharing the database always get disjoint ranges.
+func (db *DB) LeaseAliases(ctx context.Context, n uint32) (uint32, error) {
+	const op = "postgres.LeaseAliases"
+
+	aliasCount, err := db.q.LeaseAliases(ctx, int64(n))
+	if err != nil {
+		return 0, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	start := aliasCount - int64(n)
+	if start < 0 || aliasCount > math.MaxUint32 {
+		return 0, util.OpWrap(op, database.ErrIntOverflow)
+	}
+
+	return uint32(start), nil
+}
+
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func fromNullTime(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time.UTC()
+	return &t
+}
+
+func toNullInt(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
+
+func fromNullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
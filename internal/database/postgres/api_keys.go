@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+func (db *DB) CreateAPIKey(ctx context.Context, name, keyHash string, admin bool) (types.APIKey, error) {
+	const op = "postgres.CreateAPIKey"
+
+	key, err := db.q.CreateAPIKey(ctx, CreateAPIKeyParams{
+		Name:    name,
+		KeyHash: keyHash,
+		Admin:   admin,
+	})
+	if err != nil {
+		return types.APIKey{}, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	return apiKeyToTypes(key), nil
+}
+
+func (db *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (types.APIKey, error) {
+	const op = "postgres.GetAPIKeyByHash"
+
+	key, err := db.q.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		return types.APIKey{}, util.OpWrap(op, database.MapErr(err, Classify, database.ErrKeyUnfound, nil))
+	}
+
+	return apiKeyToTypes(key), nil
+}
+
+func apiKeyToTypes(key ApiKey) types.APIKey {
+	return types.APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Admin:     key.Admin,
+		CreatedAt: key.CreatedAt.UTC(),
+	}
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/5aradise/link-forge/internal/database"
+)
+
+// SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolation    = "23505"
+	queryCanceled      = "57014"
+	lockNotAvailable   = "55P03"
+	adminShutdown      = "57P01"
+	crashShutdown      = "57P02"
+	cannotConnectNow   = "57P03"
+	tooManyConnections = "53300"
+
+	connectionExceptionClass = "08"
+)
+
+// Classify recognizes the PostgreSQL errors by their SQLSTATE codes.
+func Classify(err error) database.ErrKind {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == uniqueViolation:
+			return database.KindUniqueViolation
+		case pgErr.Code == queryCanceled, pgErr.Code == lockNotAvailable:
+			return database.KindTimeout
+		case pgErr.Code == adminShutdown, pgErr.Code == crashShutdown,
+			pgErr.Code == cannotConnectNow, pgErr.Code == tooManyConnections,
+			strings.HasPrefix(pgErr.Code, connectionExceptionClass):
+			return database.KindUnavailable
+		}
+		return database.KindUnknown
+	}
+
+	if pgconn.Timeout(err) {
+		return database.KindTimeout
+	}
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return database.KindUnavailable
+	}
+	return database.KindUnknown
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// ClaimIdempotencyKey stores req unless a request with the same owner and
+// key, made after expiredBefore, is stored, or still in progress and made
+// after abandonedBefore. Then it returns that request and false, or fails
+// with database.ErrKeyReleased if the request was removed in between.
+func (db *DB) ClaimIdempotencyKey(ctx context.Context, req types.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (types.IdempotentRequest, bool, error) {
+	const op = "postgres.ClaimIdempotencyKey"
+
+	key, err := db.q.ClaimIdempotencyKey(ctx, ClaimIdempotencyKeyParams{
+		Owner:           req.Owner,
+		IdempotencyKey:  req.Key,
+		RequestHash:     req.RequestHash,
+		CreatedAt:       req.CreatedAt,
+		ExpiredBefore:   expiredBefore,
+		AbandonedBefore: abandonedBefore,
+	})
+	if err == nil {
+		return idempotencyKeyToTypes(key), true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return types.IdempotentRequest{}, false, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	key, err = db.q.GetIdempotencyKey(ctx, GetIdempotencyKeyParams{
+		Owner:          req.Owner,
+		IdempotencyKey: req.Key,
+	})
+	if err != nil {
+		return types.IdempotentRequest{}, false, util.OpWrap(op, database.MapErr(err, Classify, database.ErrKeyReleased, nil))
+	}
+	return idempotencyKeyToTypes(key), false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the claimed request. It
+// does nothing once the key is claimed by another request.
+func (db *DB) CompleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest, statusCode int, response []byte) error {
+	const op = "postgres.CompleteIdempotencyKey"
+
+	err := db.q.CompleteIdempotencyKey(ctx, CompleteIdempotencyKeyParams{
+		StatusCode:     int32(statusCode),
+		Response:       response,
+		Owner:          claim.Owner,
+		IdempotencyKey: claim.Key,
+		RequestHash:    claim.RequestHash,
+		CreatedAt:      claim.CreatedAt,
+	})
+	if err != nil {
+		return util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases the key of the claimed request, so the
+// request can be retried. It does nothing once the key is claimed by
+// another request.
+func (db *DB) DeleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest) error {
+	const op = "postgres.DeleteIdempotencyKey"
+
+	err := db.q.DeleteIdempotencyKey(ctx, DeleteIdempotencyKeyParams{
+		Owner:          claim.Owner,
+		IdempotencyKey: claim.Key,
+		RequestHash:    claim.RequestHash,
+		CreatedAt:      claim.CreatedAt,
+	})
+	if err != nil {
+		return util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the requests made before the given
+// time and returns how many were removed.
+func (db *DB) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	const op = "postgres.DeleteExpiredIdempotencyKeys"
+
+	n, err := db.q.DeleteExpiredIdempotencyKeys(ctx, before)
+	if err != nil {
+		return 0, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return n, nil
+}
+
+func idempotencyKeyToTypes(key IdempotencyKey) types.IdempotentRequest {
+	return types.IdempotentRequest{
+		Owner:       key.Owner,
+		Key:         key.IdempotencyKey,
+		RequestHash: key.RequestHash,
+		CreatedAt:   key.CreatedAt.UTC(),
+		StatusCode:  int(key.StatusCode),
+		Response:    key.Response,
+	}
+}
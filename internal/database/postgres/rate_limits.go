@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// TakeRateLimitToken takes a token from the bucket of key and returns the
+// time it is full again, false when no token is left.
+func (db *DB) TakeRateLimitToken(ctx context.Context, key string, now time.Time, interval, burst time.Duration) (time.Time, bool, error) {
+	const op = "postgres.TakeRateLimitToken"
+
+	full, err := db.q.TakeRateLimitToken(ctx, TakeRateLimitTokenParams{
+		Bucket:     key,
+		Now:        now,
+		IntervalMs: interval.Milliseconds(),
+		BurstMs:    burst.Milliseconds(),
+	})
+	if err == nil {
+		return full, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+
+	full, err = db.q.GetRateLimit(ctx, key)
+	if err != nil {
+		return time.Time{}, false, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return full, false, nil
+}
+
+// DeleteExpiredRateLimits removes the buckets full before the given time
+// and returns how many were removed.
+func (db *DB) DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	const op = "postgres.DeleteExpiredRateLimits"
+
+	n, err := db.q.DeleteExpiredRateLimits(ctx, before)
+	if err != nil {
+		return 0, util.OpWrap(op, database.MapErr(err, Classify, nil, nil))
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ClassifySQLite recognizes the errors of both SQLite drivers. The local
+// sqlite3 driver exposes the result codes. The libsql client drops the code
+// of the server errors and keeps the SQLite message only, which is not
+// localized, so its constraint prefix is matched instead.
+func ClassifySQLite(err error) ErrKind {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique,
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+			return KindUniqueViolation
+		case sqliteErr.Code == sqlite3.ErrBusy,
+			sqliteErr.Code == sqlite3.ErrLocked:
+			return KindTimeout
+		case sqliteErr.Code == sqlite3.ErrCantOpen,
+			sqliteErr.Code == sqlite3.ErrIoErr,
+			sqliteErr.Code == sqlite3.ErrFull:
+			return KindUnavailable
+		}
+		return KindUnknown
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"),
+		strings.Contains(msg, "SQLITE_CONSTRAINT_UNIQUE"),
+		strings.Contains(msg, "SQLITE_CONSTRAINT_PRIMARYKEY"):
+		return KindUniqueViolation
+	case strings.Contains(msg, "SQLITE_BUSY"):
+		return KindTimeout
+	}
+	return KindUnknown
+}
@@ -9,25 +9,16 @@ import (
 	"context"
 )
 
-const loadState = `-- name: LoadState :one
-SELECT alias_count FROM state
+const leaseAliases = `-- name: LeaseAliases :one
+UPDATE state
+SET alias_count = alias_count + ?
 WHERE id = 1
+RETURNING alias_count
 `
 
-func (q *Queries) LoadState(ctx context.Context) (int64, error) {
-	row := q.db.QueryRowContext(ctx, loadState)
+func (q *Queries) LeaseAliases(ctx context.Context, n int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, leaseAliases, n)
 	var alias_count int64
 	err := row.Scan(&alias_count)
 	return alias_count, err
 }
-
-const storeState = `-- name: StoreState :exec
-UPDATE state
-SET alias_count = ?
-WHERE id = 1
-`
-
-func (q *Queries) StoreState(ctx context.Context, aliasCount int64) error {
-	_, err := q.db.ExecContext(ctx, storeState, aliasCount)
-	return err
-}
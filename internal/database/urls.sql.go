@@ -7,58 +7,335 @@ package database
 
 import (
 	"context"
+	"database/sql"
 )
 
+const archiveExpiredURLs = `-- name: ArchiveExpiredURLs :exec
+INSERT INTO archived_urls (
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, archived_at
+)
+SELECT
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, ?
+FROM urls
+WHERE expires_at <= ?
+`
+
+type ArchiveExpiredURLsParams struct {
+	ArchivedAt int64
+	Before     sql.NullInt64
+}
+
+func (q *Queries) ArchiveExpiredURLs(ctx context.Context, arg ArchiveExpiredURLsParams) error {
+	_, err := q.db.ExecContext(ctx, archiveExpiredURLs, arg.ArchivedAt, arg.Before)
+	return err
+}
+
+const consumeClick = `-- name: ConsumeClick :one
+UPDATE urls
+SET used_clicks = used_clicks + 1,
+    expires_at = CASE WHEN used_clicks + 1 >= max_clicks THEN ? ELSE expires_at END
+WHERE alias = ?
+  AND max_clicks IS NOT NULL AND used_clicks < max_clicks
+  AND (expires_at IS NULL OR expires_at > ?)
+RETURNING id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner
+`
+
+type ConsumeClickParams struct {
+	Now   sql.NullInt64
+	Alias string
+}
+
+func (q *Queries) ConsumeClick(ctx context.Context, arg ConsumeClickParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, consumeClick, arg.Now, arg.Alias, arg.Now)
+	var i Url
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
+	return i, err
+}
+
+const countURLs = `-- name: CountURLs :one
+SELECT COUNT(*) FROM urls
+WHERE substr(alias, 1, length(?)) = ?
+  AND (CAST(? AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE ? || '/%')
+  AND (CAST(? AS TEXT) = '' OR owner = ?)
+`
+
+type CountURLsParams struct {
+	AliasPrefix string
+	Host        string
+	Owner       string
+}
+
+func (q *Queries) CountURLs(ctx context.Context, arg CountURLsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countURLs,
+		arg.AliasPrefix,
+		arg.AliasPrefix,
+		arg.Host,
+		arg.Host,
+		arg.Owner,
+		arg.Owner,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createURL = `-- name: CreateURL :one
-INSERT INTO urls (alias, url)
-VALUES (?, ?)
-RETURNING id, alias, url
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner
 `
 
 type CreateURLParams struct {
-	Alias string
-	Url   string
+	Alias     string
+	Url       string
+	CreatedAt int64
+	UpdatedAt int64
+	ExpiresAt sql.NullInt64
+	MaxClicks sql.NullInt64
+	Owner     string
 }
 
 func (q *Queries) CreateURL(ctx context.Context, arg CreateURLParams) (Url, error) {
-	row := q.db.QueryRowContext(ctx, createURL, arg.Alias, arg.Url)
+	row := q.db.QueryRowContext(ctx, createURL,
+		arg.Alias,
+		arg.Url,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.ExpiresAt,
+		arg.MaxClicks,
+		arg.Owner,
+	)
 	var i Url
-	err := row.Scan(&i.ID, &i.Alias, &i.Url)
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
 	return i, err
 }
 
+const createURLIfAbsent = `-- name: CreateURLIfAbsent :one
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (alias) DO NOTHING
+RETURNING id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner
+`
+
+type CreateURLIfAbsentParams struct {
+	Alias     string
+	Url       string
+	CreatedAt int64
+	UpdatedAt int64
+	ExpiresAt sql.NullInt64
+	MaxClicks sql.NullInt64
+	Owner     string
+}
+
+func (q *Queries) CreateURLIfAbsent(ctx context.Context, arg CreateURLIfAbsentParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, createURLIfAbsent,
+		arg.Alias,
+		arg.Url,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.ExpiresAt,
+		arg.MaxClicks,
+		arg.Owner,
+	)
+	var i Url
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
+	return i, err
+}
+
+const deleteExpiredURLs = `-- name: DeleteExpiredURLs :execrows
+DELETE FROM urls
+WHERE expires_at <= ?
+`
+
+func (q *Queries) DeleteExpiredURLs(ctx context.Context, before sql.NullInt64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredURLs, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteURLByAlias = `-- name: DeleteURLByAlias :one
 DELETE FROM urls
 WHERE alias = ?
-RETURNING id, alias, url
+  AND (CAST(? AS TEXT) = '' OR owner = ?)
+RETURNING id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner
 `
 
-func (q *Queries) DeleteURLByAlias(ctx context.Context, alias string) (Url, error) {
-	row := q.db.QueryRowContext(ctx, deleteURLByAlias, alias)
+type DeleteURLByAliasParams struct {
+	Alias string
+	Owner string
+}
+
+func (q *Queries) DeleteURLByAlias(ctx context.Context, arg DeleteURLByAliasParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, deleteURLByAlias, arg.Alias, arg.Owner, arg.Owner)
 	var i Url
-	err := row.Scan(&i.ID, &i.Alias, &i.Url)
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
 	return i, err
 }
 
 const getURLByAlias = `-- name: GetURLByAlias :one
-SELECT id, alias, url FROM urls
+SELECT id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner FROM urls
 WHERE alias = ?
 `
 
 func (q *Queries) GetURLByAlias(ctx context.Context, alias string) (Url, error) {
 	row := q.db.QueryRowContext(ctx, getURLByAlias, alias)
 	var i Url
-	err := row.Scan(&i.ID, &i.Alias, &i.Url)
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
 	return i, err
 }
 
-const listURLs = `-- name: ListURLs :many
-SELECT id, alias, url FROM urls
+const listURLsAsc = `-- name: ListURLsAsc :many
+SELECT id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner FROM urls
+WHERE id > ?
+  AND substr(alias, 1, length(?)) = ?
+  AND (CAST(? AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE ? || '/%')
+  AND (CAST(? AS TEXT) = '' OR owner = ?)
 ORDER BY id
+LIMIT ?
+`
+
+type ListURLsAscParams struct {
+	After       int64
+	AliasPrefix string
+	Host        string
+	Owner       string
+	PageSize    int64
+}
+
+func (q *Queries) ListURLsAsc(ctx context.Context, arg ListURLsAscParams) ([]Url, error) {
+	rows, err := q.db.QueryContext(ctx, listURLsAsc,
+		arg.After,
+		arg.AliasPrefix,
+		arg.AliasPrefix,
+		arg.Host,
+		arg.Host,
+		arg.Owner,
+		arg.Owner,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.ID,
+			&i.Alias,
+			&i.Url,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.MaxClicks,
+			&i.UsedClicks,
+			&i.Owner,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listURLsDesc = `-- name: ListURLsDesc :many
+SELECT id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner FROM urls
+WHERE id < ?
+  AND substr(alias, 1, length(?)) = ?
+  AND (CAST(? AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE ? || '/%')
+  AND (CAST(? AS TEXT) = '' OR owner = ?)
+ORDER BY id DESC
+LIMIT ?
 `
 
-func (q *Queries) ListURLs(ctx context.Context) ([]Url, error) {
-	rows, err := q.db.QueryContext(ctx, listURLs)
+type ListURLsDescParams struct {
+	Before      int64
+	AliasPrefix string
+	Host        string
+	Owner       string
+	PageSize    int64
+}
+
+func (q *Queries) ListURLsDesc(ctx context.Context, arg ListURLsDescParams) ([]Url, error) {
+	rows, err := q.db.QueryContext(ctx, listURLsDesc,
+		arg.Before,
+		arg.AliasPrefix,
+		arg.AliasPrefix,
+		arg.Host,
+		arg.Host,
+		arg.Owner,
+		arg.Owner,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -66,7 +343,18 @@ func (q *Queries) ListURLs(ctx context.Context) ([]Url, error) {
 	var items []Url
 	for rows.Next() {
 		var i Url
-		if err := rows.Scan(&i.ID, &i.Alias, &i.Url); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Alias,
+			&i.Url,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.MaxClicks,
+			&i.UsedClicks,
+			&i.Owner,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -79,3 +367,46 @@ func (q *Queries) ListURLs(ctx context.Context) ([]Url, error) {
 	}
 	return items, nil
 }
+
+const updateURL = `-- name: UpdateURL :one
+UPDATE urls
+SET url = ?, version = version + 1, updated_at = ?
+WHERE alias = ?
+  AND (CAST(? AS INTEGER) = 0 OR version = ?)
+  AND (CAST(? AS TEXT) = '' OR owner = ?)
+RETURNING id, alias, url, version, created_at, updated_at, expires_at, max_clicks, used_clicks, owner
+`
+
+type UpdateURLParams struct {
+	Url       string
+	UpdatedAt int64
+	Alias     string
+	Version   int64
+	Owner     string
+}
+
+func (q *Queries) UpdateURL(ctx context.Context, arg UpdateURLParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, updateURL,
+		arg.Url,
+		arg.UpdatedAt,
+		arg.Alias,
+		arg.Version,
+		arg.Version,
+		arg.Owner,
+		arg.Owner,
+	)
+	var i Url
+	err := row.Scan(
+		&i.ID,
+		&i.Alias,
+		&i.Url,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.MaxClicks,
+		&i.UsedClicks,
+		&i.Owner,
+	)
+	return i, err
+}
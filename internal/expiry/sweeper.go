@@ -0,0 +1,84 @@
+// Package expiry removes expired urls from the storage in the background.
+package expiry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+// Storage removes the urls expired before the given time, moving them to
+// the archive if asked to, and returns how many were removed.
+type Storage interface {
+	SweepExpiredURLs(ctx context.Context, before time.Time, archive bool) (int64, error)
+}
+
+// Sweeper removes urls expired for longer than the retention, so their
+// aliases answer 410 Gone for a while before becoming unknown and free.
+type Sweeper struct {
+	l         *slog.Logger
+	storage   Storage
+	interval  time.Duration
+	retention time.Duration
+	archive   bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewSweeper(l *slog.Logger, storage Storage, interval, retention time.Duration, archive bool) *Sweeper {
+	return &Sweeper{
+		l:         l.With(slog.String("op", "expiry.sweeper")),
+		storage:   storage,
+		interval:  interval,
+		retention: retention,
+		archive:   archive,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start sweeps every interval in the background until Stop is called.
+func (s *Sweeper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := s.Sweep(ctx)
+				if err != nil && ctx.Err() == nil {
+					s.l.Error("failed to sweep expired urls", util.SlErr(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop cancels a running sweep and waits for the background loop to exit.
+func (s *Sweeper) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Sweep removes the urls expired for longer than the retention once.
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	const op = "expiry.Sweep"
+
+	n, err := s.storage.SweepExpiredURLs(ctx, time.Now().Add(-s.retention), s.archive)
+	if err != nil {
+		return 0, util.OpWrap(op, err)
+	}
+	if n > 0 {
+		s.l.Info("expired urls swept", slog.Int64("count", n), slog.Bool("archived", s.archive))
+	}
+	return n, nil
+}
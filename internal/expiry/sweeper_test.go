@@ -0,0 +1,43 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/database/memory"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+func TestSweeper(t *testing.T) {
+	ctx := context.Background()
+	db, err := memory.Open("")
+	require.NoError(t, err)
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+	for alias, expiresAt := range map[string]*time.Time{"old": &old, "recent": &recent, "forever": nil} {
+		_, err := db.CreateURL(ctx, types.NewURL{Alias: alias, Url: "https://example.com", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+	}
+
+	s := NewSweeper(logger.NewMock(), db, time.Millisecond, time.Hour, false)
+	s.Start()
+	require.Eventually(t, func() bool {
+		_, err := db.GetURLByAlias(ctx, "old")
+		return err != nil
+	}, time.Second, time.Millisecond)
+	s.Stop()
+
+	_, err = db.GetURLByAlias(ctx, "old")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+	for _, alias := range []string{"recent", "forever"} {
+		_, err = db.GetURLByAlias(ctx, alias)
+		assert.NoError(t, err, alias)
+	}
+}
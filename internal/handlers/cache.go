@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+type CacheStatsResponse[T any] struct {
+	api.Response
+	Cache T `json:"cache"`
+}
+
+// CacheStats reports the counters of a cache to admins. It takes the stats
+// getter instead of the cache so the caches can depend on the handlers
+// packages.
+func CacheStats[T any](l *slog.Logger, stats func() T) http.HandlerFunc {
+	const op = "handlers.cacheStats"
+	l = l.With(
+		slog.String("op", op),
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := l.With(
+			slog.String("request_id", middleware.GetRequestID(r)),
+		)
+
+		p, ok := middleware.GetPrincipal(r)
+		if !ok {
+			l.Info("anonymous request")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="link-forge"`)
+			WriteJSONLog(w, http.StatusUnauthorized, api.ResError("authentication required"), l)
+			return
+		}
+		if !p.Admin {
+			l.Info("not an admin", slog.String("principal", p.Name))
+			WriteJSONLog(w, http.StatusForbidden, api.ResError("admin api key required"), l)
+			return
+		}
+
+		WriteJSONLog(w, http.StatusOK, CacheStatsResponse[T]{
+			api.ResOK(),
+			stats(),
+		}, l)
+	}
+}
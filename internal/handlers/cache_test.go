@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+func TestCacheStats(t *testing.T) {
+	cases := []struct {
+		name      string
+		principal *middleware.Principal
+		code      int
+		body      string
+	}{
+		{
+			name: "anonymous",
+			code: http.StatusUnauthorized,
+			body: `{"status":"Error","error":"authentication required"}`,
+		},
+		{
+			name:      "not_admin",
+			principal: &middleware.Principal{Name: "alice"},
+			code:      http.StatusForbidden,
+			body:      `{"status":"Error","error":"admin api key required"}`,
+		},
+		{
+			name:      "admin",
+			principal: &middleware.Principal{Name: "admin", Admin: true},
+			code:      http.StatusOK,
+			body:      `{"status":"OK","cache":{"hits":3}}`,
+		},
+	}
+
+	h := CacheStats(logger.NewMock(), func() map[string]int { return map[string]int{"hits": 3} })
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/cache", nil)
+			if tc.principal != nil {
+				r = r.WithContext(middleware.WithPrincipal(r.Context(), *tc.principal))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.code, w.Code)
+			assert.JSONEq(t, tc.body, w.Body.String())
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/5aradise/link-forge/internal/database"
 	"github.com/5aradise/link-forge/internal/util"
 	"github.com/5aradise/link-forge/pkg/api"
 )
@@ -14,3 +16,19 @@ func WriteJSONLog(w http.ResponseWriter, statusCode int, v any, l *slog.Logger)
 		l.Error("failed to write response", util.SlErr(err))
 	}
 }
+
+// IsUnavailable reports whether err is caused by a database that is down
+// or too slow to answer, so the request may succeed when retried.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, database.ErrTimeout) || errors.Is(err, database.ErrUnavailable)
+}
+
+// WriteStorageErrorLog writes 503 for the storage errors IsUnavailable
+// reports, and 500 with msg for the rest.
+func WriteStorageErrorLog(w http.ResponseWriter, err error, msg string, l *slog.Logger) {
+	if IsUnavailable(err) {
+		WriteJSONLog(w, http.StatusServiceUnavailable, api.ResError("storage unavailable"), l)
+		return
+	}
+	WriteJSONLog(w, http.StatusInternalServerError, api.ResError(msg), l)
+}
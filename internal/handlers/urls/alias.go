@@ -1,51 +1,169 @@
 package urls
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
-	"math"
-	"sync/atomic"
+	"math/big"
+	"sync"
 )
 
+const maxGenerateAttempts = 5
+
 const (
-	seq         = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789()@:%_+.~#&="
-	seqLen      = uint32(len(seq))
-	maxAliasLen = 5
+	StrategySequential = "sequential"
+	StrategyRandom     = "random"
+	StrategyObfuscated = "obfuscated"
 )
 
 var (
-	maxCount                 = uint32(math.Pow(float64(seqLen), maxAliasLen))
-	ErrMaxAliasCountEexceeds = fmt.Errorf("alias count exceeds the maximum permissible value: %d", maxCount)
+	ErrMaxAliasCountEexceeds = errors.New("alias count exceeds the maximum permissible value")
+	ErrInvalidLeaseSize      = errors.New("alias lease size must be in range [1, max alias count]")
+	ErrEmptySalt             = errors.New("alias salt is required for obfuscated strategy")
+	ErrUnknownStrategy       = fmt.Errorf("unknown alias strategy, expected one of: %s, %s, %s", StrategySequential, StrategyRandom, StrategyObfuscated)
 )
 
-type aliasService struct {
-	count *atomic.Uint32
+// NewAliasGenerator creates the generator of the given strategy. Salt is
+// used by the obfuscated strategy only.
+func NewAliasGenerator(strategy string, ab *Alphabet, storage AliasStorage, leaseSize uint32, salt string) (AliasGenerator, error) {
+	switch strategy {
+	case StrategySequential:
+		return NewSequentialGenerator(ab, storage, leaseSize)
+	case StrategyRandom:
+		return NewRandomGenerator(ab), nil
+	case StrategyObfuscated:
+		return NewObfuscatedGenerator(ab, storage, leaseSize, salt)
+	default:
+		return nil, ErrUnknownStrategy
+	}
+}
+
+// aliasCounter hands out counter values from blocks leased from the storage.
+// The counter is persisted before any value of the block is used, so a crash
+// only wastes the rest of the block and never reuses it, and every instance
+// sharing the storage leases its own disjoint block.
+type aliasCounter struct {
+	storage   AliasStorage
+	leaseSize uint32
+	maxCount  uint32
+
+	mu   sync.Mutex
+	next uint32
+	end  uint32
 }
 
-func newAliasService(currAliasCount uint32) (aliasService, error) {
-	if currAliasCount >= maxCount {
-		return aliasService{}, ErrMaxAliasCountEexceeds
+func newAliasCounter(storage AliasStorage, leaseSize, maxCount uint32) (*aliasCounter, error) {
+	if leaseSize == 0 || leaseSize > maxCount {
+		return nil, ErrInvalidLeaseSize
 	}
-	count := &atomic.Uint32{}
-	count.Store(currAliasCount)
-	return aliasService{count}, nil
+	return &aliasCounter{
+		storage:   storage,
+		leaseSize: leaseSize,
+		maxCount:  maxCount,
+	}, nil
 }
 
-func (s *aliasService) nextAlias() (string, error) {
-	currAlias := s.count.Add(1) - 1
-	if currAlias >= maxCount {
-		return "", ErrMaxAliasCountEexceeds
+func (c *aliasCounter) nextValue(ctx context.Context) (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next == c.end {
+		start, err := c.storage.LeaseAliases(ctx, c.leaseSize)
+		if err != nil {
+			return 0, err
+		}
+		c.next, c.end = start, start+c.leaseSize
+	}
+
+	if c.next >= c.maxCount {
+		return 0, fmt.Errorf("%w: %d", ErrMaxAliasCountEexceeds, c.maxCount)
 	}
+	curr := c.next
+	c.next++
 
-	return getAlias(currAlias), nil
+	return curr, nil
+}
+
+// sequentialGenerator encodes the counter as is, so aliases go a, b, c, ...
+type sequentialGenerator struct {
+	ab      *Alphabet
+	counter *aliasCounter
+}
+
+func NewSequentialGenerator(ab *Alphabet, storage AliasStorage, leaseSize uint32) (AliasGenerator, error) {
+	counter, err := newAliasCounter(storage, leaseSize, ab.MaxCount())
+	if err != nil {
+		return nil, err
+	}
+	return &sequentialGenerator{ab, counter}, nil
+}
+
+func (g *sequentialGenerator) NextAlias(ctx context.Context) (string, error) {
+	i, err := g.counter.nextValue(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.ab.encode(i), nil
+}
+
+func (g *sequentialGenerator) MaxLen() int {
+	return g.ab.MaxLen()
+}
+
+// randomGenerator picks aliases uniformly from the whole alias space.
+// It keeps no state, collisions are left to the storage unique constraint.
+type randomGenerator struct {
+	ab *Alphabet
+}
+
+func NewRandomGenerator(ab *Alphabet) AliasGenerator {
+	return randomGenerator{ab}
+}
+
+func (g randomGenerator) NextAlias(_ context.Context) (string, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(g.ab.MaxCount())))
+	if err != nil {
+		return "", err
+	}
+	return g.ab.encode(uint32(i.Uint64())), nil
+}
+
+func (g randomGenerator) MaxLen() int {
+	return g.ab.MaxLen()
+}
+
+// obfuscatedGenerator encodes the counter after a keyed permutation of the
+// alias space, so consecutive aliases can't be guessed without the salt.
+type obfuscatedGenerator struct {
+	ab      *Alphabet
+	counter *aliasCounter
+	perm    *permutation
+}
+
+func NewObfuscatedGenerator(ab *Alphabet, storage AliasStorage, leaseSize uint32, salt string) (AliasGenerator, error) {
+	if salt == "" {
+		return nil, ErrEmptySalt
+	}
+	counter, err := newAliasCounter(storage, leaseSize, ab.MaxCount())
+	if err != nil {
+		return nil, err
+	}
+	return &obfuscatedGenerator{
+		ab:      ab,
+		counter: counter,
+		perm:    newPermutation(ab.MaxCount(), salt),
+	}, nil
 }
 
-func getAlias(i uint32) string {
-	if i < seqLen {
-		return string(seq[i])
+func (g *obfuscatedGenerator) NextAlias(ctx context.Context) (string, error) {
+	i, err := g.counter.nextValue(ctx)
+	if err != nil {
+		return "", err
 	}
-	return getAlias(i/seqLen-1) + string(seq[i%seqLen])
+	return g.ab.encode(g.perm.apply(i)), nil
 }
 
-func (s *aliasService) loadCount() uint32 {
-	return s.count.Load()
+func (g *obfuscatedGenerator) MaxLen() int {
+	return g.ab.MaxLen()
 }
@@ -0,0 +1,188 @@
+package urls
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const leaseSize = 100
+
+var testAlphabet, _ = NewAlphabet(DefaultAlphabet, false)
+
+// counterStorage keeps the alias counter the way a database does: it
+// outlives every aliasService that leases from it.
+type counterStorage struct {
+	mu    sync.Mutex
+	count uint32
+}
+
+func (s *counterStorage) LeaseAliases(_ context.Context, n uint32) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := s.count
+	s.count += n
+	return start, nil
+}
+
+func TestSequentialGeneratorCrash(t *testing.T) {
+	storage := &counterStorage{}
+	seen := make(map[string]int)
+
+	// Every run is a process that generates some aliases and is killed
+	// without any shutdown hook, in the middle of a leased block or exactly
+	// at its end.
+	runs := []int{1, leaseSize / 2, leaseSize, leaseSize + 3, 7}
+	for run, n := range runs {
+		gen, err := NewSequentialGenerator(testAlphabet, storage, leaseSize)
+		require.NoError(t, err)
+		for range n {
+			alias, err := gen.NextAlias(context.Background())
+			require.NoError(t, err)
+
+			prev, ok := seen[alias]
+			require.False(t, ok, "alias %q of run %d collides with run %d", alias, run, prev)
+			seen[alias] = run
+		}
+	}
+}
+
+func TestSequentialGeneratorConcurrent(t *testing.T) {
+	const (
+		workers = 8
+		perWork = leaseSize * 3
+	)
+
+	gen, err := NewSequentialGenerator(testAlphabet, &counterStorage{}, leaseSize)
+	require.NoError(t, err)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]struct{}, workers*perWork)
+		wg   sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWork {
+				alias, err := gen.NextAlias(context.Background())
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				mu.Lock()
+				seen[alias] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, seen, workers*perWork)
+}
+
+func TestSequentialGeneratorReplicas(t *testing.T) {
+	storage := &counterStorage{}
+
+	replicas := make([]AliasGenerator, 3)
+	for i := range replicas {
+		gen, err := NewSequentialGenerator(testAlphabet, storage, leaseSize)
+		require.NoError(t, err)
+		replicas[i] = gen
+	}
+
+	// Replicas take turns, so each of them runs through several blocks while
+	// the others hold theirs.
+	seen := make(map[string]int)
+	for i := range leaseSize * 5 {
+		replica := i % len(replicas)
+		alias, err := replicas[replica].NextAlias(context.Background())
+		require.NoError(t, err)
+
+		prev, ok := seen[alias]
+		require.False(t, ok, "alias %q of replica %d collides with replica %d", alias, replica, prev)
+		seen[alias] = replica
+	}
+}
+
+func TestSequentialGeneratorLeaseSize(t *testing.T) {
+	_, err := NewSequentialGenerator(testAlphabet, &counterStorage{}, 0)
+	require.ErrorIs(t, err, ErrInvalidLeaseSize)
+
+	_, err = NewSequentialGenerator(testAlphabet, &counterStorage{}, testAlphabet.MaxCount()+1)
+	require.ErrorIs(t, err, ErrInvalidLeaseSize)
+}
+
+func TestSequentialGeneratorExceeds(t *testing.T) {
+	gen, err := NewSequentialGenerator(testAlphabet, &counterStorage{count: testAlphabet.MaxCount() - 1}, leaseSize)
+	require.NoError(t, err)
+
+	_, err = gen.NextAlias(context.Background())
+	require.NoError(t, err)
+
+	_, err = gen.NextAlias(context.Background())
+	require.ErrorIs(t, err, ErrMaxAliasCountEexceeds)
+}
+
+func TestRandomGenerator(t *testing.T) {
+	gen := NewRandomGenerator(testAlphabet)
+
+	for range 1000 {
+		alias, err := gen.NextAlias(context.Background())
+		require.NoError(t, err)
+		require.NotEmpty(t, alias)
+		require.LessOrEqual(t, len(alias), testAlphabet.MaxLen())
+	}
+}
+
+func TestObfuscatedGenerator(t *testing.T) {
+	_, err := NewObfuscatedGenerator(testAlphabet, &counterStorage{}, leaseSize, "")
+	require.ErrorIs(t, err, ErrEmptySalt)
+
+	storage := &counterStorage{}
+	seen := make(map[string]struct{})
+	for range 3 {
+		gen, err := NewObfuscatedGenerator(testAlphabet, storage, leaseSize, "salt")
+		require.NoError(t, err)
+
+		for range leaseSize / 2 {
+			alias, err := gen.NextAlias(context.Background())
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(alias), testAlphabet.MaxLen())
+
+			_, ok := seen[alias]
+			require.False(t, ok, "alias %q collides", alias)
+			seen[alias] = struct{}{}
+		}
+	}
+
+	first := func(salt string) string {
+		gen, err := NewObfuscatedGenerator(testAlphabet, &counterStorage{}, leaseSize, salt)
+		require.NoError(t, err)
+		alias, err := gen.NextAlias(context.Background())
+		require.NoError(t, err)
+		return alias
+	}
+	assert.Equal(t, first("salt"), first("salt"))
+	assert.NotEqual(t, first("salt"), first("pepper"))
+	assert.NotEqual(t, testAlphabet.encode(0), first("salt"))
+}
+
+func TestPermutation(t *testing.T) {
+	for _, n := range []uint32{1, 2, 3, 74, 1000, 4096} {
+		p := newPermutation(n, "salt")
+
+		seen := make([]bool, n)
+		for i := range n {
+			v := p.apply(i)
+			require.Less(t, v, n)
+			require.False(t, seen[v], "n=%d: %d is hit twice", n, v)
+			seen[v] = true
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package urls
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet holds the unreserved URI characters except "." and "~",
+	// so aliases survive browsers, chats and linkifiers without encoding.
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+	// lookalikes are the characters easily confused with each other.
+	lookalikes = "0O1lI"
+)
+
+var ErrInvalidAlphabet = errors.New("invalid alias alphabet")
+
+// Alphabet is the set of characters generated aliases are made of.
+// The alias space is limited to what fits into the uint32 counter.
+type Alphabet struct {
+	chars    string
+	maxLen   int
+	maxCount uint32
+}
+
+// NewAlphabet validates chars and derives the alias space from them.
+// Only unreserved URI characters are allowed, so any alias generated from
+// the alphabet is a valid path segment as is.
+func NewAlphabet(chars string, noLookalikes bool) (*Alphabet, error) {
+	if noLookalikes {
+		chars = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(lookalikes, r) {
+				return -1
+			}
+			return r
+		}, chars)
+	}
+
+	if len(chars) < 2 {
+		return nil, fmt.Errorf("%w: at least 2 characters required", ErrInvalidAlphabet)
+	}
+	for i, r := range chars {
+		if !isUnreserved(r) {
+			return nil, fmt.Errorf("%w: %q is not url safe", ErrInvalidAlphabet, r)
+		}
+		if strings.ContainsRune(chars[:i], r) {
+			return nil, fmt.Errorf("%w: %q is repeated", ErrInvalidAlphabet, r)
+		}
+	}
+
+	base := uint64(len(chars))
+	maxLen := 0
+	count := uint64(1)
+	for count*base <= math.MaxUint32 {
+		count *= base
+		maxLen++
+	}
+
+	return &Alphabet{
+		chars:    chars,
+		maxLen:   maxLen,
+		maxCount: uint32(count),
+	}, nil
+}
+
+func (a *Alphabet) String() string {
+	return a.chars
+}
+
+// MaxLen is the length of the longest alias in the alias space.
+func (a *Alphabet) MaxLen() int {
+	return a.maxLen
+}
+
+// MaxCount is the size of the alias space.
+func (a *Alphabet) MaxCount() uint32 {
+	return a.maxCount
+}
+
+// encode maps i to its alias in bijective base-n numeration, so every
+// alias in the space is reached exactly once: a, b, ..., aa, ab, ...
+func (a *Alphabet) encode(i uint32) string {
+	base := uint32(len(a.chars))
+
+	var buf [32]byte
+	pos := len(buf)
+	for {
+		pos--
+		buf[pos] = a.chars[i%base]
+		if i < base {
+			break
+		}
+		i = i/base - 1
+	}
+	return string(buf[pos:])
+}
+
+func isUnreserved(r rune) bool {
+	return 'a' <= r && r <= 'z' ||
+		'A' <= r && r <= 'Z' ||
+		'0' <= r && r <= '9' ||
+		r == '-' || r == '.' || r == '_' || r == '~'
+}
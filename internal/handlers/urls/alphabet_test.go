@@ -0,0 +1,97 @@
+package urls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAlphabet(t *testing.T) {
+	cases := []struct {
+		name         string
+		chars        string
+		noLookalikes bool
+		want         string
+		maxLen       int
+		maxCount     uint32
+		err          bool
+	}{
+		{
+			name:     "Default",
+			chars:    DefaultAlphabet,
+			want:     DefaultAlphabet,
+			maxLen:   5,
+			maxCount: 1 << 30,
+		},
+		{
+			name:         "No_lookalikes",
+			chars:        DefaultAlphabet,
+			noLookalikes: true,
+			want:         "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789-_",
+			maxLen:       5,
+			maxCount:     59 * 59 * 59 * 59 * 59,
+		},
+		{
+			name:     "Binary",
+			chars:    "01",
+			want:     "01",
+			maxLen:   31,
+			maxCount: 1 << 31,
+		},
+		{
+			name:  "Unsafe",
+			chars: "abc#",
+			err:   true,
+		},
+		{
+			name:  "Percent",
+			chars: "abc%",
+			err:   true,
+		},
+		{
+			name:  "Repeated",
+			chars: "abca",
+			err:   true,
+		},
+		{
+			name:  "Too_short",
+			chars: "a",
+			err:   true,
+		},
+		{
+			name:         "Too_short_without_lookalikes",
+			chars:        "0Oa",
+			noLookalikes: true,
+			err:          true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ab, err := NewAlphabet(tc.chars, tc.noLookalikes)
+			if tc.err {
+				require.ErrorIs(t, err, ErrInvalidAlphabet)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, ab.String())
+			assert.Equal(t, tc.maxLen, ab.MaxLen())
+			assert.Equal(t, tc.maxCount, ab.MaxCount())
+		})
+	}
+}
+
+func TestAlphabetEncode(t *testing.T) {
+	ab, err := NewAlphabet("abc", false)
+	require.NoError(t, err)
+
+	want := []string{"a", "b", "c", "aa", "ab", "ac", "ba", "bb", "bc", "ca", "cb", "cc", "aaa"}
+	for i, alias := range want {
+		assert.Equal(t, alias, ab.encode(uint32(i)))
+	}
+
+	last := ab.encode(ab.MaxCount() - 1)
+	assert.LessOrEqual(t, len(last), ab.MaxLen())
+}
@@ -0,0 +1,249 @@
+package urls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+const (
+	maxBatchSize = 1000
+	// batchResolvers is the number of redirects of a batch followed at
+	// once.
+	batchResolvers = 8
+
+	BatchAllOrNothing = "all_or_nothing"
+	BatchBestEffort   = "best_effort"
+
+	msgBatchFailed = "not created, another url of the batch failed"
+)
+
+// batchResolveTimeout bounds the time spent following the redirects of a
+// batch.
+var batchResolveTimeout = 10 * time.Second
+
+type BatchCreateURLsResponse struct {
+	api.Response
+	// Results are in the order of the request, one per url.
+	Results []CreateURLResponse `json:"results,omitempty"`
+}
+
+// BatchCreateURLs creates the urls of an array of CreateURLRequest in one
+// transaction. The mode query parameter is all_or_nothing (the default),
+// where a failing url fails the batch, or best_effort, where the others
+// are created anyway and the answer is 207 Multi-Status.
+func (s *URLService) BatchCreateURLs(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.batch"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = BatchAllOrNothing
+	}
+	if mode != BatchAllOrNothing && mode != BatchBestEffort {
+		l.Info("invalid request", slog.String("mode", mode))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError("mode must be all_or_nothing or best_effort"), l)
+		return
+	}
+	atomic := mode == BatchAllOrNothing
+
+	var reqs []CreateURLRequest
+	if err := api.DecodeJSON(r, &reqs); err != nil {
+		errMsg := "failed to decode request body"
+		l.Error(errMsg, util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		errMsg := fmt.Sprintf("batch must have between 1 and %d urls", maxBatchSize)
+		l.Info("invalid request", slog.Int("size", len(reqs)))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+		return
+	}
+
+	l.Info("request body decoded", slog.Int("size", len(reqs)), slog.String("mode", mode))
+
+	results := make([]CreateURLResponse, len(reqs))
+	newURLs := make([]types.NewURL, len(reqs))
+	finalURLs := make([]string, len(reqs))
+	generated := make([]bool, len(reqs))
+	// pending are the indexes of the urls left to insert.
+	pending := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		newURLs[i] = types.NewURL{
+			Alias:     req.Alias,
+			Url:       req.URL,
+			ExpiresAt: req.ExpiresAt,
+			MaxClicks: req.MaxClicks,
+			Owner:     p.Name,
+		}
+		err := s.validate(&newURLs[i], false)
+		if err != nil {
+			results[i], _ = invalidURLResponse(err)
+			continue
+		}
+		generated[i] = req.Alias == ""
+		pending = append(pending, i)
+	}
+	// Redirects are followed once the urls are otherwise valid, unless the
+	// batch already failed.
+	if !atomic || len(pending) == len(reqs) {
+		pending = s.followBatch(r.Context(), l, newURLs, pending, finalURLs, results)
+	}
+	if atomic && len(pending) < len(reqs) {
+		failBatch(results, pending)
+		l.Info("invalid urls in batch", slog.Int("invalid", len(reqs)-len(pending)))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, BatchCreateURLsResponse{api.ResError("batch has invalid urls"), results}, l)
+		return
+	}
+
+	// Aliases are generated for the pending urls without one, on retries
+	// only for the ones whose generated alias turned out taken.
+	regenerate := pending
+	for attempt := 1; len(pending) > 0; attempt++ {
+		for _, i := range regenerate {
+			if !generated[i] {
+				continue
+			}
+			alias, err := s.gen.NextAlias(r.Context())
+			if err != nil {
+				l.Error("failed to generate alias", util.SlErr(err))
+				handlers.WriteStorageErrorLog(w, err, ErrGenerateAlias.Error(), l)
+				return
+			}
+			newURLs[i].Alias = alias
+		}
+
+		batch := make([]types.NewURL, len(pending))
+		for j, i := range pending {
+			batch[j] = newURLs[i]
+		}
+		urls, err := s.db.CreateURLs(r.Context(), batch, atomic)
+		if err != nil && !(atomic && errors.Is(err, database.ErrAliasExists)) {
+			l.Error("failed to add urls", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to add urls", l)
+			return
+		}
+
+		regenerate = nil
+		taken := false
+		for j, i := range pending {
+			if urls[j].Id == 0 {
+				if generated[i] {
+					l.Info("generated alias already exists", slog.String("alias", newURLs[i].Alias))
+					regenerate = append(regenerate, i)
+				} else {
+					results[i] = CreateURLResponse{Response: api.ResError(msgAliasExists)}
+					taken = true
+				}
+				continue
+			}
+			if err == nil {
+				results[i] = CreateURLResponse{Response: api.ResOK(), Alias: urls[j].Alias, FinalURL: finalURLs[i]}
+			}
+		}
+
+		if atomic && taken {
+			failBatch(results, pending)
+			l.Info("alias of batch already exists")
+			handlers.WriteJSONLog(w, http.StatusBadRequest, BatchCreateURLsResponse{api.ResError(msgAliasExists), results}, l)
+			return
+		}
+		if !atomic {
+			pending = regenerate
+		}
+		if len(regenerate) == 0 {
+			break
+		}
+		if attempt == maxGenerateAttempts {
+			if atomic {
+				l.Error("failed to generate alias", slog.Int("attempts", attempt))
+				handlers.WriteJSONLog(w, http.StatusInternalServerError, api.ResError(ErrGenerateAlias.Error()), l)
+				return
+			}
+			for _, i := range regenerate {
+				results[i] = CreateURLResponse{Response: api.ResError(ErrGenerateAlias.Error())}
+			}
+			break
+		}
+	}
+
+	created := 0
+	for _, res := range results {
+		if res.Status == api.StatusOK {
+			created++
+		}
+	}
+
+	l.Info("urls added", slog.Int("created", created), slog.Int("failed", len(results)-created))
+
+	code := http.StatusCreated
+	if created < len(results) {
+		code = http.StatusMultiStatus
+	}
+	handlers.WriteJSONLog(w, code, BatchCreateURLsResponse{api.ResOK(), results}, l)
+}
+
+// failBatch marks the urls that did not fail themselves as not created.
+func failBatch(results []CreateURLResponse, pending []int) {
+	for _, i := range pending {
+		if results[i].Status == "" || results[i].Status == api.StatusOK {
+			results[i] = CreateURLResponse{Response: api.ResError(msgBatchFailed)}
+		}
+	}
+}
+
+// followBatch follows the redirects of the pending urls like follow,
+// batchResolvers at once and all of them within batchResolveTimeout. It
+// fills in finalURLs and the results of the urls failing, and returns the
+// pending urls left. Urls not resolved in time are let through like
+// unreachable ones.
+func (s *URLService) followBatch(ctx context.Context, l *slog.Logger, newURLs []types.NewURL, pending []int, finalURLs []string, results []CreateURLResponse) []int {
+	if s.res == nil {
+		return pending
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, batchResolveTimeout)
+	defer cancel()
+	errs := make([]error, len(newURLs))
+	var g errgroup.Group
+	g.SetLimit(batchResolvers)
+	for _, i := range pending {
+		g.Go(func() error {
+			finalURLs[i], errs[i] = s.follow(ctx, l, newURLs[i].Url)
+			return nil
+		})
+	}
+	g.Wait()
+
+	left := make([]int, 0, len(pending))
+	for _, i := range pending {
+		if errs[i] != nil {
+			results[i], _ = invalidURLResponse(errs[i])
+			continue
+		}
+		left = append(left, i)
+	}
+	return left
+}
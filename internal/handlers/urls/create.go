@@ -1,12 +1,18 @@
 package urls
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/5aradise/link-forge/internal/database"
 	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
 	"github.com/5aradise/link-forge/internal/util"
 	"github.com/5aradise/link-forge/pkg/api"
 	"github.com/5aradise/link-forge/pkg/middleware"
@@ -15,13 +21,69 @@ import (
 type CreateURLRequest struct {
 	URL   string `json:"url"`
 	Alias string `json:"alias,omitempty"`
+
+	// ExpiresAt and MaxClicks limit the lifetime of the url, after either
+	// of them is reached the alias answers 410 Gone.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks *int64     `json:"max_clicks,omitempty"`
 }
 
 type CreateURLResponse struct {
 	api.Response
 	Alias string `json:"alias,omitempty"`
+	// Reasons tell why an invalid url breaks the url policy.
+	Reasons []util.URLViolation `json:"reasons,omitempty"`
+	// FinalURL is where the url redirects to, when it does.
+	FinalURL string `json:"final_url,omitempty"`
+}
+
+var (
+	ErrEmptyURL        = errors.New("empty url field")
+	ErrInvalidURL      = errors.New("invalid url")
+	ErrExpiresInPast   = errors.New("expires_at is in the past")
+	ErrInvalidMaxClick = errors.New("max_clicks must be positive")
+	ErrAliasTooShort   = errors.New("alias length is too short")
+	ErrAliasSuffix     = errors.New("alias must not end with " + previewSuffix)
+	ErrAliasReserved   = errors.New("alias is reserved")
+	ErrBlockedURL      = errors.New("url is blocklisted")
+	ErrGenerateAlias   = errors.New("failed to generate alias")
+)
+
+const msgAliasExists = "alias already exists"
+
+// InvalidURLError is ErrInvalidURL with the reasons the url breaks the
+// url policy.
+type InvalidURLError struct {
+	Violations []util.URLViolation
+}
+
+func (e *InvalidURLError) Error() string {
+	details := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		details[i] = v.Detail
+	}
+	return ErrInvalidURL.Error() + ": " + strings.Join(details, ", ")
+}
+
+func (e *InvalidURLError) Unwrap() error {
+	return ErrInvalidURL
+}
+
+// invalidURLErrs are the errors of Create caused by the new url itself.
+var invalidURLErrs = []error{
+	ErrEmptyURL,
+	ErrInvalidURL,
+	ErrExpiresInPast,
+	ErrInvalidMaxClick,
+	ErrAliasTooShort,
+	ErrAliasSuffix,
+	ErrAliasReserved,
+	ErrBlockedURL,
 }
 
+// reservedAliases are the paths under /urls/ taken by other endpoints.
+var reservedAliases = []string{"export", "import"}
+
 func (s *URLService) CreateURL(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.url.create"
 	l := s.l.With(
@@ -29,6 +91,11 @@ func (s *URLService) CreateURL(w http.ResponseWriter, r *http.Request) {
 		slog.String("request_id", middleware.GetRequestID(r)),
 	)
 
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
 	var req CreateURLRequest
 	if err := api.DecodeJSON(r, &req); err != nil {
 		errMsg := "failed to decode request body"
@@ -37,59 +104,202 @@ func (s *URLService) CreateURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.URL == "" {
-		errMsg := "empty url field"
-		l.Error("invalid request", slog.String("error", errMsg))
-		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+	l.Info("request body decoded", slog.Any("request", req))
+
+	newURL, finalURL, err := s.Create(r.Context(), l, types.NewURL{
+		Alias:     req.Alias,
+		Url:       req.URL,
+		ExpiresAt: req.ExpiresAt,
+		MaxClicks: req.MaxClicks,
+		Owner:     p.Name,
+	})
+	if err != nil {
+		writeCreateError(w, err, l)
 		return
 	}
 
-	l.Info("request body decoded", slog.Any("request", req))
+	l.Info("url added", slog.Int64("id", newURL.Id))
 
-	if !util.IsURL(req.URL) {
-		errMsg := "invalid url"
-		l.Error("invalid request", slog.String("error", errMsg), slog.String("url", req.URL))
-		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+	handlers.WriteJSONLog(w, http.StatusCreated, CreateURLResponse{
+		Response: api.ResOK(),
+		Alias:    newURL.Alias,
+		FinalURL: finalURL,
+	}, l)
+}
+
+// writeCreateError answers with the status of an error returned by Create.
+func writeCreateError(w http.ResponseWriter, err error, l *slog.Logger) {
+	if res, ok := invalidURLResponse(err); ok {
+		l.Info("invalid request", util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, res, l)
 		return
 	}
 
-	alias := req.Alias
-	if alias == "" {
-		var err error
-		alias, err = s.as.nextAlias()
-		if err != nil {
+	switch {
+	case errors.Is(err, database.ErrAliasExists):
+		l.Info(msgAliasExists, util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(msgAliasExists), l)
+	case errors.Is(err, ErrGenerateAlias):
+		if errors.Is(err, ErrMaxAliasCountEexceeds) {
 			l.Error("ALIAS COUNT IS EXCEEDED")
-			handlers.WriteJSONLog(w, http.StatusInternalServerError, api.ResError("failed to generate alias"), l)
-			return
+		} else {
+			l.Error("failed to generate alias", util.SlErr(err))
+		}
+		handlers.WriteStorageErrorLog(w, err, ErrGenerateAlias.Error(), l)
+	default:
+		errMsg := "failed to add url"
+		l.Error(errMsg, util.SlErr(err))
+		handlers.WriteStorageErrorLog(w, err, errMsg, l)
+	}
+}
+
+// invalidURLResponse returns the response to a url failing validation with
+// err, if it does.
+func invalidURLResponse(err error) (CreateURLResponse, bool) {
+	var invalidURL *InvalidURLError
+	if errors.As(err, &invalidURL) {
+		return CreateURLResponse{Response: api.ResError(ErrInvalidURL.Error()), Reasons: invalidURL.Violations}, true
+	}
+	for _, invalid := range invalidURLErrs {
+		if errors.Is(err, invalid) {
+			return CreateURLResponse{Response: api.ResError(invalid.Error())}, true
 		}
+	}
+	return CreateURLResponse{}, false
+}
 
-		l.Info("generated new alias", slog.String("alias", alias))
-	} else if len(alias) <= maxAliasLen {
-		errMsg := "alias length is too short"
-		l.Info(errMsg, slog.String("alias", alias))
-		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
-		return
+// follow resolves the redirects of url, a url already checked against the
+// policy, and returns where they end, empty when it does not redirect.
+// Redirects looping, leading back to the shortener or too many fail with
+// InvalidURLError, ending at a blocklisted destination fails with
+// ErrBlockedURL. Destinations that cannot be reached are let through.
+func (s *URLService) follow(ctx context.Context, l *slog.Logger, url string) (string, error) {
+	if s.res == nil {
+		return "", nil
+	}
+
+	res, err := s.res.Resolve(ctx, url)
+	if err != nil {
+		l.Info("failed to resolve url redirects", util.SlErr(err))
+		return "", nil
+	}
+	l.Info("url redirects resolved", slog.Any("hops", res.Hops))
+
+	var violations []util.URLViolation
+	switch {
+	case res.Loop:
+		violations = append(violations, util.URLViolation{Reason: util.ReasonRedirectLoop, Detail: "url redirects in a loop"})
+	case res.SelfReference:
+		violations = append(violations, util.URLViolation{Reason: util.ReasonSelfReference, Detail: "url redirects to this link shortener"})
+	case res.TooManyHops:
+		violations = append(violations, util.URLViolation{Reason: util.ReasonTooManyHops, Detail: fmt.Sprintf("url redirects more than %d times", len(res.Hops))})
+	}
+	if len(violations) > 0 {
+		return "", &InvalidURLError{violations}
+	}
+
+	if res.Final == url {
+		return "", nil
+	}
+	if list, ok := s.blocked(res.Final); ok {
+		return "", fmt.Errorf("%w: redirects to a url listed by %s", ErrBlockedURL, list)
+	}
+	return res.Final, nil
+}
+
+// Create validates and stores a new url, generating its alias when it has
+// none, and returns where the url redirects to, empty when it does not.
+// Generated aliases that are taken are retried, a taken custom alias fails
+// with database.ErrAliasExists.
+func (s *URLService) Create(ctx context.Context, l *slog.Logger, newURL types.NewURL) (types.URL, string, error) {
+	err := s.validate(&newURL, false)
+	if err != nil {
+		return types.URL{}, "", err
+	}
+	finalURL, err := s.follow(ctx, l, newURL.Url)
+	if err != nil {
+		return types.URL{}, "", err
 	}
 
-	newURL, err := s.db.CreateURL(r.Context(), alias, req.URL)
+	url, err := s.insert(ctx, l, newURL)
 	if err != nil {
-		if errors.Is(err, database.ErrAliasExists) {
-			errMsg := "alias already exists"
-			l.Info(errMsg, slog.String("alias", alias))
-			handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
-			return
+		return types.URL{}, "", err
+	}
+	return url, finalURL, nil
+}
+
+// insert stores a validated url like Create.
+func (s *URLService) insert(ctx context.Context, l *slog.Logger, newURL types.NewURL) (types.URL, error) {
+	custom := newURL.Alias != ""
+	for attempt := 1; ; attempt++ {
+		if !custom {
+			var err error
+			newURL.Alias, err = s.gen.NextAlias(ctx)
+			if err != nil {
+				return types.URL{}, fmt.Errorf("%w: %w", ErrGenerateAlias, err)
+			}
+
+			l.Info("generated new alias", slog.String("alias", newURL.Alias))
 		}
 
-		errMsg := "failed to add url"
-		l.Error(errMsg, util.SlErr(err))
-		handlers.WriteJSONLog(w, http.StatusInternalServerError, api.ResError(errMsg), l)
-		return
+		url, err := s.db.CreateURL(ctx, newURL)
+		if err == nil {
+			return url, nil
+		}
+
+		if custom || !errors.Is(err, database.ErrAliasExists) {
+			return types.URL{}, err
+		}
+		if attempt == maxGenerateAttempts {
+			return types.URL{}, fmt.Errorf("%w: no unique alias in %d attempts", ErrGenerateAlias, attempt)
+		}
+		l.Info("generated alias already exists", slog.String("alias", newURL.Alias))
 	}
+}
 
-	l.Info("url added", slog.Int64("id", newURL.Id))
+// validate checks newURL and normalizes its url, without following its
+// redirects. Custom aliases no longer than generated ones are refused
+// unless allowShort is set.
+func (s *URLService) validate(newURL *types.NewURL, allowShort bool) error {
+	if newURL.Url == "" {
+		return ErrEmptyURL
+	}
+	url, err := s.checkURL(newURL.Url)
+	if err != nil {
+		return err
+	}
+	newURL.Url = url
 
-	handlers.WriteJSONLog(w, http.StatusCreated, CreateURLResponse{
-		api.ResOK(),
-		newURL.Alias,
-	}, l)
+	switch {
+	case newURL.ExpiresAt != nil && !newURL.ExpiresAt.After(time.Now()):
+		return ErrExpiresInPast
+	case newURL.MaxClicks != nil && *newURL.MaxClicks < 1:
+		return ErrInvalidMaxClick
+	case !allowShort && newURL.Alias != "" && len(newURL.Alias) <= s.gen.MaxLen():
+		return ErrAliasTooShort
+	}
+	return validateAlias(newURL.Alias)
+}
+
+// checkURL checks url against the policy and the blocklists and returns it
+// normalized.
+func (s *URLService) checkURL(url string) (string, error) {
+	url, violations := s.policy.Check(url)
+	if len(violations) > 0 {
+		return "", &InvalidURLError{violations}
+	}
+	if list, ok := s.blocked(url); ok {
+		return "", fmt.Errorf("%w: listed by %s", ErrBlockedURL, list)
+	}
+	return url, nil
+}
+
+func validateAlias(alias string) error {
+	switch {
+	case strings.HasSuffix(alias, previewSuffix):
+		return ErrAliasSuffix
+	case slices.Contains(reservedAliases, alias):
+		return ErrAliasReserved
+	}
+	return nil
 }
@@ -25,13 +25,23 @@ func (s *URLService) DeleteURL(w http.ResponseWriter, r *http.Request) {
 		panic("empty alias path value")
 	}
 
-	url, err := s.db.DeleteURLByAlias(r.Context(), alias)
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	// The owner is checked by the delete itself, a check before it could
+	// be outdated by the time the url is deleted.
+	url, err := s.db.DeleteURLByAlias(r.Context(), alias, managedOwner(p))
 	if err != nil {
 		l.Error("failed to delete url", util.SlErr(err))
-		if errors.Is(err, database.ErrURLUnfound) {
+		switch {
+		case errors.Is(err, database.ErrURLUnfound):
 			handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError("url with this alias unfound"), l)
-		} else {
-			handlers.WriteJSONLog(w, http.StatusInternalServerError, api.ResError("internal error"), l)
+		case errors.Is(err, database.ErrNotOwner):
+			handlers.WriteJSONLog(w, http.StatusForbidden, api.ResError("url is owned by someone else"), l)
+		default:
+			handlers.WriteStorageErrorLog(w, err, "internal error", l)
 		}
 		return
 	}
@@ -0,0 +1,75 @@
+package urls
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+type URLInfoResponse struct {
+	api.Response
+	URL *types.URL `json:"url,omitempty"`
+	// Clicks are only counted for those who manage the url.
+	Clicks *int64 `json:"clicks,omitempty"`
+}
+
+// URLInfo describes an alias without redirecting to it. The ETag is the
+// version UpdateURL expects in If-Match. The owner and the clicks of the
+// url are left out unless the principal manages it, like its stats.
+func (s *URLService) URLInfo(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.info"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	alias := r.PathValue("alias")
+	if alias == "" {
+		panic("empty alias path value")
+	}
+
+	url, err := s.db.GetURLByAlias(r.Context(), alias)
+	if err != nil {
+		if errors.Is(err, database.ErrURLUnfound) {
+			l.Info("url unfound", slog.String("alias", alias))
+			handlers.WriteJSONLog(w, http.StatusNotFound, api.ResError("url with this alias unfound"), l)
+		} else {
+			l.Error("failed to get url", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to get url", l)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(url.Version))
+	if p, _ := middleware.GetPrincipal(r); !canManage(p, url) {
+		url.Owner = ""
+		url.UsedClicks = 0
+		l.Info("url info sent", slog.String("alias", alias))
+		handlers.WriteJSONLog(w, http.StatusOK, URLInfoResponse{Response: api.ResOK(), URL: &url}, l)
+		return
+	}
+
+	// Recent clicks may still be queued, the count lags behind a little.
+	clicks, err := s.db.CountClicks(r.Context(), url.Id)
+	if err != nil {
+		l.Error("failed to count clicks", util.SlErr(err))
+		handlers.WriteStorageErrorLog(w, err, "failed to get url", l)
+		return
+	}
+
+	l.Info("url info sent", slog.String("alias", alias))
+
+	handlers.WriteJSONLog(w, http.StatusOK, URLInfoResponse{
+		api.ResOK(),
+		&url,
+		&clicks,
+	}, l)
+}
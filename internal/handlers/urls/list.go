@@ -1,8 +1,13 @@
 package urls
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/5aradise/link-forge/internal/handlers"
 	"github.com/5aradise/link-forge/internal/types"
@@ -11,11 +16,30 @@ import (
 	"github.com/5aradise/link-forge/pkg/middleware"
 )
 
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type ListURLsResponse struct {
 	api.Response
-	URLs []types.URL `json:"urls"`
+	URLs       []types.URL `json:"urls"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	// TotalEstimate is the number of urls matching the filters, counted
+	// for the first page only. Pages are not a snapshot, so it drifts as
+	// urls are created and deleted while paginating.
+	TotalEstimate *int64 `json:"total_estimate,omitempty"`
 }
 
+// ListURLs returns a page of urls ordered by id. Query parameters:
+// limit, cursor (next_cursor of the previous page), order (asc or desc),
+// alias_prefix and host (destination host). Only admins see the urls of
+// everyone.
 func (s *URLService) ListURLs(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.url.list"
 
@@ -24,17 +48,131 @@ func (s *URLService) ListURLs(w http.ResponseWriter, r *http.Request) {
 		slog.String("request_id", middleware.GetRequestID(r)),
 	)
 
-	urls, err := s.db.ListURLs(r.Context())
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	params, err := parseListParams(r)
+	if err != nil {
+		l.Info("invalid request", util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(err.Error()), l)
+		return
+	}
+	if !p.Admin {
+		params.Owner = p.Name
+	}
+
+	// One more url than asked tells whether there is a next page.
+	limit := params.Limit
+	params.Limit++
+	urls, err := s.db.ListURLs(r.Context(), params)
 	if err != nil {
 		l.Error("failed to list urls", util.SlErr(err))
-		handlers.WriteJSONLog(w, http.StatusInternalServerError, api.ResError("failed to list urls"), l)
+		handlers.WriteStorageErrorLog(w, err, "failed to list urls", l)
 		return
 	}
 
-	l.Info("urls listed")
+	res := ListURLsResponse{
+		Response: api.ResOK(),
+		URLs:     urls,
+	}
+	if len(urls) > limit {
+		res.URLs = urls[:limit]
+		res.NextCursor = encodeCursor(params.Desc, res.URLs[limit-1].Id)
+	}
+
+	if params.After == 0 {
+		total, err := s.db.CountURLs(r.Context(), params.URLFilter)
+		if err != nil {
+			l.Error("failed to count urls", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to list urls", l)
+			return
+		}
+		res.TotalEstimate = &total
+	}
+
+	l.Info("urls listed", slog.Int("count", len(res.URLs)))
+
+	handlers.WriteJSONLog(w, http.StatusOK, res, l)
+}
+
+func parseListParams(r *http.Request) (types.ListURLsParams, error) {
+	query := r.URL.Query()
+	params := types.ListURLsParams{
+		URLFilter: types.URLFilter{
+			AliasPrefix: query.Get("alias_prefix"),
+			Host:        strings.ToLower(query.Get("host")),
+		},
+		Limit: defaultListLimit,
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		params.Limit = limit
+	}
+
+	switch query.Get("order") {
+	case "", OrderAsc:
+	case OrderDesc:
+		params.Desc = true
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	if !isHost(params.Host) {
+		return params, errors.New("invalid host")
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		desc, after, err := decodeCursor(v)
+		if err != nil || desc != params.Desc {
+			return params, ErrInvalidCursor
+		}
+		params.After = after
+	}
+
+	return params, nil
+}
+
+// isHost reports whether host is empty or a lowercase domain name or IPv4
+// address. The storages match it literally, so nothing else is allowed.
+func isHost(host string) bool {
+	for _, c := range host {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Cursors are opaque to clients. They hold the order of the listing they
+// were issued for and the id of the last url of the page.
+func encodeCursor(desc bool, id int64) string {
+	order := OrderAsc
+	if desc {
+		order = OrderDesc
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(order + ":" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (desc bool, id int64, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false, 0, ErrInvalidCursor
+	}
+
+	order, v, ok := strings.Cut(string(data), ":")
+	if !ok || order != OrderAsc && order != OrderDesc {
+		return false, 0, ErrInvalidCursor
+	}
+	id, err = strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 1 {
+		return false, 0, ErrInvalidCursor
+	}
 
-	handlers.WriteJSONLog(w, http.StatusOK, ListURLsResponse{
-		api.ResOK(),
-		urls,
-	}, l)
+	return order == OrderDesc, id, nil
 }
@@ -0,0 +1,56 @@
+// Code generated by mockery v2.46.3. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// AliasStorage is an autogenerated mock type for the AliasStorage type
+type AliasStorage struct {
+	mock.Mock
+}
+
+// LeaseAliases provides a mock function with given fields: ctx, n
+func (_m *AliasStorage) LeaseAliases(ctx context.Context, n uint32) (uint32, error) {
+	ret := _m.Called(ctx, n)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LeaseAliases")
+	}
+
+	var r0 uint32
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint32) (uint32, error)); ok {
+		return rf(ctx, n)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uint32) uint32); ok {
+		r0 = rf(ctx, n)
+	} else {
+		r0 = ret.Get(0).(uint32)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uint32) error); ok {
+		r1 = rf(ctx, n)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewAliasStorage creates a new instance of AliasStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewAliasStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *AliasStorage {
+	mock := &AliasStorage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -15,27 +15,27 @@ type URLStorage struct {
 	mock.Mock
 }
 
-// CreateURL provides a mock function with given fields: ctx, alias, url
-func (_m *URLStorage) CreateURL(ctx context.Context, alias string, url string) (types.URL, error) {
-	ret := _m.Called(ctx, alias, url)
+// ClickStats provides a mock function with given fields: ctx, params
+func (_m *URLStorage) ClickStats(ctx context.Context, params types.ClickStatsParams) (types.ClickStats, error) {
+	ret := _m.Called(ctx, params)
 
 	if len(ret) == 0 {
-		panic("no return value specified for CreateURL")
+		panic("no return value specified for ClickStats")
 	}
 
-	var r0 types.URL
+	var r0 types.ClickStats
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) (types.URL, error)); ok {
-		return rf(ctx, alias, url)
+	if rf, ok := ret.Get(0).(func(context.Context, types.ClickStatsParams) (types.ClickStats, error)); ok {
+		return rf(ctx, params)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) types.URL); ok {
-		r0 = rf(ctx, alias, url)
+	if rf, ok := ret.Get(0).(func(context.Context, types.ClickStatsParams) types.ClickStats); ok {
+		r0 = rf(ctx, params)
 	} else {
-		r0 = ret.Get(0).(types.URL)
+		r0 = ret.Get(0).(types.ClickStats)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, alias, url)
+	if rf, ok := ret.Get(1).(func(context.Context, types.ClickStatsParams) error); ok {
+		r1 = rf(ctx, params)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -43,12 +43,12 @@ func (_m *URLStorage) CreateURL(ctx context.Context, alias string, url string) (
 	return r0, r1
 }
 
-// DeleteURLByAlias provides a mock function with given fields: ctx, alias
-func (_m *URLStorage) DeleteURLByAlias(ctx context.Context, alias string) (types.URL, error) {
+// ConsumeClick provides a mock function with given fields: ctx, alias
+func (_m *URLStorage) ConsumeClick(ctx context.Context, alias string) (types.URL, error) {
 	ret := _m.Called(ctx, alias)
 
 	if len(ret) == 0 {
-		panic("no return value specified for DeleteURLByAlias")
+		panic("no return value specified for ConsumeClick")
 	}
 
 	var r0 types.URL
@@ -71,6 +71,148 @@ func (_m *URLStorage) DeleteURLByAlias(ctx context.Context, alias string) (types
 	return r0, r1
 }
 
+// CountClicks provides a mock function with given fields: ctx, urlID
+func (_m *URLStorage) CountClicks(ctx context.Context, urlID int64) (int64, error) {
+	ret := _m.Called(ctx, urlID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountClicks")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (int64, error)); ok {
+		return rf(ctx, urlID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) int64); ok {
+		r0 = rf(ctx, urlID)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, urlID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountURLs provides a mock function with given fields: ctx, filter
+func (_m *URLStorage) CountURLs(ctx context.Context, filter types.URLFilter) (int64, error) {
+	ret := _m.Called(ctx, filter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountURLs")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, types.URLFilter) (int64, error)); ok {
+		return rf(ctx, filter)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, types.URLFilter) int64); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, types.URLFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateURL provides a mock function with given fields: ctx, newURL
+func (_m *URLStorage) CreateURL(ctx context.Context, newURL types.NewURL) (types.URL, error) {
+	ret := _m.Called(ctx, newURL)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateURL")
+	}
+
+	var r0 types.URL
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, types.NewURL) (types.URL, error)); ok {
+		return rf(ctx, newURL)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, types.NewURL) types.URL); ok {
+		r0 = rf(ctx, newURL)
+	} else {
+		r0 = ret.Get(0).(types.URL)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, types.NewURL) error); ok {
+		r1 = rf(ctx, newURL)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateURLs provides a mock function with given fields: ctx, newURLs, atomic
+func (_m *URLStorage) CreateURLs(ctx context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error) {
+	ret := _m.Called(ctx, newURLs, atomic)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateURLs")
+	}
+
+	var r0 []types.URL
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []types.NewURL, bool) ([]types.URL, error)); ok {
+		return rf(ctx, newURLs, atomic)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []types.NewURL, bool) []types.URL); ok {
+		r0 = rf(ctx, newURLs, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]types.URL)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []types.NewURL, bool) error); ok {
+		r1 = rf(ctx, newURLs, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteURLByAlias provides a mock function with given fields: ctx, alias, owner
+func (_m *URLStorage) DeleteURLByAlias(ctx context.Context, alias string, owner string) (types.URL, error) {
+	ret := _m.Called(ctx, alias, owner)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteURLByAlias")
+	}
+
+	var r0 types.URL
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (types.URL, error)); ok {
+		return rf(ctx, alias, owner)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) types.URL); ok {
+		r0 = rf(ctx, alias, owner)
+	} else {
+		r0 = ret.Get(0).(types.URL)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, alias, owner)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetURLByAlias provides a mock function with given fields: ctx, alias
 func (_m *URLStorage) GetURLByAlias(ctx context.Context, alias string) (types.URL, error) {
 	ret := _m.Called(ctx, alias)
@@ -99,9 +241,9 @@ func (_m *URLStorage) GetURLByAlias(ctx context.Context, alias string) (types.UR
 	return r0, r1
 }
 
-// ListURLs provides a mock function with given fields: ctx
-func (_m *URLStorage) ListURLs(ctx context.Context) ([]types.URL, error) {
-	ret := _m.Called(ctx)
+// ListURLs provides a mock function with given fields: ctx, params
+func (_m *URLStorage) ListURLs(ctx context.Context, params types.ListURLsParams) ([]types.URL, error) {
+	ret := _m.Called(ctx, params)
 
 	if len(ret) == 0 {
 		panic("no return value specified for ListURLs")
@@ -109,19 +251,47 @@ func (_m *URLStorage) ListURLs(ctx context.Context) ([]types.URL, error) {
 
 	var r0 []types.URL
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) ([]types.URL, error)); ok {
-		return rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, types.ListURLsParams) ([]types.URL, error)); ok {
+		return rf(ctx, params)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) []types.URL); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, types.ListURLsParams) []types.URL); ok {
+		r0 = rf(ctx, params)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]types.URL)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, types.ListURLsParams) error); ok {
+		r1 = rf(ctx, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateURL provides a mock function with given fields: ctx, alias, url, version, owner
+func (_m *URLStorage) UpdateURL(ctx context.Context, alias string, url string, version int64, owner string) (types.URL, error) {
+	ret := _m.Called(ctx, alias, url, version, owner)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateURL")
+	}
+
+	var r0 types.URL
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, string) (types.URL, error)); ok {
+		return rf(ctx, alias, url, version, owner)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, string) types.URL); ok {
+		r0 = rf(ctx, alias, url, version, owner)
+	} else {
+		r0 = ret.Get(0).(types.URL)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64, string) error); ok {
+		r1 = rf(ctx, alias, url, version, owner)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,67 @@
+package urls
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+const permutationRounds = 4
+
+// permutation is a keyed bijection of [0, n) built from a balanced Feistel
+// network over the smallest even bit width covering n. Values that fall
+// outside of the range are encrypted again (cycle walking), which keeps the
+// mapping a bijection of [0, n).
+type permutation struct {
+	n        uint32
+	halfBits uint
+	keys     [permutationRounds][]byte
+}
+
+func newPermutation(n uint32, salt string) *permutation {
+	width := uint(bits.Len32(n - 1))
+	halfBits := (width + 1) / 2
+	if halfBits == 0 {
+		halfBits = 1
+	}
+
+	p := &permutation{
+		n:        n,
+		halfBits: halfBits,
+	}
+	for round := range p.keys {
+		mac := hmac.New(sha256.New, []byte(salt))
+		mac.Write([]byte{byte(round)})
+		p.keys[round] = mac.Sum(nil)
+	}
+	return p
+}
+
+func (p *permutation) apply(i uint32) uint32 {
+	v := uint64(i)
+	for {
+		v = p.encrypt(v)
+		if v < uint64(p.n) {
+			return uint32(v)
+		}
+	}
+}
+
+func (p *permutation) encrypt(v uint64) uint64 {
+	mask := uint64(1)<<p.halfBits - 1
+	left, right := v>>p.halfBits, v&mask
+	for _, key := range p.keys {
+		left, right = right, left^(p.round(key, right)&mask)
+	}
+	return left<<p.halfBits | right
+}
+
+func (p *permutation) round(key []byte, half uint64) uint64 {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], half)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package urls
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+// previewSuffix appended to an alias shows where it leads instead of
+// redirecting there.
+const previewSuffix = "+"
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Link preview | {{.Alias}}</title>
+  </head>
+  <body>
+    <p>{{.Alias}} leads to</p>
+    <p><a href="{{.Url}}" rel="noopener noreferrer nofollow">{{.Url}}</a></p>
+    <p>Created {{.CreatedAt.Format "2006-01-02"}}</p>
+  </body>
+</html>`))
+
+func renderPreview(url types.URL) (string, error) {
+	var b strings.Builder
+	err := previewTemplate.Execute(&b, url)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
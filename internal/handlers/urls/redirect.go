@@ -1,9 +1,16 @@
 package urls
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/5aradise/link-forge/internal/analytics"
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
 	"github.com/5aradise/link-forge/internal/util"
 	"github.com/5aradise/link-forge/pkg/api"
 	"github.com/5aradise/link-forge/pkg/middleware"
@@ -24,6 +31,30 @@ func (s *URLService) RedirectURL(w http.ResponseWriter, r *http.Request) {
   </body>
 </html>`
 
+	const ServiceUnavailableHTML = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Service Unavailable | 503</title>
+  </head>
+  <body>
+    Try again later
+  </body>
+</html>`
+
+	const GoneHTML = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Link Expired | 410</title>
+  </head>
+  <body>
+    This link has expired
+  </body>
+</html>`
+
 	l := s.l.With(
 		slog.String("op", op),
 		slog.String("request_id", middleware.GetRequestID(r)),
@@ -34,17 +65,100 @@ func (s *URLService) RedirectURL(w http.ResponseWriter, r *http.Request) {
 		panic("empty alias path value")
 	}
 
+	// An alias ending with the preview suffix is looked up as is first:
+	// such aliases were generated while "+" was in the alphabet, and they
+	// still redirect.
 	url, err := s.db.GetURLByAlias(r.Context(), alias)
+	preview := false
+	if trimmed, ok := strings.CutSuffix(alias, previewSuffix); ok && errors.Is(err, database.ErrURLUnfound) {
+		url, err = s.db.GetURLByAlias(r.Context(), trimmed)
+		preview = true
+	}
+	if err == nil && url.Expired(time.Now()) {
+		err = database.ErrURLExpired
+	}
+	// Links created before their destination was listed are caught here.
+	var (
+		list    string
+		blocked bool
+	)
+	if err == nil && s.block != nil && s.block.CheckRedirects() {
+		list, blocked = s.block.Blocked(url.Url)
+	}
+	// Links with a click budget are not served from the cached lookup, every
+	// redirect is counted in the storage first.
+	if err == nil && !preview && !blocked && url.MaxClicks != nil {
+		url, err = s.db.ConsumeClick(r.Context(), url.Alias)
+	}
 	if err != nil {
-		l.Error("failed to get url", util.SlErr(err))
-		err := api.WriteHTML(w, http.StatusNotFound, PageNotFoundHTML)
+		code, page := http.StatusNotFound, PageNotFoundHTML
+		switch {
+		case errors.Is(err, database.ErrURLExpired):
+			l.Info("url expired", slog.String("alias", alias))
+			code, page = http.StatusGone, GoneHTML
+		case handlers.IsUnavailable(err):
+			l.Error("failed to get url", util.SlErr(err))
+			code, page = http.StatusServiceUnavailable, ServiceUnavailableHTML
+		default:
+			l.Error("failed to get url", util.SlErr(err))
+		}
+		err := api.WriteHTML(w, code, page)
+		if err != nil {
+			l.Error("failed to write response", util.SlErr(err))
+		}
+		return
+	}
+
+	if blocked {
+		l.Warn("blocklisted url not redirected", slog.String("url", url.Url), slog.String("list", list))
+		page, err := renderWarning(url)
+		if err != nil {
+			l.Error("failed to render warning", util.SlErr(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		err = api.WriteHTML(w, http.StatusForbidden, page)
+		if err != nil {
+			l.Error("failed to write response", util.SlErr(err))
+		}
+		return
+	}
+
+	if preview {
+		page, err := renderPreview(url)
+		if err != nil {
+			l.Error("failed to render preview", util.SlErr(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		err = api.WriteHTML(w, http.StatusOK, page)
 		if err != nil {
 			l.Error("failed to write response", util.SlErr(err))
 		}
+		l.Info("url previewed", slog.String("url", url.Url))
 		return
 	}
 
 	l.Info("redirected to url", slog.String("url", url.Url))
 
 	http.Redirect(w, r, url.Url, http.StatusFound)
+
+	if s.clicks == nil {
+		return
+	}
+	client := middleware.GetClient(r)
+	click := types.Click{
+		URLID:      url.Id,
+		Alias:      url.Alias,
+		At:         time.Now().UTC(),
+		Referrer:   r.Referer(),
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: client.IP,
+		RequestID:  middleware.GetRequestID(r),
+	}
+	// Country headers are set by proxies, a client could send its own.
+	if client.Proxied {
+		click.Country = analytics.Country(r.Header)
+	}
+	s.clicks.Record(click)
 }
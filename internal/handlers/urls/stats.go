@@ -0,0 +1,185 @@
+package urls
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+
+	defaultStatsRange = 7 * 24 * time.Hour
+	maxStatsBuckets   = 1000
+	defaultStatsTop   = 10
+	maxStatsTop       = 100
+)
+
+var intervals = map[string]time.Duration{
+	IntervalHour: time.Hour,
+	IntervalDay:  24 * time.Hour,
+	IntervalWeek: 7 * 24 * time.Hour,
+}
+
+type URLStatsResponse struct {
+	api.Response
+	Stats *URLStats `json:"stats,omitempty"`
+}
+
+type URLStats struct {
+	Alias    string    `json:"alias"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval"`
+	types.ClickStats
+}
+
+// URLStats reports the clicks of an alias. Query parameters: from and to
+// (RFC 3339, the last week by default), interval of the series (hour, day
+// or week, UTC, weeks start on Monday) and top (size of the breakdowns).
+// Only the owner of the url and admins may see them.
+func (s *URLService) URLStats(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.stats"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	alias := r.PathValue("alias")
+	if alias == "" {
+		panic("empty alias path value")
+	}
+
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	params, interval, err := parseStatsParams(r, time.Now())
+	if err != nil {
+		l.Info("invalid request", util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(err.Error()), l)
+		return
+	}
+
+	url, err := s.db.GetURLByAlias(r.Context(), alias)
+	if err != nil {
+		if errors.Is(err, database.ErrURLUnfound) {
+			l.Info("url unfound", slog.String("alias", alias))
+			handlers.WriteJSONLog(w, http.StatusNotFound, api.ResError("url with this alias unfound"), l)
+		} else {
+			l.Error("failed to get url", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to get stats", l)
+		}
+		return
+	}
+	if !canManage(p, url) {
+		l.Info("url of another owner", slog.String("alias", alias), slog.String("principal", p.Name))
+		handlers.WriteJSONLog(w, http.StatusForbidden, api.ResError("url is owned by someone else"), l)
+		return
+	}
+	params.URLID = url.Id
+
+	stats, err := s.db.ClickStats(r.Context(), params)
+	if err != nil {
+		l.Error("failed to get stats", util.SlErr(err))
+		handlers.WriteStorageErrorLog(w, err, "failed to get stats", l)
+		return
+	}
+	stats.Series = fillSeries(stats.Series, params)
+
+	l.Info("url stats sent", slog.String("alias", alias))
+
+	handlers.WriteJSONLog(w, http.StatusOK, URLStatsResponse{
+		api.ResOK(),
+		&URLStats{
+			Alias:      alias,
+			From:       params.From,
+			To:         params.To,
+			Interval:   interval,
+			ClickStats: stats,
+		},
+	}, l)
+}
+
+func parseStatsParams(r *http.Request, now time.Time) (types.ClickStatsParams, string, error) {
+	query := r.URL.Query()
+	params := types.ClickStatsParams{
+		To:  now.UTC(),
+		Top: defaultStatsTop,
+	}
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = IntervalDay
+	}
+	bucket, ok := intervals[interval]
+	if !ok {
+		return params, "", errors.New("interval must be hour, day or week")
+	}
+	params.Bucket = bucket
+
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, "", errors.New("to must be an RFC 3339 time")
+		}
+		params.To = to.UTC()
+	}
+	params.From = params.To.Add(-defaultStatsRange)
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, "", errors.New("from must be an RFC 3339 time")
+		}
+		params.From = from.UTC()
+	}
+	if !params.From.Before(params.To) {
+		return params, "", errors.New("from must be before to")
+	}
+	if params.To.Sub(params.From)/params.Bucket >= maxStatsBuckets {
+		return params, "", fmt.Errorf("range must have at most %d intervals", maxStatsBuckets)
+	}
+
+	if v := query.Get("top"); v != "" {
+		top, err := strconv.Atoi(v)
+		if err != nil || top < 1 || top > maxStatsTop {
+			return params, "", fmt.Errorf("top must be between 1 and %d", maxStatsTop)
+		}
+		params.Top = top
+	}
+
+	return params, interval, nil
+}
+
+// fillSeries adds the buckets without clicks to the series returned by
+// the storage, from the bucket of params.From to the one of params.To.
+func fillSeries(series []types.ClickBucket, params types.ClickStatsParams) []types.ClickBucket {
+	clicks := make(map[int64]int64, len(series))
+	for _, b := range series {
+		clicks[b.Start.UnixMilli()] = b.Clicks
+	}
+
+	first := types.BucketOrigin.Add(params.From.Sub(types.BucketOrigin).Truncate(params.Bucket))
+	filled := make([]types.ClickBucket, 0, params.To.Sub(first)/params.Bucket+1)
+	for start := first; start.Before(params.To); start = start.Add(params.Bucket) {
+		filled = append(filled, types.ClickBucket{
+			Start:  start,
+			Clicks: clicks[start.UnixMilli()],
+		})
+	}
+	return filled
+}
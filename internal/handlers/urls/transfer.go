@@ -0,0 +1,359 @@
+package urls
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/transfer"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+const (
+	// importChunkSize is the number of rows inserted in one transaction.
+	importChunkSize = 500
+	maxImportSize   = 64 << 20
+
+	RowConflict = "conflict"
+	RowInvalid  = "invalid"
+	RowFailed   = "failed"
+)
+
+var ErrReadImport = errors.New("failed to read import")
+
+type ImportURLsResponse struct {
+	api.Response
+	*ImportReport
+}
+
+// ImportReport counts the imported rows and lists the ones not imported.
+type ImportReport struct {
+	Created   int         `json:"created"`
+	Conflicts int         `json:"conflicts"`
+	Invalid   int         `json:"invalid"`
+	Failed    int         `json:"failed"`
+	Rows      []RowReport `json:"rows"`
+}
+
+type RowReport struct {
+	Line   int    `json:"line"`
+	Alias  string `json:"alias,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func (rep *ImportReport) add(row transfer.Row, status, msg string) {
+	switch status {
+	case RowConflict:
+		rep.Conflicts++
+	case RowInvalid:
+		rep.Invalid++
+	default:
+		rep.Failed++
+	}
+	rep.Rows = append(rep.Rows, RowReport{
+		Line:   row.Line,
+		Alias:  row.Alias,
+		URL:    row.URL,
+		Status: status,
+		Error:  msg,
+	})
+}
+
+// importRow is a validated row waiting for the insert of its chunk.
+type importRow struct {
+	row       transfer.Row
+	newURL    types.NewURL
+	generated bool
+}
+
+// ownedRows gives the rows of an upload to the uploader, whatever owner
+// the file names.
+type ownedRows struct {
+	transfer.Reader
+	owner string
+}
+
+func (o ownedRows) Read() (transfer.Row, error) {
+	row, err := o.Reader.Read()
+	row.Owner = o.owner
+	return row, err
+}
+
+// ImportURLs creates the urls of the uploaded file, owned by the caller.
+// The format is set by the format query parameter (csv, jsonl, bitly or
+// yourls) or by the Content-Type of CSV and JSON Lines. Rows are inserted
+// in chunks, one transaction each, rows with a taken alias or an invalid
+// url are reported and skipped instead of failing the import.
+func (s *URLService) ImportURLs(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.import"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	format := importFormat(r)
+	rows, err := transfer.NewReader(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	if err != nil {
+		l.Info("invalid request", util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(importErrMsg(err)), l)
+		return
+	}
+
+	report, err := s.Import(r.Context(), l, ownedRows{rows, p.Name})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrReadImport):
+			l.Info("failed to read import", util.SlErr(err), slog.Int("created", report.Created))
+			handlers.WriteJSONLog(w, http.StatusBadRequest, ImportURLsResponse{api.ResError(importErrMsg(err)), report}, l)
+		case errors.Is(err, ErrGenerateAlias):
+			l.Error("failed to generate alias", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, ErrGenerateAlias.Error(), l)
+		default:
+			l.Error("failed to import urls", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to import urls", l)
+		}
+		return
+	}
+
+	l.Info("urls imported",
+		slog.String("format", format),
+		slog.Int("created", report.Created),
+		slog.Int("conflicts", report.Conflicts),
+		slog.Int("invalid", report.Invalid),
+		slog.Int("failed", report.Failed),
+	)
+
+	handlers.WriteJSONLog(w, http.StatusOK, ImportURLsResponse{api.ResOK(), report}, l)
+}
+
+// Import creates the urls of rows, owned by the owners of the rows. Rows
+// are validated like new urls and inserted in chunks, one transaction
+// each. Their redirects are not followed, an import has more rows than
+// can be resolved in one request. Rows with a taken alias or an invalid
+// url are reported and skipped. On error the report tells what has been
+// imported so far, errors of rows wrap ErrReadImport.
+func (s *URLService) Import(ctx context.Context, l *slog.Logger, rows transfer.Reader) (*ImportReport, error) {
+	report := &ImportReport{Rows: []RowReport{}}
+	chunk := make([]importRow, 0, importChunkSize)
+	for {
+		row, err := rows.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("%w: %w", ErrReadImport, err)
+		}
+
+		if row.Err != nil {
+			report.add(row, RowInvalid, row.Err.Error())
+			continue
+		}
+		newURL := types.NewURL{
+			Alias:     row.Alias,
+			Url:       row.URL,
+			ExpiresAt: row.ExpiresAt,
+			MaxClicks: row.MaxClicks,
+			Owner:     row.Owner,
+		}
+		// Short aliases are kept, the links they come from already use
+		// them. Those the generator hands out are retried when taken.
+		err = s.validate(&newURL, true)
+		if err != nil {
+			report.add(row, RowInvalid, err.Error())
+			continue
+		}
+
+		generated := newURL.Alias == ""
+		if generated {
+			newURL.Alias, err = s.gen.NextAlias(ctx)
+			if err != nil {
+				return report, fmt.Errorf("%w: %w", ErrGenerateAlias, err)
+			}
+		}
+
+		chunk = append(chunk, importRow{row, newURL, generated})
+		if len(chunk) == importChunkSize {
+			err = s.importChunk(ctx, l, chunk, report)
+			if err != nil {
+				return report, err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	err := s.importChunk(ctx, l, chunk, report)
+	if err != nil {
+		return report, err
+	}
+
+	// Conflicts are found once their chunk is inserted, after the invalid
+	// rows that follow them.
+	slices.SortStableFunc(report.Rows, func(a, b RowReport) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return report, nil
+}
+
+// importChunk inserts the rows in one transaction. Rows with a taken
+// custom alias are reported, the ones with a taken generated alias are
+// created one by one with a new alias.
+func (s *URLService) importChunk(ctx context.Context, l *slog.Logger, chunk []importRow, report *ImportReport) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	newURLs := make([]types.NewURL, len(chunk))
+	for i, ir := range chunk {
+		newURLs[i] = ir.newURL
+	}
+	urls, err := s.db.CreateURLs(ctx, newURLs, false)
+	if err != nil {
+		return err
+	}
+
+	for i, url := range urls {
+		if url.Id != 0 {
+			report.Created++
+			continue
+		}
+
+		ir := chunk[i]
+		if !ir.generated {
+			report.add(ir.row, RowConflict, msgAliasExists)
+			continue
+		}
+
+		l.Info("generated alias already exists", slog.String("alias", ir.newURL.Alias))
+		ir.newURL.Alias = ""
+		_, err = s.insert(ctx, l, ir.newURL)
+		if err != nil {
+			l.Error("failed to add url", util.SlErr(err), slog.Int("line", ir.row.Line))
+			report.add(ir.row, RowFailed, "failed to add url")
+			continue
+		}
+		report.Created++
+	}
+	return nil
+}
+
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return transfer.FormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return transfer.FormatJSONL
+	}
+	return ""
+}
+
+func importErrMsg(err error) string {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, transfer.ErrUnknownFormat):
+		return "format must be one of " + strings.Join(transfer.Formats(), ", ")
+	case errors.Is(err, transfer.ErrNoURLColumn):
+		return transfer.ErrNoURLColumn.Error()
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("import must be at most %d bytes", maxBytesErr.Limit)
+	}
+	return "failed to read import"
+}
+
+// ExportURLs streams the urls of the caller, or of everyone for admins, as
+// csv or jsonl (the default) set by the format query parameter.
+func (s *URLService) ExportURLs(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.export"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.FormatJSONL
+	}
+	out, err := transfer.NewWriter(w, format)
+	if err != nil {
+		l.Info("invalid request", util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError("format must be csv or jsonl"), l)
+		return
+	}
+
+	params := types.ListURLsParams{Limit: maxListLimit}
+	if !p.Admin {
+		params.Owner = p.Name
+	}
+
+	// The first page is read before writing anything, so that a failing
+	// storage still gets an error response.
+	urls, err := s.db.ListURLs(r.Context(), params)
+	if err != nil {
+		l.Error("failed to list urls", util.SlErr(err))
+		handlers.WriteStorageErrorLog(w, err, "failed to export urls", l)
+		return
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="links.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	count := 0
+	for {
+		for _, url := range urls {
+			err = out.Write(url)
+			if err != nil {
+				l.Error("failed to write export", util.SlErr(err))
+				return
+			}
+		}
+		count += len(urls)
+		if len(urls) < params.Limit {
+			break
+		}
+
+		params.After = urls[len(urls)-1].Id
+		urls, err = s.db.ListURLs(r.Context(), params)
+		if err != nil {
+			// The status is sent already, the export is cut short.
+			l.Error("failed to list urls", util.SlErr(err), slog.Int("written", count))
+			return
+		}
+	}
+
+	err = out.Flush()
+	if err != nil {
+		l.Error("failed to write export", util.SlErr(err))
+		return
+	}
+
+	l.Info("urls exported", slog.String("format", format), slog.Int("count", count))
+}
@@ -0,0 +1,151 @@
+package urls
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+type UpdateURLRequest struct {
+	URL string `json:"url"`
+}
+
+type UpdateURLResponse struct {
+	api.Response
+	URL *types.URL `json:"url,omitempty"`
+	// FinalURL is where the url redirects to, when it does.
+	FinalURL string `json:"final_url,omitempty"`
+	// Reasons tell why an invalid url breaks the url policy.
+	Reasons []util.URLViolation `json:"reasons,omitempty"`
+}
+
+// UpdateURL changes the destination of an alias. The ETag of the response
+// is the version of the url; sending it back in If-Match makes the update
+// fail with 412 if the url was changed in between.
+func (s *URLService) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.url.update"
+
+	l := s.l.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetRequestID(r)),
+	)
+
+	alias := r.PathValue("alias")
+	if alias == "" {
+		panic("empty alias path value")
+	}
+
+	p, ok := principal(w, r, l)
+	if !ok {
+		return
+	}
+
+	var req UpdateURLRequest
+	if err := api.DecodeJSON(r, &req); err != nil {
+		errMsg := "failed to decode request body"
+		l.Error(errMsg, util.SlErr(err))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+		return
+	}
+
+	if req.URL == "" {
+		errMsg := "empty url field"
+		l.Error("invalid request", slog.String("error", errMsg))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+		return
+	}
+
+	// The new destination is held to the checks of new urls.
+	normalized, err := s.checkURL(req.URL)
+	var finalURL string
+	if err == nil {
+		finalURL, err = s.follow(r.Context(), l, normalized)
+	}
+	if err != nil {
+		res, _ := invalidURLResponse(err)
+		l.Info("invalid request", util.SlErr(err), slog.String("url", req.URL), slog.Any("reasons", res.Reasons))
+		handlers.WriteJSONLog(w, http.StatusBadRequest, UpdateURLResponse{Response: res.Response, Reasons: res.Reasons}, l)
+		return
+	}
+	req.URL = normalized
+
+	var version int64
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var ok bool
+		version, ok = parseETag(ifMatch)
+		if !ok {
+			errMsg := "url was modified"
+			l.Info(errMsg, slog.String("if_match", ifMatch))
+			handlers.WriteJSONLog(w, http.StatusPreconditionFailed, api.ResError(errMsg), l)
+			return
+		}
+	}
+
+	// The owner is checked by the update itself, a check before it could
+	// be outdated by the time the url is updated.
+	url, err := s.db.UpdateURL(r.Context(), alias, req.URL, version, managedOwner(p))
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrURLUnfound):
+			l.Info("url unfound", slog.String("alias", alias))
+			handlers.WriteJSONLog(w, http.StatusNotFound, api.ResError("url with this alias unfound"), l)
+		case errors.Is(err, database.ErrNotOwner):
+			l.Info("url of another owner", slog.String("alias", alias), slog.String("principal", p.Name))
+			handlers.WriteJSONLog(w, http.StatusForbidden, api.ResError("url is owned by someone else"), l)
+		case errors.Is(err, database.ErrVersionMismatch):
+			errMsg := "url was modified"
+			l.Info(errMsg, slog.String("alias", alias), slog.Int64("version", version))
+			handlers.WriteJSONLog(w, http.StatusPreconditionFailed, api.ResError(errMsg), l)
+		default:
+			l.Error("failed to update url", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to update url", l)
+		}
+		return
+	}
+
+	l.Info("url updated", slog.Any("url", url))
+
+	w.Header().Set("ETag", formatETag(url.Version))
+	handlers.WriteJSONLog(w, http.StatusOK, UpdateURLResponse{
+		Response: api.ResOK(),
+		URL:      &url,
+		FinalURL: finalURL,
+	}, l)
+}
+
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag returns the version of an If-Match value, 0 for "*". Only a
+// single strong entity tag is accepted, anything else never matches.
+func parseETag(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "*" {
+		return 0, true
+	}
+
+	v, ok := strings.CutPrefix(v, `"`)
+	if !ok {
+		return 0, false
+	}
+	v, ok = strings.CutSuffix(v, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
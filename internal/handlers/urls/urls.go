@@ -3,39 +3,138 @@ package urls
 import (
 	"context"
 	"log/slog"
+	"net/http"
 
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/resolve"
 	"github.com/5aradise/link-forge/internal/types"
 	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.46.3 --name=URLStorage
 type URLStorage interface {
-	CreateURL(ctx context.Context, alias, url string) (types.URL, error)
-	ListURLs(ctx context.Context) ([]types.URL, error)
+	CreateURL(ctx context.Context, newURL types.NewURL) (types.URL, error)
+	// CreateURLs creates the urls in one transaction, skipping the ones
+	// whose alias is taken and leaving them zero in the result. With atomic
+	// set a taken alias creates none and fails with database.ErrAliasExists.
+	CreateURLs(ctx context.Context, newURLs []types.NewURL, atomic bool) ([]types.URL, error)
+	ListURLs(ctx context.Context, params types.ListURLsParams) ([]types.URL, error)
+	CountURLs(ctx context.Context, filter types.URLFilter) (int64, error)
 	GetURLByAlias(ctx context.Context, alias string) (types.URL, error)
-	DeleteURLByAlias(ctx context.Context, alias string) (types.URL, error)
+	// DeleteURLByAlias deletes the url of alias. With a non empty owner it
+	// fails with database.ErrNotOwner unless the url is of that owner.
+	DeleteURLByAlias(ctx context.Context, alias, owner string) (types.URL, error)
+	// UpdateURL sets the url of alias. With a non zero version it fails
+	// with database.ErrVersionMismatch unless the stored url is of that
+	// version, with a non empty owner with database.ErrNotOwner unless the
+	// url is of that owner.
+	UpdateURL(ctx context.Context, alias, url string, version int64, owner string) (types.URL, error)
+	// ConsumeClick counts a redirect against the click budget of alias. It
+	// fails with database.ErrURLExpired when no clicks are left.
+	ConsumeClick(ctx context.Context, alias string) (types.URL, error)
+	CountClicks(ctx context.Context, urlID int64) (int64, error)
+	ClickStats(ctx context.Context, params types.ClickStatsParams) (types.ClickStats, error)
+}
+
+// AliasStorage persists the alias counter. LeaseAliases reserves n counter
+// values and returns the first one of the reserved range.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.46.3 --name=AliasStorage
+type AliasStorage interface {
+	LeaseAliases(ctx context.Context, n uint32) (uint32, error)
+}
+
+// AliasGenerator produces aliases for urls created without a custom one.
+// Generated aliases may collide with existing ones, the caller retries then.
+// MaxLen is the length of the longest alias the generator can produce,
+// custom aliases must be longer to never take a generated one.
+type AliasGenerator interface {
+	NextAlias(ctx context.Context) (string, error)
+	MaxLen() int
+}
+
+// ClickRecorder takes the clicks of served redirects. Record must not
+// block the redirect. A nil recorder disables click recording.
+type ClickRecorder interface {
+	Record(c types.Click)
+}
+
+// Blocklist tells whether a destination is listed as malicious, returning
+// the name of the list. A nil blocklist blocks nothing.
+type Blocklist interface {
+	Blocked(url string) (list string, blocked bool)
+	// CheckRedirects reports whether links are checked again when
+	// followed, catching the ones created before their destination was
+	// listed.
+	CheckRedirects() bool
+}
+
+// Resolver follows the redirects of a destination. A nil resolver leaves
+// destinations unresolved.
+type Resolver interface {
+	Resolve(ctx context.Context, url string) (resolve.Result, error)
 }
 
 type URLService struct {
-	l  *slog.Logger
-	db URLStorage
-	as aliasService
+	l      *slog.Logger
+	db     URLStorage
+	gen    AliasGenerator
+	clicks ClickRecorder
+	policy *util.URLPolicy
+	block  Blocklist
+	res    Resolver
 }
 
-func NewService(l *slog.Logger, db URLStorage, currAliasCount uint32) (*URLService, error) {
-	const op = "handlers.url.NewService"
-	as, err := newAliasService(currAliasCount)
-	if err != nil {
-		return nil, util.OpWrap(op, err)
+// NewService returns a service validating urls with policy, a nil policy
+// is util.DefaultURLPolicy.
+func NewService(l *slog.Logger, db URLStorage, gen AliasGenerator, clicks ClickRecorder, policy *util.URLPolicy, block Blocklist, res Resolver) *URLService {
+	if policy == nil {
+		policy = util.DefaultURLPolicy()
 	}
-
 	return &URLService{
-		l:  l,
-		db: db,
-		as: as,
-	}, nil
+		l:      l,
+		db:     db,
+		gen:    gen,
+		clicks: clicks,
+		policy: policy,
+		block:  block,
+		res:    res,
+	}
+}
+
+// blocked returns the list of a blocklisted destination.
+func (s *URLService) blocked(url string) (string, bool) {
+	if s.block == nil {
+		return "", false
+	}
+	return s.block.Blocked(url)
+}
+
+// principal returns the principal of an authenticated request and answers
+// 401 to anonymous ones.
+func principal(w http.ResponseWriter, r *http.Request, l *slog.Logger) (middleware.Principal, bool) {
+	p, ok := middleware.GetPrincipal(r)
+	if !ok {
+		l.Info("anonymous request")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="link-forge"`)
+		handlers.WriteJSONLog(w, http.StatusUnauthorized, api.ResError("authentication required"), l)
+	}
+	return p, ok
 }
 
-func (s *URLService) AliasCount() uint32 {
-	return s.as.loadCount()
+// canManage reports whether p may change the url or see its stats: admins
+// may manage every url, others only the urls they own.
+func canManage(p middleware.Principal, url types.URL) bool {
+	return p.Admin || url.Owner != "" && url.Owner == p.Name
+}
+
+// managedOwner is the owner the writes of p are restricted to, empty for
+// admins who may write every url.
+func managedOwner(p middleware.Principal) string {
+	if p.Admin {
+		return ""
+	}
+	return p.Name
 }
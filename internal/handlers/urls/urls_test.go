@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,24 +20,42 @@ import (
 
 	"github.com/5aradise/link-forge/internal/database"
 	"github.com/5aradise/link-forge/internal/handlers/urls/mocks"
+	"github.com/5aradise/link-forge/internal/resolve"
 	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
 	"github.com/5aradise/link-forge/pkg/api"
 	"github.com/5aradise/link-forge/pkg/logger"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+var (
+	admin    = middleware.Principal{Name: "admin", Admin: true}
+	adminCtx = middleware.WithPrincipal(context.Background(), admin)
+
+	notAbsolute = []util.URLViolation{{Reason: util.ReasonMalformed, Detail: "url must be absolute"}}
 )
 
 func TestURLHandlers(t *testing.T) {
 	lMock := logger.NewMock()
 	sMock := mocks.NewURLStorage(t)
+	aMock := mocks.NewAliasStorage(t)
+
+	gen, _ := NewSequentialGenerator(testAlphabet, aMock, 100)
 
-	s, _ := NewService(lMock, sMock, 3)
+	clicks := &clickRecorder{}
+	s := NewService(lMock, sMock, gen, clicks, nil, nil, nil)
 
 	r := http.NewServeMux()
 	r.HandleFunc(http.MethodPost+" /", s.CreateURL)
 	r.HandleFunc(http.MethodGet+" /", s.ListURLs)
 	r.HandleFunc(http.MethodGet+" /{alias}", s.RedirectURL)
+	r.HandleFunc(http.MethodGet+" /{alias}/info", s.URLInfo)
+	r.HandleFunc(http.MethodGet+" /{alias}/stats", s.URLStats)
 	r.HandleFunc(http.MethodDelete+" /{alias}", s.DeleteURL)
+	r.HandleFunc(http.MethodPatch+" /{alias}", s.UpdateURL)
 
 	t.Run("Create", func(t *testing.T) {
+		hourAgo := time.Now().Add(-time.Hour)
 		cases := []struct {
 			name string
 			req  CreateURLRequest
@@ -80,6 +103,19 @@ func TestURLHandlers(t *testing.T) {
 				},
 				res: CreateURLResponse{
 					Response: api.ResError("invalid url"),
+					Reasons:  notAbsolute,
+				},
+				code: http.StatusBadRequest,
+			},
+			{
+				name: "Private_url",
+				req: CreateURLRequest{
+					URL:   "http://127.0.0.1:8080",
+					Alias: "private",
+				},
+				res: CreateURLResponse{
+					Response: api.ResError("invalid url"),
+					Reasons:  []util.URLViolation{{Reason: util.ReasonPrivate, Detail: "private and loopback addresses are not allowed"}},
 				},
 				code: http.StatusBadRequest,
 			},
@@ -94,6 +130,41 @@ func TestURLHandlers(t *testing.T) {
 				},
 				code: http.StatusBadRequest,
 			},
+			{
+				name: "Expired",
+				req: CreateURLRequest{
+					URL:       "http://test.com",
+					Alias:     "expired",
+					ExpiresAt: &hourAgo,
+				},
+				res: CreateURLResponse{
+					Response: api.ResError("expires_at is in the past"),
+				},
+				code: http.StatusBadRequest,
+			},
+			{
+				name: "No_clicks",
+				req: CreateURLRequest{
+					URL:       "http://test.com",
+					Alias:     "no-clicks",
+					MaxClicks: new(int64),
+				},
+				res: CreateURLResponse{
+					Response: api.ResError("max_clicks must be positive"),
+				},
+				code: http.StatusBadRequest,
+			},
+			{
+				name: "Preview_suffix",
+				req: CreateURLRequest{
+					URL:   "http://test.com",
+					Alias: "preview+",
+				},
+				res: CreateURLResponse{
+					Response: api.ResError("alias must not end with +"),
+				},
+				code: http.StatusBadRequest,
+			},
 			{
 				name: "Empty_alias_1",
 				req: CreateURLRequest{
@@ -132,12 +203,15 @@ func TestURLHandlers(t *testing.T) {
 			},
 		}
 
-		sMock.On("CreateURL", context.Background(), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
-			Return(func(ctx context.Context, alias string, url string) (types.URL, error) {
-				if alias == "identical" {
+		aMock.On("LeaseAliases", adminCtx, mock.AnythingOfType("uint32")).
+			Return(uint32(3), nil).Once()
+
+		sMock.On("CreateURL", adminCtx, mock.AnythingOfType("types.NewURL")).
+			Return(func(ctx context.Context, newURL types.NewURL) (types.URL, error) {
+				if newURL.Alias == "identical" {
 					return types.URL{}, database.ErrAliasExists
 				}
-				return types.URL{Id: 1, Alias: alias, Url: url}, nil
+				return types.URL{Id: 1, Alias: newURL.Alias, Url: newURL.Url}, nil
 			})
 
 		for _, tc := range cases {
@@ -162,36 +236,114 @@ func TestURLHandlers(t *testing.T) {
 	})
 
 	t.Run("List", func(t *testing.T) {
+		urls := []types.URL{
+			{Id: 1, Alias: "a", Url: "http://test1.com"},
+			{Id: 2, Alias: "b", Url: "http://test2.com"},
+			{Id: 3, Alias: "c", Url: "http://test3.com"},
+		}
+		total := int64(len(urls))
+
+		sMock.On("ListURLs", adminCtx, types.ListURLsParams{Limit: defaultListLimit + 1}).
+			Return(urls, nil)
+		sMock.On("ListURLs", adminCtx, types.ListURLsParams{Limit: 3}).
+			Return(urls, nil)
+		sMock.On("ListURLs", adminCtx, types.ListURLsParams{Limit: 3, After: 2}).
+			Return(urls[2:], nil)
+		sMock.On("ListURLs", adminCtx, types.ListURLsParams{
+			URLFilter: types.URLFilter{AliasPrefix: "b", Host: "test2.com"},
+			Limit:     defaultListLimit + 1,
+			Desc:      true,
+		}).
+			Return(urls[1:2], nil)
+		sMock.On("CountURLs", adminCtx, types.URLFilter{}).
+			Return(total, nil)
+		sMock.On("CountURLs", adminCtx, types.URLFilter{AliasPrefix: "b", Host: "test2.com"}).
+			Return(int64(1), nil)
+
+		one := int64(1)
 		cases := []struct {
-			name string
-			res  ListURLsResponse
-			code int
+			name  string
+			query string
+			res   ListURLsResponse
+			code  int
 		}{
 			{
 				name: "Normal",
+				res: ListURLsResponse{
+					Response:      api.ResOK(),
+					URLs:          urls,
+					TotalEstimate: &total,
+				},
+				code: http.StatusOK,
+			},
+			{
+				name:  "First_page",
+				query: "?limit=2",
+				res: ListURLsResponse{
+					Response:      api.ResOK(),
+					URLs:          urls[:2],
+					NextCursor:    encodeCursor(false, 2),
+					TotalEstimate: &total,
+				},
+				code: http.StatusOK,
+			},
+			{
+				name:  "Last_page",
+				query: "?limit=2&cursor=" + encodeCursor(false, 2),
 				res: ListURLsResponse{
 					Response: api.ResOK(),
-					URLs: []types.URL{
-						{Id: 1, Alias: "a", Url: "http://test1.com"},
-						{Id: 2, Alias: "b", Url: "http://test2.com"},
-						{Id: 3, Alias: "c", Url: "http://test3.com"}},
+					URLs:     urls[2:],
 				},
 				code: http.StatusOK,
 			},
+			{
+				name:  "Filters",
+				query: "?order=desc&alias_prefix=b&host=Test2.com",
+				res: ListURLsResponse{
+					Response:      api.ResOK(),
+					URLs:          urls[1:2],
+					TotalEstimate: &one,
+				},
+				code: http.StatusOK,
+			},
+			{
+				name:  "Invalid_limit",
+				query: "?limit=0",
+				res:   ListURLsResponse{Response: api.ResError("limit must be between 1 and 1000")},
+				code:  http.StatusBadRequest,
+			},
+			{
+				name:  "Invalid_order",
+				query: "?order=up",
+				res:   ListURLsResponse{Response: api.ResError("order must be asc or desc")},
+				code:  http.StatusBadRequest,
+			},
+			{
+				name:  "Invalid_host",
+				query: "?host=a%25b",
+				res:   ListURLsResponse{Response: api.ResError("invalid host")},
+				code:  http.StatusBadRequest,
+			},
+			{
+				name:  "Invalid_cursor",
+				query: "?cursor=abc",
+				res:   ListURLsResponse{Response: api.ResError(ErrInvalidCursor.Error())},
+				code:  http.StatusBadRequest,
+			},
+			{
+				name:  "Cursor_of_other_order",
+				query: "?order=desc&cursor=" + encodeCursor(false, 2),
+				res:   ListURLsResponse{Response: api.ResError(ErrInvalidCursor.Error())},
+				code:  http.StatusBadRequest,
+			},
 		}
 
-		sMock.On("ListURLs", context.Background()).
-			Return([]types.URL{
-				{Id: 1, Alias: "a", Url: "http://test1.com"},
-				{Id: 2, Alias: "b", Url: "http://test2.com"},
-				{Id: 3, Alias: "c", Url: "http://test3.com"}}, nil)
-
 		for _, tc := range cases {
 			t.Run(tc.name, func(t *testing.T) {
 				assert := assert.New(t)
 				require := require.New(t)
 
-				code, body, _, err := serveHTTP(r, http.MethodGet, "", []byte{})
+				code, body, _, err := serveHTTP(r, http.MethodGet, tc.query, []byte{})
 				require.NoError(err)
 
 				assert.Equal(tc.code, code)
@@ -223,11 +375,74 @@ func TestURLHandlers(t *testing.T) {
 				url:  "",
 				code: http.StatusNotFound,
 			},
+			{
+				name: "Storage_down",
+				path: "down",
+				url:  "",
+				code: http.StatusServiceUnavailable,
+			},
+			{
+				name: "Preview",
+				path: "alias+",
+				url:  "",
+				code: http.StatusOK,
+			},
+			{
+				name: "Legacy_alias_with_suffix",
+				path: "old+",
+				url:  "http://old.com/",
+				code: http.StatusFound,
+			},
+			{
+				name: "Wrong_alias_preview",
+				path: "wrong+",
+				url:  "",
+				code: http.StatusNotFound,
+			},
+			{
+				name: "Expired",
+				path: "expired",
+				url:  "",
+				code: http.StatusGone,
+			},
+			{
+				name: "Click_budget",
+				path: "budget",
+				url:  "http://budget.com/",
+				code: http.StatusFound,
+			},
+			{
+				name: "Click_budget_used",
+				path: "used",
+				url:  "",
+				code: http.StatusGone,
+			},
 		}
 
-		sMock.On("GetURLByAlias", context.Background(), "alias").
+		hourAgo := time.Now().Add(-time.Hour)
+		one := int64(1)
+		sMock.On("GetURLByAlias", adminCtx, "expired").
+			Return(types.URL{Id: 4, Alias: "expired", Url: "http://expired.com/", ExpiresAt: &hourAgo}, nil)
+		sMock.On("GetURLByAlias", adminCtx, "budget").
+			Return(types.URL{Id: 5, Alias: "budget", Url: "http://budget.com/", MaxClicks: &one}, nil)
+		sMock.On("ConsumeClick", adminCtx, "budget").
+			Return(types.URL{Id: 5, Alias: "budget", Url: "http://budget.com/", MaxClicks: &one, UsedClicks: 1}, nil)
+		sMock.On("GetURLByAlias", adminCtx, "used").
+			Return(types.URL{Id: 6, Alias: "used", Url: "http://used.com/", MaxClicks: &one}, nil)
+		sMock.On("ConsumeClick", adminCtx, "used").
+			Return(types.URL{}, database.ErrURLExpired)
+
+		sMock.On("GetURLByAlias", adminCtx, "alias").
 			Return(types.URL{Id: 1, Alias: "alias", Url: "http://test.com/"}, nil)
-		sMock.On("GetURLByAlias", context.Background(), "wrong").
+		sMock.On("GetURLByAlias", adminCtx, "wrong").
+			Return(types.URL{}, database.ErrURLUnfound)
+		sMock.On("GetURLByAlias", adminCtx, "down").
+			Return(types.URL{}, database.ErrUnavailable)
+		sMock.On("GetURLByAlias", adminCtx, "alias+").
+			Return(types.URL{}, database.ErrURLUnfound)
+		sMock.On("GetURLByAlias", adminCtx, "old+").
+			Return(types.URL{Id: 2, Alias: "old+", Url: "http://old.com/"}, nil)
+		sMock.On("GetURLByAlias", adminCtx, "wrong+").
 			Return(types.URL{}, database.ErrURLUnfound)
 
 		for _, tc := range cases {
@@ -241,6 +456,174 @@ func TestURLHandlers(t *testing.T) {
 				assert.Equal(tc.url, head.Get("Location"))
 			})
 		}
+
+		t.Run("Records_clicks", func(t *testing.T) {
+			var aliases []string
+			for _, c := range clicks.clicks {
+				aliases = append(aliases, c.Alias)
+				assert.Equal(t, "192.0.2.1", c.RemoteAddr)
+			}
+			assert.Equal(t, []string{"alias", "old+", "budget"}, aliases)
+		})
+	})
+
+	t.Run("Preview_page", func(t *testing.T) {
+		code, body, head, err := serveHTTP(r, http.MethodGet, "alias+", []byte{})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "text/html; charset=utf-8", head.Get("Content-Type"))
+		assert.Contains(t, string(body), `href="http://test.com/"`)
+	})
+
+	t.Run("Info", func(t *testing.T) {
+		clicks := int64(7)
+		cases := []struct {
+			name string
+			path string
+			code int
+			res  URLInfoResponse
+			etag string
+		}{
+			{
+				name: "Normal",
+				path: "alias/info",
+				code: http.StatusOK,
+				res: URLInfoResponse{
+					api.ResOK(),
+					&types.URL{Id: 1, Alias: "alias", Url: "http://test.com/"},
+					&clicks,
+				},
+				etag: `"0"`,
+			},
+			{
+				name: "Wrong_alias",
+				path: "wrong/info",
+				code: http.StatusNotFound,
+				res:  URLInfoResponse{Response: api.ResError("url with this alias unfound")},
+			},
+			{
+				name: "Storage_down",
+				path: "down/info",
+				code: http.StatusServiceUnavailable,
+				res:  URLInfoResponse{Response: api.ResError("storage unavailable")},
+			},
+		}
+
+		sMock.On("CountClicks", adminCtx, int64(1)).
+			Return(int64(7), nil)
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				assert := assert.New(t)
+				require := require.New(t)
+
+				code, body, head, err := serveHTTP(r, http.MethodGet, tc.path, []byte{})
+				require.NoError(err)
+
+				assert.Equal(tc.code, code)
+				assert.Equal(tc.etag, head.Get("ETag"))
+
+				var res URLInfoResponse
+				require.NoError(json.Unmarshal(body, &res))
+
+				require.Equal(tc.res, res)
+			})
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		day := func(d int) time.Time {
+			return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+		}
+		stats := types.ClickStats{
+			Clicks:    5,
+			Visitors:  2,
+			Series:    []types.ClickBucket{{Start: day(2), Clicks: 5}},
+			Referrers: []types.ClickCount{{Value: "example.com", Clicks: 5}},
+			Countries: []types.ClickCount{{Value: "", Clicks: 5}},
+			Devices:   []types.ClickCount{{Value: "mobile", Clicks: 3}, {Value: "desktop", Clicks: 2}},
+		}
+		filled := stats
+		filled.Series = []types.ClickBucket{{Start: day(1)}, {Start: day(2), Clicks: 5}, {Start: day(3)}}
+
+		cases := []struct {
+			name string
+			path string
+			code int
+			res  URLStatsResponse
+		}{
+			{
+				name: "Normal",
+				path: "alias/stats?from=2024-01-01T00:00:00Z&to=2024-01-04T00:00:00Z&top=5",
+				code: http.StatusOK,
+				res: URLStatsResponse{
+					api.ResOK(),
+					&URLStats{
+						Alias:      "alias",
+						From:       day(1),
+						To:         day(4),
+						Interval:   IntervalDay,
+						ClickStats: filled,
+					},
+				},
+			},
+			{
+				name: "Wrong_interval",
+				path: "alias/stats?interval=month",
+				code: http.StatusBadRequest,
+				res:  URLStatsResponse{Response: api.ResError("interval must be hour, day or week")},
+			},
+			{
+				name: "Wrong_range",
+				path: "alias/stats?from=2024-01-04T00:00:00Z&to=2024-01-01T00:00:00Z",
+				code: http.StatusBadRequest,
+				res:  URLStatsResponse{Response: api.ResError("from must be before to")},
+			},
+			{
+				name: "Too_many_intervals",
+				path: "alias/stats?from=2024-01-01T00:00:00Z&to=2024-03-01T00:00:00Z&interval=hour",
+				code: http.StatusBadRequest,
+				res:  URLStatsResponse{Response: api.ResError("range must have at most 1000 intervals")},
+			},
+			{
+				name: "Wrong_top",
+				path: "alias/stats?top=0",
+				code: http.StatusBadRequest,
+				res:  URLStatsResponse{Response: api.ResError("top must be between 1 and 100")},
+			},
+			{
+				name: "Wrong_alias",
+				path: "wrong/stats",
+				code: http.StatusNotFound,
+				res:  URLStatsResponse{Response: api.ResError("url with this alias unfound")},
+			},
+		}
+
+		sMock.On("ClickStats", adminCtx, types.ClickStatsParams{
+			URLID:  1,
+			From:   day(1),
+			To:     day(4),
+			Bucket: 24 * time.Hour,
+			Top:    5,
+		}).Return(stats, nil)
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				assert := assert.New(t)
+				require := require.New(t)
+
+				code, body, _, err := serveHTTP(r, http.MethodGet, tc.path, []byte{})
+				require.NoError(err)
+
+				assert.Equal(tc.code, code)
+
+				var res URLStatsResponse
+				require.NoError(json.Unmarshal(body, &res))
+
+				require.Equal(tc.res, res)
+			})
+		}
 	})
 
 	t.Run("Delete", func(t *testing.T) {
@@ -262,12 +645,20 @@ func TestURLHandlers(t *testing.T) {
 				code: http.StatusBadRequest,
 				res:  api.ResError("url with this alias unfound"),
 			},
+			{
+				name: "Storage_timeout",
+				path: "slow",
+				code: http.StatusServiceUnavailable,
+				res:  api.ResError("storage unavailable"),
+			},
 		}
 
-		sMock.On("DeleteURLByAlias", context.Background(), "alias").
+		sMock.On("DeleteURLByAlias", adminCtx, "alias", "").
 			Return(types.URL{Id: 1, Alias: "alias", Url: ""}, nil)
-		sMock.On("DeleteURLByAlias", context.Background(), "unfound").
+		sMock.On("DeleteURLByAlias", adminCtx, "unfound", "").
 			Return(types.URL{}, database.ErrURLUnfound)
+		sMock.On("DeleteURLByAlias", adminCtx, "slow", "").
+			Return(types.URL{}, database.ErrTimeout)
 
 		for _, tc := range cases {
 			t.Run(tc.name, func(t *testing.T) {
@@ -285,10 +676,898 @@ func TestURLHandlers(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Update", func(t *testing.T) {
+		updated := types.URL{Id: 1, Alias: "alias", Url: "http://new.com", Version: 3}
+		cases := []struct {
+			name    string
+			path    string
+			ifMatch string
+			req     UpdateURLRequest
+			code    int
+			res     UpdateURLResponse
+			etag    string
+		}{
+			{
+				name: "Normal",
+				path: "alias",
+				req:  UpdateURLRequest{URL: "http://new.com"},
+				code: http.StatusOK,
+				res:  UpdateURLResponse{Response: api.ResOK(), URL: &updated},
+				etag: `"3"`,
+			},
+			{
+				name: "Normalized",
+				path: "alias",
+				req:  UpdateURLRequest{URL: "HTTP://New.COM:80"},
+				code: http.StatusOK,
+				res:  UpdateURLResponse{Response: api.ResOK(), URL: &updated},
+				etag: `"3"`,
+			},
+			{
+				name:    "If_match",
+				path:    "alias",
+				ifMatch: `"2"`,
+				req:     UpdateURLRequest{URL: "http://new.com"},
+				code:    http.StatusOK,
+				res:     UpdateURLResponse{Response: api.ResOK(), URL: &updated},
+				etag:    `"3"`,
+			},
+			{
+				name:    "Outdated",
+				path:    "alias",
+				ifMatch: `"1"`,
+				req:     UpdateURLRequest{URL: "http://new.com"},
+				code:    http.StatusPreconditionFailed,
+				res:     UpdateURLResponse{Response: api.ResError("url was modified")},
+			},
+			{
+				name:    "Weak_etag",
+				path:    "alias",
+				ifMatch: `W/"2"`,
+				req:     UpdateURLRequest{URL: "http://new.com"},
+				code:    http.StatusPreconditionFailed,
+				res:     UpdateURLResponse{Response: api.ResError("url was modified")},
+			},
+			{
+				name: "Invalid_url",
+				path: "alias",
+				req:  UpdateURLRequest{URL: "new.com"},
+				code: http.StatusBadRequest,
+				res:  UpdateURLResponse{Response: api.ResError("invalid url"), Reasons: notAbsolute},
+			},
+			{
+				name: "Wrong_alias",
+				path: "unfound",
+				req:  UpdateURLRequest{URL: "http://new.com"},
+				code: http.StatusNotFound,
+				res:  UpdateURLResponse{Response: api.ResError("url with this alias unfound")},
+			},
+		}
+
+		sMock.On("UpdateURL", adminCtx, "alias", "http://new.com", int64(0), "").
+			Return(updated, nil)
+		sMock.On("UpdateURL", adminCtx, "alias", "http://new.com", int64(2), "").
+			Return(updated, nil)
+		sMock.On("UpdateURL", adminCtx, "alias", "http://new.com", int64(1), "").
+			Return(types.URL{}, database.ErrVersionMismatch)
+		sMock.On("UpdateURL", adminCtx, "unfound", "http://new.com", int64(0), "").
+			Return(types.URL{}, database.ErrURLUnfound)
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				assert := assert.New(t)
+				require := require.New(t)
+
+				reqBody, err := json.Marshal(tc.req)
+				require.NoError(err)
+
+				req := httptest.NewRequest(http.MethodPatch, "/"+tc.path, bytes.NewReader(reqBody))
+				req = req.WithContext(adminCtx)
+				if tc.ifMatch != "" {
+					req.Header.Set("If-Match", tc.ifMatch)
+				}
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+
+				assert.Equal(tc.code, rec.Code)
+				assert.Equal(tc.etag, rec.Header().Get("ETag"))
+
+				var res UpdateURLResponse
+				require.NoError(json.Unmarshal(rec.Body.Bytes(), &res))
+
+				require.Equal(tc.res, res)
+			})
+		}
+	})
+	t.Run("Ownership", func(t *testing.T) {
+		bob := middleware.Principal{Name: "bob"}
+		bobCtx := middleware.WithPrincipal(context.Background(), bob)
+		patch, err := json.Marshal(UpdateURLRequest{URL: "http://new.com"})
+		require.NoError(t, err)
+
+		cases := []struct {
+			name   string
+			as     *middleware.Principal
+			method string
+			path   string
+			body   []byte
+			code   int
+			res    api.Response
+		}{
+			{
+				name:   "Anonymous_create",
+				method: http.MethodPost,
+				body:   []byte(`{"url":"http://test.com"}`),
+				code:   http.StatusUnauthorized,
+				res:    api.ResError("authentication required"),
+			},
+			{
+				name:   "Anonymous_list",
+				method: http.MethodGet,
+				code:   http.StatusUnauthorized,
+				res:    api.ResError("authentication required"),
+			},
+			{
+				name:   "Anonymous_delete",
+				method: http.MethodDelete,
+				path:   "owned",
+				code:   http.StatusUnauthorized,
+				res:    api.ResError("authentication required"),
+			},
+			{
+				name:   "List_own",
+				as:     &bob,
+				method: http.MethodGet,
+				code:   http.StatusOK,
+				res:    api.ResOK(),
+			},
+			{
+				name:   "Delete_foreign",
+				as:     &bob,
+				method: http.MethodDelete,
+				path:   "foreign",
+				code:   http.StatusForbidden,
+				res:    api.ResError("url is owned by someone else"),
+			},
+			{
+				name:   "Delete_unowned",
+				as:     &bob,
+				method: http.MethodDelete,
+				path:   "unowned",
+				code:   http.StatusForbidden,
+				res:    api.ResError("url is owned by someone else"),
+			},
+			{
+				name:   "Update_foreign",
+				as:     &bob,
+				method: http.MethodPatch,
+				path:   "foreign",
+				body:   patch,
+				code:   http.StatusForbidden,
+				res:    api.ResError("url is owned by someone else"),
+			},
+			{
+				name:   "Stats_foreign",
+				as:     &bob,
+				method: http.MethodGet,
+				path:   "foreign/stats",
+				code:   http.StatusForbidden,
+				res:    api.ResError("url is owned by someone else"),
+			},
+			{
+				name:   "Delete_own",
+				as:     &bob,
+				method: http.MethodDelete,
+				path:   "owned",
+				code:   http.StatusOK,
+				res:    api.ResOK(),
+			},
+		}
+
+		sMock.On("ListURLs", bobCtx, types.ListURLsParams{URLFilter: types.URLFilter{Owner: "bob"}, Limit: defaultListLimit + 1}).
+			Return([]types.URL{{Id: 7, Alias: "owned", Owner: "bob"}}, nil)
+		sMock.On("CountURLs", bobCtx, types.URLFilter{Owner: "bob"}).
+			Return(int64(1), nil)
+		sMock.On("DeleteURLByAlias", bobCtx, "owned", "bob").
+			Return(types.URL{Id: 7, Alias: "owned", Owner: "bob"}, nil)
+		sMock.On("DeleteURLByAlias", bobCtx, "foreign", "bob").
+			Return(types.URL{}, database.ErrNotOwner)
+		sMock.On("DeleteURLByAlias", bobCtx, "unowned", "bob").
+			Return(types.URL{}, database.ErrNotOwner)
+		sMock.On("UpdateURL", bobCtx, "foreign", "http://new.com", int64(0), "bob").
+			Return(types.URL{}, database.ErrNotOwner)
+		sMock.On("GetURLByAlias", bobCtx, "foreign").
+			Return(types.URL{Id: 8, Alias: "foreign", Owner: "alice"}, nil)
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				assert := assert.New(t)
+				require := require.New(t)
+
+				code, body, head, err := serveHTTPAs(r, tc.as, tc.method, tc.path, tc.body)
+				require.NoError(err)
+
+				assert.Equal(tc.code, code)
+				if tc.code == http.StatusUnauthorized {
+					assert.NotEmpty(head.Get("WWW-Authenticate"))
+				}
+
+				var res api.Response
+				require.NoError(json.Unmarshal(body, &res))
+
+				require.Equal(tc.res, res)
+			})
+		}
+	})
+}
+
+type stubGenerator []string
+
+func (g *stubGenerator) NextAlias(_ context.Context) (string, error) {
+	alias := (*g)[0]
+	*g = (*g)[1:]
+	return alias, nil
+}
+
+func (g *stubGenerator) MaxLen() int {
+	return 5
+}
+
+func TestCreateURLRetry(t *testing.T) {
+	cases := []struct {
+		name    string
+		aliases []string
+		taken   int
+		res     CreateURLResponse
+		code    int
+	}{
+		{
+			name:    "Retried",
+			aliases: []string{"a", "b", "c"},
+			taken:   2,
+			res: CreateURLResponse{
+				Response: api.ResOK(),
+				Alias:    "c",
+			},
+			code: http.StatusCreated,
+		},
+		{
+			name:    "Attempts_exceeded",
+			aliases: []string{"a", "b", "c", "d", "e", "f"},
+			taken:   maxGenerateAttempts,
+			res: CreateURLResponse{
+				Response: api.ResError("failed to generate alias"),
+			},
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			sMock := mocks.NewURLStorage(t)
+			for _, alias := range tc.aliases[:tc.taken] {
+				sMock.On("CreateURL", adminCtx, types.NewURL{Alias: alias, Url: "http://test.com", Owner: "admin"}).
+					Return(types.URL{}, database.ErrAliasExists).Once()
+			}
+			if tc.taken < maxGenerateAttempts {
+				alias := tc.aliases[tc.taken]
+				sMock.On("CreateURL", adminCtx, types.NewURL{Alias: alias, Url: "http://test.com", Owner: "admin"}).
+					Return(types.URL{Id: 1, Alias: alias, Url: "http://test.com"}, nil).Once()
+			}
+
+			gen := stubGenerator(tc.aliases)
+			s := NewService(logger.NewMock(), sMock, &gen, nil, nil, nil, nil)
+
+			reqBody, err := json.Marshal(CreateURLRequest{URL: "http://test.com"})
+			require.NoError(err)
+
+			code, body, _, err := serveHTTP(http.HandlerFunc(s.CreateURL), http.MethodPost, "", reqBody)
+			require.NoError(err)
+
+			assert.Equal(tc.code, code)
+
+			var res CreateURLResponse
+			require.NoError(json.Unmarshal(body, &res))
+
+			require.Equal(tc.res, res)
+		})
+	}
+}
+
+func TestBatchCreateURLs(t *testing.T) {
+	newURL := func(alias, url string) types.NewURL {
+		return types.NewURL{Alias: alias, Url: url, Owner: "admin"}
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		reqs    []CreateURLRequest
+		aliases []string
+		setup   func(m *mocks.URLStorage)
+		code    int
+		res     BatchCreateURLsResponse
+	}{
+		{
+			name:    "All_or_nothing",
+			reqs:    []CreateURLRequest{{URL: "https://a.com", Alias: "custom-one"}, {URL: "https://b.com"}},
+			aliases: []string{"g1"},
+			setup: func(m *mocks.URLStorage) {
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("custom-one", "https://a.com"), newURL("g1", "https://b.com")}, true).
+					Return([]types.URL{{Id: 1, Alias: "custom-one"}, {Id: 2, Alias: "g1"}}, nil).Once()
+			},
+			code: http.StatusCreated,
+			res: BatchCreateURLsResponse{api.ResOK(), []CreateURLResponse{
+				{Response: api.ResOK(), Alias: "custom-one"},
+				{Response: api.ResOK(), Alias: "g1"},
+			}},
+		},
+		{
+			name: "Invalid_url_fails_batch",
+			reqs: []CreateURLRequest{{URL: "not a url"}, {URL: "https://a.com", Alias: "custom-one"}},
+			code: http.StatusBadRequest,
+			res: BatchCreateURLsResponse{api.ResError("batch has invalid urls"), []CreateURLResponse{
+				{Response: api.ResError(ErrInvalidURL.Error()), Reasons: notAbsolute},
+				{Response: api.ResError(msgBatchFailed)},
+			}},
+		},
+		{
+			name:    "Taken_alias_fails_batch",
+			reqs:    []CreateURLRequest{{URL: "https://a.com", Alias: "custom-one"}, {URL: "https://b.com"}},
+			aliases: []string{"g1"},
+			setup: func(m *mocks.URLStorage) {
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("custom-one", "https://a.com"), newURL("g1", "https://b.com")}, true).
+					Return([]types.URL{{}, {Id: 2, Alias: "g1"}}, database.ErrAliasExists).Once()
+			},
+			code: http.StatusBadRequest,
+			res: BatchCreateURLsResponse{api.ResError(msgAliasExists), []CreateURLResponse{
+				{Response: api.ResError(msgAliasExists)},
+				{Response: api.ResError(msgBatchFailed)},
+			}},
+		},
+		{
+			name:    "Generated_alias_retried",
+			reqs:    []CreateURLRequest{{URL: "https://a.com", Alias: "custom-one"}, {URL: "https://b.com"}},
+			aliases: []string{"g1", "g2"},
+			setup: func(m *mocks.URLStorage) {
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("custom-one", "https://a.com"), newURL("g1", "https://b.com")}, true).
+					Return([]types.URL{{Id: 1, Alias: "custom-one"}, {}}, database.ErrAliasExists).Once()
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("custom-one", "https://a.com"), newURL("g2", "https://b.com")}, true).
+					Return([]types.URL{{Id: 1, Alias: "custom-one"}, {Id: 2, Alias: "g2"}}, nil).Once()
+			},
+			code: http.StatusCreated,
+			res: BatchCreateURLsResponse{api.ResOK(), []CreateURLResponse{
+				{Response: api.ResOK(), Alias: "custom-one"},
+				{Response: api.ResOK(), Alias: "g2"},
+			}},
+		},
+		{
+			name:    "Best_effort",
+			path:    "?mode=best_effort",
+			reqs:    []CreateURLRequest{{URL: "not a url"}, {URL: "https://a.com", Alias: "custom-one"}, {URL: "https://b.com"}},
+			aliases: []string{"g1", "g2"},
+			setup: func(m *mocks.URLStorage) {
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("custom-one", "https://a.com"), newURL("g1", "https://b.com")}, false).
+					Return([]types.URL{{}, {}}, nil).Once()
+				m.On("CreateURLs", adminCtx, []types.NewURL{newURL("g2", "https://b.com")}, false).
+					Return([]types.URL{{Id: 2, Alias: "g2"}}, nil).Once()
+			},
+			code: http.StatusMultiStatus,
+			res: BatchCreateURLsResponse{api.ResOK(), []CreateURLResponse{
+				{Response: api.ResError(ErrInvalidURL.Error()), Reasons: notAbsolute},
+				{Response: api.ResError(msgAliasExists)},
+				{Response: api.ResOK(), Alias: "g2"},
+			}},
+		},
+		{
+			name: "Invalid_mode",
+			path: "?mode=maybe",
+			reqs: []CreateURLRequest{{URL: "https://a.com"}},
+			code: http.StatusBadRequest,
+			res:  BatchCreateURLsResponse{Response: api.ResError("mode must be all_or_nothing or best_effort")},
+		},
+		{
+			name: "Empty",
+			reqs: []CreateURLRequest{},
+			code: http.StatusBadRequest,
+			res:  BatchCreateURLsResponse{Response: api.ResError("batch must have between 1 and 1000 urls")},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			sMock := mocks.NewURLStorage(t)
+			if tc.setup != nil {
+				tc.setup(sMock)
+			}
+			gen := stubGenerator(tc.aliases)
+			s := NewService(logger.NewMock(), sMock, &gen, nil, nil, nil, nil)
+
+			reqBody, err := json.Marshal(tc.reqs)
+			require.NoError(err)
+
+			code, body, _, err := serveHTTP(http.HandlerFunc(s.BatchCreateURLs), http.MethodPost, tc.path, reqBody)
+			require.NoError(err)
+
+			assert.Equal(tc.code, code)
+
+			var res BatchCreateURLsResponse
+			require.NoError(json.Unmarshal(body, &res))
+			require.Equal(tc.res, res)
+		})
+	}
+}
+
+func TestImportURLs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("CreateURLs", adminCtx, []types.NewURL{
+		{Alias: "first-link", Url: "https://a.com", Owner: "admin"},
+		{Alias: "taken-link", Url: "https://b.com", Owner: "admin"},
+		{Alias: "g1", Url: "https://c.com", Owner: "admin"},
+		{Alias: "abc", Url: "https://e.com", Owner: "admin"},
+	}, false).Return([]types.URL{{Id: 1}, {}, {}, {Id: 3}}, nil).Once()
+	sMock.On("CreateURL", adminCtx, types.NewURL{Alias: "g2", Url: "https://c.com", Owner: "admin"}).
+		Return(types.URL{Id: 2, Alias: "g2", Url: "https://c.com"}, nil).Once()
+
+	gen := stubGenerator{"g1", "g2"}
+	s := NewService(logger.NewMock(), sMock, &gen, nil, nil, nil, nil)
+
+	csv := "url,alias\n" +
+		"https://a.com,first-link\n" +
+		"not a url,bad-link\n" +
+		"https://b.com,taken-link\n" +
+		"https://c.com,\n" +
+		"https://d.com,export\n" +
+		"https://e.com,abc\n"
+	code, body, _, err := serveHTTP(http.HandlerFunc(s.ImportURLs), http.MethodPost, "?format=csv", []byte(csv))
+	require.NoError(err)
+	assert.Equal(http.StatusOK, code)
+
+	var res ImportURLsResponse
+	require.NoError(json.Unmarshal(body, &res))
+	require.Equal(ImportURLsResponse{
+		Response: api.ResOK(),
+		ImportReport: &ImportReport{
+			Created:   3,
+			Conflicts: 1,
+			Invalid:   2,
+			Rows: []RowReport{
+				{Line: 3, Alias: "bad-link", URL: "not a url", Status: RowInvalid, Error: "invalid url: url must be absolute"},
+				{Line: 4, Alias: "taken-link", URL: "https://b.com", Status: RowConflict, Error: "alias already exists"},
+				{Line: 6, Alias: "export", URL: "https://d.com", Status: RowInvalid, Error: ErrAliasReserved.Error()},
+			},
+		},
+	}, res)
+
+	t.Run("Invalid_file", func(t *testing.T) {
+		cases := []struct {
+			name string
+			path string
+			body string
+			res  api.Response
+		}{
+			{"Unknown_format", "?format=xml", "<urls/>", api.ResError("format must be one of csv, jsonl, bitly, yourls")},
+			{"No_format", "", "url\nhttps://a.com\n", api.ResError("format must be one of csv, jsonl, bitly, yourls")},
+			{"No_url_column", "?format=yourls", "keyword,title\nabc,ABC\n", api.ResError("header has no url column")},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				code, body, _, err := serveHTTP(http.HandlerFunc(s.ImportURLs), http.MethodPost, tc.path, []byte(tc.body))
+				require.NoError(err)
+				assert.Equal(http.StatusBadRequest, code)
+
+				var res api.Response
+				require.NoError(json.Unmarshal(body, &res))
+				assert.Equal(tc.res, res)
+			})
+		}
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		code, _, _, err := serveHTTPAs(http.HandlerFunc(s.ImportURLs), nil, http.MethodPost, "?format=csv", []byte(csv))
+		require.NoError(err)
+		assert.Equal(http.StatusUnauthorized, code)
+	})
+}
+
+func TestExportURLs(t *testing.T) {
+	alice := middleware.Principal{Name: "alice"}
+	aliceCtx := middleware.WithPrincipal(context.Background(), alice)
+	createdAt := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxClicks := int64(10)
+
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("ListURLs", adminCtx, types.ListURLsParams{Limit: maxListLimit}).
+		Return([]types.URL{
+			{Id: 1, Alias: "first", Url: "https://a.com", CreatedAt: createdAt, Owner: "alice"},
+			{Id: 2, Alias: "second", Url: "https://b.com", CreatedAt: createdAt, MaxClicks: &maxClicks},
+		}, nil)
+	sMock.On("ListURLs", aliceCtx, types.ListURLsParams{URLFilter: types.URLFilter{Owner: "alice"}, Limit: maxListLimit}).
+		Return([]types.URL{
+			{Id: 1, Alias: "first", Url: "https://a.com", CreatedAt: createdAt, Owner: "alice"},
+		}, nil)
+
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, nil, nil)
+
+	cases := []struct {
+		name        string
+		p           middleware.Principal
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "CSV",
+			p:           admin,
+			path:        "?format=csv",
+			code:        http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: "alias,url,expires_at,max_clicks,owner,created_at\n" +
+				"first,https://a.com,,,alice,2024-01-01T00:00:00Z\n" +
+				"second,https://b.com,,10,,2024-01-01T00:00:00Z\n",
+		},
+		{
+			name:        "JSONL_of_owner",
+			p:           alice,
+			path:        "",
+			code:        http.StatusOK,
+			contentType: "application/jsonl",
+			body:        `{"id":1,"alias":"first","url":"https://a.com","version":0,"created_at":"2024-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","owner":"alice"}` + "\n",
+		},
+		{
+			name:        "Unknown_format",
+			p:           admin,
+			path:        "?format=bitly",
+			code:        http.StatusBadRequest,
+			contentType: "application/json",
+			body:        `{"status":"Error","error":"format must be csv or jsonl"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, body, header, err := serveHTTPAs(http.HandlerFunc(s.ExportURLs), &tc.p, http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, tc.contentType, header.Get("Content-Type"))
+			assert.Equal(t, tc.body, string(body))
+		})
+	}
+}
+
+// stubBlocklist lists hosts.
+type stubBlocklist struct {
+	hosts          []string
+	checkRedirects bool
+}
+
+func (b stubBlocklist) Blocked(url string) (string, bool) {
+	for _, host := range b.hosts {
+		if strings.Contains(url, "://"+host) {
+			return "stub", true
+		}
+	}
+	return "", false
+}
+
+func (b stubBlocklist) CheckRedirects() bool {
+	return b.checkRedirects
+}
+
+func TestAnonymousRedirect(t *testing.T) {
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("GetURLByAlias", mock.Anything, "alias").
+		Return(types.URL{Id: 1, Alias: "alias", Url: "http://test.com/"}, nil)
+
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, &clickRecorder{}, nil, nil, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /{alias}", s.RedirectURL)
+	mux.HandleFunc(http.MethodDelete+" /{alias}", s.DeleteURL)
+
+	lookup := func(_ context.Context, keyHash string) (middleware.Principal, error) {
+		if keyHash == middleware.HashKey("broken-key") {
+			return middleware.Principal{}, errors.New("connection refused")
+		}
+		return middleware.Principal{}, middleware.ErrUnknownKey
+	}
+	r := middleware.Auth(logger.NewMock(), lookup, http.MethodGet+" /{alias}")(mux)
+
+	cases := []struct {
+		name   string
+		method string
+		header string
+		code   int
+		url    string
+	}{
+		{name: "Without_key", method: http.MethodGet, code: http.StatusFound, url: "http://test.com/"},
+		{name: "Unknown_key", method: http.MethodGet, header: "Bearer stale-key", code: http.StatusFound, url: "http://test.com/"},
+		{name: "Invalid_header", method: http.MethodGet, header: "Basic dXNlcjpwYXNz", code: http.StatusFound, url: "http://test.com/"},
+		{name: "Storage_down", method: http.MethodGet, header: "Bearer broken-key", code: http.StatusFound, url: "http://test.com/"},
+		{name: "Delete_unknown_key", method: http.MethodDelete, header: "Bearer stale-key", code: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/alias", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.code, rec.Code)
+			assert.Equal(t, tc.url, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestURLInfoOfOthers(t *testing.T) {
+	url := types.URL{Id: 1, Alias: "alias", Url: "http://test.com/", UsedClicks: 3, Owner: "alice"}
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("GetURLByAlias", mock.Anything, "alias").Return(url, nil)
+	sMock.On("CountClicks", mock.Anything, int64(1)).Return(int64(3), nil)
+
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, nil, nil)
+	hidden := types.URL{Id: 1, Alias: "alias", Url: "http://test.com/"}
+	clicks := int64(3)
+
+	cases := []struct {
+		name      string
+		principal *middleware.Principal
+		res       URLInfoResponse
+	}{
+		{name: "Anonymous", res: URLInfoResponse{Response: api.ResOK(), URL: &hidden}},
+		{name: "Other_user", principal: &middleware.Principal{Name: "bob"}, res: URLInfoResponse{Response: api.ResOK(), URL: &hidden}},
+		{name: "Owner", principal: &middleware.Principal{Name: "alice"}, res: URLInfoResponse{Response: api.ResOK(), URL: &url, Clicks: &clicks}},
+		{name: "Admin", principal: &admin, res: URLInfoResponse{Response: api.ResOK(), URL: &url, Clicks: &clicks}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := http.NewServeMux()
+			r.HandleFunc(http.MethodGet+" /{alias}/info", s.URLInfo)
+
+			code, body, _, err := serveHTTPAs(r, tc.principal, http.MethodGet, "alias/info", nil)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, code)
+
+			var res URLInfoResponse
+			require.NoError(t, json.Unmarshal(body, &res))
+			assert.Equal(t, tc.res, res)
+		})
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("GetURLByAlias", mock.Anything, "listed").
+		Return(types.URL{Id: 1, Alias: "listed", Url: "https://evil.com/login"}, nil)
+	sMock.On("GetURLByAlias", mock.Anything, "listed+").
+		Return(types.URL{}, database.ErrURLUnfound)
+	sMock.On("GetURLByAlias", mock.Anything, "fine").
+		Return(types.URL{Id: 2, Alias: "fine", Url: "https://example.com"}, nil)
+
+	cases := []struct {
+		name           string
+		checkRedirects bool
+		method         string
+		path           string
+		body           string
+		code           int
+		contains       string
+	}{
+		{
+			name:     "Create",
+			method:   http.MethodPost,
+			body:     `{"url":"https://Evil.com/login","alias":"custom-one"}`,
+			code:     http.StatusBadRequest,
+			contains: `"error":"url is blocklisted"`,
+		},
+		{
+			name:     "Update",
+			method:   http.MethodPatch,
+			path:     "fine",
+			body:     `{"url":"https://evil.com"}`,
+			code:     http.StatusBadRequest,
+			contains: `"error":"url is blocklisted"`,
+		},
+		{
+			name:           "Redirect_warning",
+			checkRedirects: true,
+			method:         http.MethodGet,
+			path:           "listed",
+			code:           http.StatusForbidden,
+			contains:       "<code>https://evil.com/login</code>",
+		},
+		{
+			name:           "Preview_warning",
+			checkRedirects: true,
+			method:         http.MethodGet,
+			path:           "listed+",
+			code:           http.StatusForbidden,
+			contains:       "this link may be dangerous",
+		},
+		{
+			name:   "Redirect_unchecked",
+			method: http.MethodGet,
+			path:   "listed",
+			code:   http.StatusFound,
+		},
+		{
+			name:           "Redirect_unlisted",
+			checkRedirects: true,
+			method:         http.MethodGet,
+			path:           "fine",
+			code:           http.StatusFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, stubBlocklist{[]string{"evil.com"}, tc.checkRedirects}, nil)
+			r := http.NewServeMux()
+			r.HandleFunc(http.MethodPost+" /", s.CreateURL)
+			r.HandleFunc(http.MethodGet+" /{alias}", s.RedirectURL)
+			r.HandleFunc(http.MethodPatch+" /{alias}", s.UpdateURL)
+
+			code, body, _, err := serveHTTP(r, tc.method, tc.path, []byte(tc.body))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.code, code)
+			assert.Contains(t, string(body), tc.contains)
+		})
+	}
+}
+
+// stubResolver answers the results of urls, urls without one do not
+// redirect.
+type stubResolver map[string]resolve.Result
+
+func (r stubResolver) Resolve(_ context.Context, url string) (resolve.Result, error) {
+	if url == "https://down.com" {
+		return resolve.Result{}, errors.New("connection refused")
+	}
+	if res, ok := r[url]; ok {
+		return res, nil
+	}
+	return resolve.Result{Final: url}, nil
+}
+
+func TestResolver(t *testing.T) {
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("CreateURL", mock.Anything, mock.Anything).
+		Return(func(_ context.Context, newURL types.NewURL) (types.URL, error) {
+			return types.URL{Id: 1, Alias: newURL.Alias, Url: newURL.Url}, nil
+		})
+
+	res := stubResolver{
+		"https://short.io/a": {
+			Hops:  []string{"https://example.com/page"},
+			Final: "https://example.com/page",
+		},
+		"https://loop.com/": {
+			Hops:  []string{"https://loop.com/b", "https://loop.com/"},
+			Final: "https://loop.com/",
+			Loop:  true,
+		},
+		"https://short.io/self": {
+			Hops:          []string{"https://links.example.com/abc"},
+			Final:         "https://links.example.com/abc",
+			SelfReference: true,
+		},
+		"https://short.io/long": {
+			Hops:        []string{"https://a.com", "https://b.com"},
+			Final:       "https://b.com",
+			TooManyHops: true,
+		},
+		"https://short.io/evil": {
+			Hops:  []string{"https://evil.com/login"},
+			Final: "https://evil.com/login",
+		},
+	}
+
+	cases := []struct {
+		name string
+		url  string
+		code int
+		res  CreateURLResponse
+	}{
+		{
+			name: "No_redirect",
+			url:  "https://example.com",
+			code: http.StatusCreated,
+			res:  CreateURLResponse{Response: api.ResOK(), Alias: "No_redirect_alias"},
+		},
+		{
+			name: "Final_url",
+			url:  "https://SHORT.io/a",
+			code: http.StatusCreated,
+			res:  CreateURLResponse{Response: api.ResOK(), Alias: "Final_url_alias", FinalURL: "https://example.com/page"},
+		},
+		{
+			name: "Loop",
+			url:  "https://loop.com/",
+			code: http.StatusBadRequest,
+			res: CreateURLResponse{
+				Response: api.ResError("invalid url"),
+				Reasons:  []util.URLViolation{{Reason: util.ReasonRedirectLoop, Detail: "url redirects in a loop"}},
+			},
+		},
+		{
+			name: "Self_reference",
+			url:  "https://short.io/self",
+			code: http.StatusBadRequest,
+			res: CreateURLResponse{
+				Response: api.ResError("invalid url"),
+				Reasons:  []util.URLViolation{{Reason: util.ReasonSelfReference, Detail: "url redirects to this link shortener"}},
+			},
+		},
+		{
+			name: "Too_many_hops",
+			url:  "https://short.io/long",
+			code: http.StatusBadRequest,
+			res: CreateURLResponse{
+				Response: api.ResError("invalid url"),
+				Reasons:  []util.URLViolation{{Reason: util.ReasonTooManyHops, Detail: "url redirects more than 2 times"}},
+			},
+		},
+		{
+			name: "Blocklisted_final_url",
+			url:  "https://short.io/evil",
+			code: http.StatusBadRequest,
+			res:  CreateURLResponse{Response: api.ResError("url is blocklisted")},
+		},
+		{
+			name: "Unreachable",
+			url:  "https://down.com",
+			code: http.StatusCreated,
+			res:  CreateURLResponse{Response: api.ResOK(), Alias: "Unreachable_alias"},
+		},
+	}
+
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, stubBlocklist{[]string{"evil.com"}, false}, res)
+	r := http.NewServeMux()
+	r.HandleFunc(http.MethodPost+" /", s.CreateURL)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(CreateURLRequest{URL: tc.url, Alias: tc.name + "_alias"})
+			require.NoError(t, err)
+
+			code, body, _, err := serveHTTP(r, http.MethodPost, "", reqBody)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, code)
+
+			var res CreateURLResponse
+			require.NoError(t, json.Unmarshal(body, &res))
+			assert.Equal(t, tc.res, res)
+		})
+	}
 }
 
 func serveHTTP(r http.Handler, method, path string, reqBody []byte) (code int, body []byte, header http.Header, err error) {
+	return serveHTTPAs(r, &admin, method, path, reqBody)
+}
+
+// serveHTTPAs serves the request on behalf of p, anonymous when p is nil.
+func serveHTTPAs(r http.Handler, p *middleware.Principal, method, path string, reqBody []byte) (code int, body []byte, header http.Header, err error) {
 	req := httptest.NewRequest(method, "/"+path, bytes.NewReader(reqBody))
+	if p != nil {
+		req = req.WithContext(middleware.WithPrincipal(req.Context(), *p))
+	}
 	res := httptest.NewRecorder()
 
 	r.ServeHTTP(res, req)
@@ -297,3 +1576,187 @@ func serveHTTP(r http.Handler, method, path string, reqBody []byte) (code int, b
 
 	return res.Code, body, res.Header(), err
 }
+
+// clickRecorder keeps the recorded clicks, handlers are served one at a
+// time in the tests.
+type clickRecorder struct {
+	clicks []types.Click
+}
+
+func (r *clickRecorder) Record(c types.Click) {
+	r.clicks = append(r.clicks, c)
+}
+
+func TestResolverUpdateAndBatch(t *testing.T) {
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("UpdateURL", adminCtx, "alias", "https://short.io/a", int64(0), "").
+		Return(types.URL{Id: 1, Alias: "alias", Url: "https://short.io/a", Version: 2}, nil).Once()
+	sMock.On("CreateURLs", adminCtx, []types.NewURL{{Alias: "custom-one", Url: "https://short.io/a", Owner: "admin"}}, false).
+		Return([]types.URL{{Id: 2, Alias: "custom-one"}}, nil).Once()
+
+	res := stubResolver{
+		"https://short.io/a": {
+			Hops:  []string{"https://example.com/page"},
+			Final: "https://example.com/page",
+		},
+		"https://loop.com/": {
+			Hops:  []string{"https://loop.com/b", "https://loop.com/"},
+			Final: "https://loop.com/",
+			Loop:  true,
+		},
+		"https://short.io/evil": {
+			Hops:  []string{"https://evil.com/login"},
+			Final: "https://evil.com/login",
+		},
+	}
+	loop := []util.URLViolation{{Reason: util.ReasonRedirectLoop, Detail: "url redirects in a loop"}}
+
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, stubBlocklist{[]string{"evil.com"}, false}, res)
+	r := http.NewServeMux()
+	r.HandleFunc(http.MethodPost+" /batch", s.BatchCreateURLs)
+	r.HandleFunc(http.MethodPatch+" /{alias}", s.UpdateURL)
+
+	t.Run("Update", func(t *testing.T) {
+		cases := []struct {
+			name string
+			url  string
+			code int
+			res  UpdateURLResponse
+		}{
+			{
+				name: "Final_url",
+				url:  "https://short.io/a",
+				code: http.StatusOK,
+				res: UpdateURLResponse{
+					Response: api.ResOK(),
+					URL:      &types.URL{Id: 1, Alias: "alias", Url: "https://short.io/a", Version: 2},
+					FinalURL: "https://example.com/page",
+				},
+			},
+			{
+				name: "Loop",
+				url:  "https://loop.com/",
+				code: http.StatusBadRequest,
+				res:  UpdateURLResponse{Response: api.ResError("invalid url"), Reasons: loop},
+			},
+			{
+				name: "Blocklisted_final_url",
+				url:  "https://short.io/evil",
+				code: http.StatusBadRequest,
+				res:  UpdateURLResponse{Response: api.ResError("url is blocklisted")},
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				reqBody, err := json.Marshal(UpdateURLRequest{URL: tc.url})
+				require.NoError(t, err)
+
+				code, body, _, err := serveHTTP(r, http.MethodPatch, "alias", reqBody)
+				require.NoError(t, err)
+				assert.Equal(t, tc.code, code)
+
+				var res UpdateURLResponse
+				require.NoError(t, json.Unmarshal(body, &res))
+				assert.Equal(t, tc.res, res)
+			})
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		reqBody, err := json.Marshal([]CreateURLRequest{
+			{URL: "https://short.io/a", Alias: "custom-one"},
+			{URL: "https://loop.com/", Alias: "custom-two"},
+			{URL: "https://short.io/evil", Alias: "custom-three"},
+		})
+		require.NoError(t, err)
+
+		code, body, _, err := serveHTTP(r, http.MethodPost, "batch?mode=best_effort", reqBody)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, code)
+
+		var res BatchCreateURLsResponse
+		require.NoError(t, json.Unmarshal(body, &res))
+		assert.Equal(t, []CreateURLResponse{
+			{Response: api.ResOK(), Alias: "custom-one", FinalURL: "https://example.com/page"},
+			{Response: api.ResError("invalid url"), Reasons: loop},
+			{Response: api.ResError("url is blocklisted")},
+		}, res.Results)
+	})
+}
+
+// slowResolver never resolves before the context is done, and records how
+// many urls it resolves at once.
+type slowResolver struct {
+	mu      sync.Mutex
+	calls   int
+	running int
+	peak    int
+}
+
+func (r *slowResolver) Resolve(ctx context.Context, _ string) (resolve.Result, error) {
+	r.mu.Lock()
+	r.calls++
+	r.running++
+	r.peak = max(r.peak, r.running)
+	r.mu.Unlock()
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return resolve.Result{}, ctx.Err()
+}
+
+func TestResolverBounded(t *testing.T) {
+	prev := batchResolveTimeout
+	batchResolveTimeout = 50 * time.Millisecond
+	defer func() {
+		batchResolveTimeout = prev
+	}()
+
+	const n = 3 * batchResolvers
+	reqs := make([]CreateURLRequest, n)
+	newURLs := make([]types.NewURL, n)
+	created := make([]types.URL, n)
+	for i := range reqs {
+		alias := fmt.Sprintf("custom-%d", i)
+		reqs[i] = CreateURLRequest{URL: "https://slow.com/" + alias, Alias: alias}
+		newURLs[i] = types.NewURL{Alias: alias, Url: reqs[i].URL, Owner: "admin"}
+		created[i] = types.URL{Id: int64(i + 1), Alias: alias}
+	}
+
+	sMock := mocks.NewURLStorage(t)
+	sMock.On("CreateURLs", adminCtx, newURLs, true).Return(created, nil).Once()
+	sMock.On("CreateURLs", adminCtx, []types.NewURL{{Alias: "imported", Url: "https://slow.com/imported", Owner: "admin"}}, false).
+		Return([]types.URL{{Id: n + 1}}, nil).Once()
+
+	res := &slowResolver{}
+	s := NewService(logger.NewMock(), sMock, &stubGenerator{}, nil, nil, nil, res)
+
+	t.Run("Batch", func(t *testing.T) {
+		reqBody, err := json.Marshal(reqs)
+		require.NoError(t, err)
+
+		start := time.Now()
+		code, _, _, err := serveHTTP(http.HandlerFunc(s.BatchCreateURLs), http.MethodPost, "", reqBody)
+		require.NoError(t, err)
+
+		// Urls not resolved in time are created like unreachable ones,
+		// after one deadline for the whole batch.
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, n, res.calls)
+		assert.LessOrEqual(t, res.peak, batchResolvers)
+	})
+
+	t.Run("Import_not_resolved", func(t *testing.T) {
+		calls := res.calls
+		code, _, _, err := serveHTTP(http.HandlerFunc(s.ImportURLs), http.MethodPost, "?format=csv", []byte("url,alias\nhttps://slow.com/imported,imported\n"))
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, calls, res.calls)
+	})
+}
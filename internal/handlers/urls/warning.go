@@ -0,0 +1,34 @@
+package urls
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+// warningTemplate is shown instead of redirecting to a blocklisted
+// destination. The destination is not linked.
+var warningTemplate = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Dangerous link | {{.Alias}}</title>
+  </head>
+  <body>
+    <h1>Warning: this link may be dangerous</h1>
+    <p>{{.Alias}} leads to a site reported for phishing or malware, so you were not redirected.</p>
+    <p>Destination: <code>{{.Url}}</code></p>
+  </body>
+</html>`))
+
+func renderWarning(url types.URL) (string, error) {
+	var b strings.Builder
+	err := warningTemplate.Execute(&b, url)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
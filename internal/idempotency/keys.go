@@ -0,0 +1,243 @@
+// Package idempotency makes retried POST requests safe: a request sent
+// again with the same Idempotency-Key header gets the stored response of
+// the first one instead of being handled twice.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/handlers"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/api"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLen = 255
+	// maxBodySize bounds the bodies read to be hashed.
+	maxBodySize = 1 << 20
+	// maxClaimAttempts bounds the claims of a key released meanwhile.
+	maxClaimAttempts = 3
+)
+
+// Storage keeps the requests made with a key per owner.
+type Storage interface {
+	ClaimIdempotencyKey(ctx context.Context, req types.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (types.IdempotentRequest, bool, error)
+	// CompleteIdempotencyKey and DeleteIdempotencyKey leave a key claimed
+	// again by another request alone.
+	CompleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest, statusCode int, response []byte) error
+	DeleteIdempotencyKey(ctx context.Context, claim types.IdempotentRequest) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Keys remembers the responses of requests made with a key for ttl. Keys
+// are scoped to the principal, anonymous requests are not deduplicated. A
+// request still in progress after lease is taken for abandoned, its key
+// may be claimed again.
+type Keys struct {
+	l       *slog.Logger
+	storage Storage
+	ttl     time.Duration
+	lease   time.Duration
+
+	// lastPurge is the unix nano time expired keys were last removed at.
+	lastPurge atomic.Int64
+}
+
+func New(l *slog.Logger, storage Storage, ttl, lease time.Duration) *Keys {
+	return &Keys{
+		l:       l,
+		storage: storage,
+		ttl:     ttl,
+		lease:   lease,
+	}
+}
+
+// Wrap replays the stored response when a request is made again with the
+// same key and body. A key reused with another body gets 422, a key whose
+// first request is still handled gets 409. Responses with a 5xx status are
+// not stored, nor are the ones of handlers that panic, so the request can
+// be retried.
+func (k *Keys) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "idempotency.wrap"
+
+		key := r.Header.Get(Header)
+		p, ok := middleware.GetPrincipal(r)
+		if key == "" || !ok {
+			next(w, r)
+			return
+		}
+
+		l := k.l.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetRequestID(r)),
+			slog.String("idempotency_key", key),
+		)
+
+		if len(key) > maxKeyLen {
+			l.Info("invalid idempotency key", slog.Int("length", len(key)))
+			handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError("idempotency key must be at most 255 characters"), l)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			errMsg := "failed to read request body"
+			l.Info(errMsg, util.SlErr(err))
+			handlers.WriteJSONLog(w, http.StatusBadRequest, api.ResError(errMsg), l)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(r, body)
+		now := time.Now()
+		k.purge(r.Context(), now)
+
+		stored, claimed, err := k.claim(r.Context(), types.IdempotentRequest{
+			Owner:       p.Name,
+			Key:         key,
+			RequestHash: hash,
+			CreatedAt:   now,
+		}, now)
+		if errors.Is(err, database.ErrKeyReleased) {
+			l.Info("idempotency key released while claimed", util.SlErr(err))
+			handlers.WriteJSONLog(w, http.StatusConflict, api.ResError("request with this idempotency key is in progress"), l)
+			return
+		}
+		if err != nil {
+			l.Error("failed to claim idempotency key", util.SlErr(err))
+			handlers.WriteStorageErrorLog(w, err, "failed to claim idempotency key", l)
+			return
+		}
+
+		if !claimed {
+			switch {
+			case stored.RequestHash != hash:
+				l.Info("idempotency key reused with a different request")
+				handlers.WriteJSONLog(w, http.StatusUnprocessableEntity, api.ResError("idempotency key reused with a different request"), l)
+			case stored.StatusCode == 0:
+				l.Info("request with idempotency key in progress")
+				handlers.WriteJSONLog(w, http.StatusConflict, api.ResError("request with this idempotency key is in progress"), l)
+			default:
+				l.Info("response replayed", slog.Int("status", stored.StatusCode))
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(stored.StatusCode)
+				_, err = w.Write(stored.Response)
+				if err != nil {
+					l.Error("failed to write response", util.SlErr(err))
+				}
+			}
+			return
+		}
+
+		// The request is done, a canceled client must not leave the key
+		// claimed.
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			// A panicking handler leaves no response to replay, the
+			// panic goes on to the recoverer.
+			if !completed {
+				k.release(ctx, l, stored)
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(rec, r)
+
+		if rec.statusCode >= http.StatusInternalServerError {
+			return
+		}
+		completed = true
+		// The claim as stored tells whether the key was claimed again by
+		// the time the handler is done.
+		err = k.storage.CompleteIdempotencyKey(ctx, stored, rec.statusCode, rec.body.Bytes())
+		if err != nil {
+			l.Error("failed to store idempotent response", util.SlErr(err))
+		}
+	}
+}
+
+// claim claims the key of req. A key released between a failed claim and
+// the read of the request holding it is claimed again, up to
+// maxClaimAttempts times.
+func (k *Keys) claim(ctx context.Context, req types.IdempotentRequest, now time.Time) (types.IdempotentRequest, bool, error) {
+	for attempt := 1; ; attempt++ {
+		stored, claimed, err := k.storage.ClaimIdempotencyKey(ctx, req, now.Add(-k.ttl), now.Add(-k.lease))
+		if errors.Is(err, database.ErrKeyReleased) && attempt < maxClaimAttempts {
+			continue
+		}
+		return stored, claimed, err
+	}
+}
+
+// release deletes the key of a claim, so the request can be retried.
+func (k *Keys) release(ctx context.Context, l *slog.Logger, claim types.IdempotentRequest) {
+	err := k.storage.DeleteIdempotencyKey(ctx, claim)
+	if err != nil {
+		l.Error("failed to release idempotency key", util.SlErr(err))
+	}
+}
+
+// purge removes the expired keys, at most once per ttl.
+func (k *Keys) purge(ctx context.Context, now time.Time) {
+	last := k.lastPurge.Load()
+	if now.UnixNano()-last < int64(k.ttl) || !k.lastPurge.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	n, err := k.storage.DeleteExpiredIdempotencyKeys(ctx, now.Add(-k.ttl))
+	if err != nil {
+		k.l.Error("failed to remove expired idempotency keys", util.SlErr(err))
+		return
+	}
+	if n > 0 {
+		k.l.Info("expired idempotency keys removed", slog.Int64("count", n))
+	}
+}
+
+// requestHash tells requests with the same key apart.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder keeps a copy of the response written through it.
+type recorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.statusCode = statusCode
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,319 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/database/memory"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/pkg/logger"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+func TestWrap(t *testing.T) {
+	alice := middleware.Principal{Name: "alice"}
+	bob := middleware.Principal{Name: "bob"}
+
+	type request struct {
+		principal *middleware.Principal
+		key       string
+		body      string
+
+		statusCode int
+		response   string
+		replayed   bool
+	}
+
+	cases := []struct {
+		name string
+		// fail makes the handler answer 500 to its first call.
+		fail     bool
+		requests []request
+	}{
+		{
+			name: "replay",
+			requests: []request{
+				{principal: &alice, key: "k1", body: `{"url":"https://go.dev"}`, statusCode: http.StatusCreated, response: `{"call":1}`},
+				{principal: &alice, key: "k1", body: `{"url":"https://go.dev"}`, statusCode: http.StatusCreated, response: `{"call":1}`, replayed: true},
+				{principal: &alice, key: "k2", body: `{"url":"https://go.dev"}`, statusCode: http.StatusCreated, response: `{"call":2}`},
+			},
+		},
+		{
+			name: "different_body",
+			requests: []request{
+				{principal: &alice, key: "k1", body: `{"url":"https://go.dev"}`, statusCode: http.StatusCreated, response: `{"call":1}`},
+				{principal: &alice, key: "k1", body: `{"url":"https://go.dev/doc"}`, statusCode: http.StatusUnprocessableEntity},
+			},
+		},
+		{
+			name: "scoped_to_principal",
+			requests: []request{
+				{principal: &alice, key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":1}`},
+				{principal: &bob, key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":2}`},
+			},
+		},
+		{
+			name: "without_key_or_principal",
+			requests: []request{
+				{principal: &alice, body: `{}`, statusCode: http.StatusCreated, response: `{"call":1}`},
+				{principal: &alice, body: `{}`, statusCode: http.StatusCreated, response: `{"call":2}`},
+				{key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":3}`},
+				{key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":4}`},
+			},
+		},
+		{
+			name: "server_error_not_stored",
+			fail: true,
+			requests: []request{
+				{principal: &alice, key: "k1", body: `{}`, statusCode: http.StatusInternalServerError, response: `{"call":1}`},
+				{principal: &alice, key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":2}`},
+				{principal: &alice, key: "k1", body: `{}`, statusCode: http.StatusCreated, response: `{"call":2}`, replayed: true},
+			},
+		},
+		{
+			name: "key_too_long",
+			requests: []request{
+				{principal: &alice, key: strings.Repeat("k", maxKeyLen+1), body: `{}`, statusCode: http.StatusBadRequest},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := memory.Open("")
+			require.NoError(t, err)
+
+			calls := 0
+			handler := New(logger.NewMock(), db, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				statusCode := http.StatusCreated
+				if tc.fail && calls == 1 {
+					statusCode = http.StatusInternalServerError
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(statusCode)
+				fmt.Fprintf(w, `{"call":%d}`, calls)
+			})
+
+			for i, req := range tc.requests {
+				r := httptest.NewRequest(http.MethodPost, "/urls", strings.NewReader(req.body))
+				if req.key != "" {
+					r.Header.Set(Header, req.key)
+				}
+				if req.principal != nil {
+					r = r.WithContext(middleware.WithPrincipal(r.Context(), *req.principal))
+				}
+				w := httptest.NewRecorder()
+				handler(w, r)
+
+				assert.Equal(t, req.statusCode, w.Code, "request %d", i)
+				if req.response != "" {
+					assert.Equal(t, req.response, w.Body.String(), "request %d", i)
+				}
+				if req.replayed {
+					assert.Equal(t, "true", w.Header().Get(ReplayedHeader), "request %d", i)
+				} else {
+					assert.Empty(t, w.Header().Get(ReplayedHeader), "request %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapInProgress(t *testing.T) {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	keys := New(logger.NewMock(), db, time.Hour, time.Minute)
+
+	ctx := middleware.WithPrincipal(context.Background(), middleware.Principal{Name: "alice"})
+	newRequest := func() *http.Request {
+		r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/urls", strings.NewReader(`{}`))
+		r.Header.Set(Header, "k1")
+		return r
+	}
+
+	var inner *httptest.ResponseRecorder
+	handler := keys.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		// The first request is still handled when the retry comes.
+		inner = httptest.NewRecorder()
+		keys.Wrap(func(http.ResponseWriter, *http.Request) {
+			t.Error("retry handled while the first request is in progress")
+		})(inner, newRequest())
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler(httptest.NewRecorder(), newRequest())
+
+	require.NotNil(t, inner)
+	assert.Equal(t, http.StatusConflict, inner.Code)
+}
+
+func TestWrapPanic(t *testing.T) {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	keys := New(logger.NewMock(), db, time.Hour, time.Minute)
+
+	ctx := middleware.WithPrincipal(context.Background(), middleware.Principal{Name: "alice"})
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/urls", strings.NewReader(`{}`))
+		r.Header.Set(Header, "k1")
+		w := httptest.NewRecorder()
+		keys.Wrap(h)(w, r)
+		return w
+	}
+
+	assert.PanicsWithValue(t, "boom", func() {
+		serve(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})
+	})
+
+	// The key is released, the retry is handled.
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(ReplayedHeader))
+}
+
+func TestWrapAbandoned(t *testing.T) {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	lease := time.Minute
+	keys := New(logger.NewMock(), db, time.Hour, lease)
+
+	// A request whose server died while handling it.
+	ctx := context.Background()
+	_, claimed, err := db.ClaimIdempotencyKey(ctx, types.IdempotentRequest{
+		Owner:       "alice",
+		Key:         "k1",
+		RequestHash: requestHash(httptest.NewRequest(http.MethodPost, "/urls", nil), []byte(`{}`)),
+		CreatedAt:   time.Now().Add(-2 * lease),
+	}, time.Now().Add(-time.Hour), time.Now().Add(-lease))
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	r := httptest.NewRequestWithContext(middleware.WithPrincipal(ctx, middleware.Principal{Name: "alice"}), http.MethodPost, "/urls", strings.NewReader(`{}`))
+	r.Header.Set(Header, "k1")
+	w := httptest.NewRecorder()
+	keys.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})(w, r)
+
+	assert.Equal(t, http.StatusCreated, w.Code, "an abandoned request is handled again")
+}
+
+func TestWrapOutlivesLease(t *testing.T) {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	keys := New(logger.NewMock(), db, time.Hour, time.Millisecond)
+
+	ctx := middleware.WithPrincipal(context.Background(), middleware.Principal{Name: "alice"})
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/urls", strings.NewReader(`{}`))
+		r.Header.Set(Header, "k1")
+		w := httptest.NewRecorder()
+		keys.Wrap(h)(w, r)
+		return w
+	}
+	answer := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, body)
+		}
+	}
+
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		// The retry comes once the lease is over and claims the key.
+		time.Sleep(5 * time.Millisecond)
+		w2 := serve(answer(`{"call":2}`))
+		require.Equal(t, http.StatusCreated, w2.Code)
+		require.Empty(t, w2.Header().Get(ReplayedHeader))
+
+		answer(`{"call":1}`)(w, r)
+	})
+
+	w := serve(answer(`{"call":3}`))
+	assert.Equal(t, "true", w.Header().Get(ReplayedHeader))
+	assert.Equal(t, `{"call":2}`, w.Body.String(), "the late first request leaves the retry alone")
+}
+
+// releasingStorage fails the first claims as if the key was released
+// between the claim and the read of the request holding it.
+type releasingStorage struct {
+	*memory.DB
+	released int
+}
+
+func (s *releasingStorage) ClaimIdempotencyKey(ctx context.Context, req types.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (types.IdempotentRequest, bool, error) {
+	if s.released > 0 {
+		s.released--
+		return types.IdempotentRequest{}, false, database.ErrKeyReleased
+	}
+	return s.DB.ClaimIdempotencyKey(ctx, req, expiredBefore, abandonedBefore)
+}
+
+func TestWrapReleased(t *testing.T) {
+	cases := []struct {
+		name     string
+		released int
+		code     int
+	}{
+		{"Claimed_again", maxClaimAttempts - 1, http.StatusCreated},
+		{"Still_released", maxClaimAttempts, http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := memory.Open("")
+			require.NoError(t, err)
+			keys := New(logger.NewMock(), &releasingStorage{db, tc.released}, time.Hour, time.Minute)
+
+			ctx := middleware.WithPrincipal(context.Background(), middleware.Principal{Name: "alice"})
+			r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/urls", strings.NewReader(`{}`))
+			r.Header.Set(Header, "k1")
+			w := httptest.NewRecorder()
+			keys.Wrap(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			})(w, r)
+
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	db, err := memory.Open("")
+	require.NoError(t, err)
+	ttl := time.Hour
+	keys := New(logger.NewMock(), db, ttl, time.Minute)
+
+	ctx := context.Background()
+	now := time.Now()
+	keys.purge(ctx, now)
+
+	old := types.IdempotentRequest{Owner: "alice", Key: "k1", CreatedAt: now.Add(-2 * ttl)}
+	_, claimed, err := db.ClaimIdempotencyKey(ctx, old, now.Add(-3*ttl), now.Add(-3*ttl))
+	require.NoError(t, err)
+	require.True(t, claimed)
+	stored := func() bool {
+		_, claimed, err := db.ClaimIdempotencyKey(ctx, old, now.Add(-3*ttl), now.Add(-3*ttl))
+		require.NoError(t, err)
+		return !claimed
+	}
+
+	// Within the ttl of the last purge nothing is removed.
+	keys.purge(ctx, now.Add(ttl/2))
+	assert.True(t, stored())
+
+	keys.purge(ctx, now.Add(ttl))
+	assert.False(t, stored())
+}
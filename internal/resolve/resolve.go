@@ -0,0 +1,169 @@
+// Package resolve follows the redirects of a destination to find where it
+// finally leads, catching loops and chains through the shortener itself.
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/util"
+)
+
+const userAgent = "link-forge"
+
+var ErrPrivateAddr = errors.New("destination resolves to a private address")
+
+// Result is the redirect chain of a url.
+type Result struct {
+	// Hops are the urls redirected to, in order, the first one excluded.
+	Hops []string
+	// Final is the url the chain ends at, the url itself without
+	// redirects.
+	Final string
+	// Loop is set when a url of the chain redirects back to an earlier
+	// one.
+	Loop bool
+	// SelfReference is set when the chain redirects to the shortener, the
+	// chain is not followed further.
+	SelfReference bool
+	// TooManyHops is set when the chain was longer than the hops allowed.
+	TooManyHops bool
+}
+
+// Resolver follows redirects with GET requests, reading no bodies.
+type Resolver struct {
+	client  *http.Client
+	maxHops int
+	timeout time.Duration
+	self    []string
+}
+
+// New returns a resolver following up to maxHops redirects within timeout.
+// Redirects to the self hosts, the public hostnames of the server, are not
+// followed. Unless allowPrivate is set connections to private and loopback
+// addresses are refused, so links cannot probe the network of the server.
+func New(maxHops int, timeout time.Duration, self []string, allowPrivate bool) *Resolver {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Resolver{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxHops: maxHops,
+		timeout: timeout,
+		self:    util.NormalizeHosts(self),
+	}
+}
+
+// Resolve follows the redirects of rawURL. A chain cut short by a loop, a
+// self reference or too many hops is no error, Result tells which.
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (Result, error) {
+	const op = "resolve.Resolve"
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, util.OpWrap(op, err)
+	}
+	res := Result{Final: current.String()}
+	seen := map[string]bool{current.String(): true}
+
+	for {
+		next, err := r.next(ctx, current)
+		if err != nil {
+			return res, util.OpWrap(op, err)
+		}
+		if next == nil {
+			return res, nil
+		}
+
+		if len(res.Hops) == r.maxHops {
+			res.TooManyHops = true
+			return res, nil
+		}
+		res.Hops = append(res.Hops, next.String())
+		res.Final = next.String()
+
+		if seen[next.String()] {
+			res.Loop = true
+			return res, nil
+		}
+		seen[next.String()] = true
+
+		if r.isSelf(next) {
+			res.SelfReference = true
+			return res, nil
+		}
+		current = next
+	}
+}
+
+// next requests u and returns the url it redirects to, nil if it does not.
+func (r *Resolver) next(ctx context.Context, u *url.URL) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	next, err := u.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location %q: %w", location, err)
+	}
+	if next.Scheme != "http" && next.Scheme != "https" {
+		return nil, nil
+	}
+	next.Fragment = ""
+	return next, nil
+}
+
+func (r *Resolver) isSelf(u *url.URL) bool {
+	host := util.NormalizeHosts([]string{u.Host})
+	return len(host) == 1 && slices.Contains(r.self, host[0])
+}
+
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if util.IsPrivateAddr(addrPort.Addr().Unmap()) {
+		return ErrPrivateAddr
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package resolve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redirects serves a redirect to the location of each path, paths without
+// one answer 200.
+func redirects(t *testing.T, locations map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, userAgent, r.UserAgent())
+		if location, ok := locations[r.URL.Path]; ok {
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+		w.Write([]byte("final"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolve(t *testing.T) {
+	final := redirects(t, nil)
+	chain := redirects(t, map[string]string{
+		"/direct": final.URL + "/page",
+		"/two":    "/direct",
+		"/loop":   "/loop2",
+		"/loop2":  "/loop",
+		"/self":   "https://short.example.com:8443/abc",
+		"/long":   "/long2",
+		"/long2":  "/long3",
+		"/long3":  "/long4",
+		"/long4":  "/done",
+	})
+
+	cases := map[string]struct {
+		path string
+		want Result
+	}{
+		"no_redirect": {
+			path: "/done",
+			want: Result{Final: chain.URL + "/done"},
+		},
+		"to_other_server": {
+			path: "/two",
+			want: Result{
+				Hops:  []string{chain.URL + "/direct", final.URL + "/page"},
+				Final: final.URL + "/page",
+			},
+		},
+		"loop": {
+			path: "/loop",
+			want: Result{
+				Hops:  []string{chain.URL + "/loop2", chain.URL + "/loop"},
+				Final: chain.URL + "/loop",
+				Loop:  true,
+			},
+		},
+		"self_reference": {
+			path: "/self",
+			want: Result{
+				Hops:          []string{"https://short.example.com:8443/abc"},
+				Final:         "https://short.example.com:8443/abc",
+				SelfReference: true,
+			},
+		},
+		"too_many_hops": {
+			path: "/long",
+			want: Result{
+				Hops:        []string{chain.URL + "/long2", chain.URL + "/long3", chain.URL + "/long4"},
+				Final:       chain.URL + "/long4",
+				TooManyHops: true,
+			},
+		},
+	}
+
+	r := New(3, time.Second, []string{"short.example.com"}, true)
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := r.Resolve(context.Background(), chain.URL+tc.path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestResolvePrivate(t *testing.T) {
+	srv := redirects(t, nil)
+
+	_, err := New(3, time.Second, nil, false).Resolve(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrPrivateAddr)
+}
+
+func TestResolveTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	_, err := New(3, 10*time.Millisecond, nil, true).Resolve(context.Background(), slow.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	goosedb "github.com/pressly/goose/v3/database"
+
+	"github.com/5aradise/link-forge/internal/analytics"
+	"github.com/5aradise/link-forge/internal/auth"
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/database/memory"
+	"github.com/5aradise/link-forge/internal/database/postgres"
+	"github.com/5aradise/link-forge/internal/expiry"
+	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/idempotency"
+	"github.com/5aradise/link-forge/internal/util"
+	"github.com/5aradise/link-forge/pkg/middleware"
+	pgschema "github.com/5aradise/link-forge/sql/postgres/schema"
+	"github.com/5aradise/link-forge/sql/schema"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/tursodatabase/libsql-client-go/libsql"
+)
+
+const (
+	DriverLibSQL   = "libsql"
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "pgx"
+	DriverMemory   = "memory"
+)
+
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateReset  = "reset"
+	MigrateStatus = "status"
+)
+
+var (
+	ErrUnknownDriver  = errors.New("unknown database driver")
+	ErrUnknownCommand = fmt.Errorf("unknown migrate command, expected one of: %s, %s, %s, %s", MigrateUp, MigrateDown, MigrateReset, MigrateStatus)
+)
+
+// Storage is everything the service needs from a database.
+type Storage interface {
+	urls.URLStorage
+	urls.AliasStorage
+	expiry.Storage
+	analytics.Storage
+	auth.Storage
+	idempotency.Storage
+	middleware.RateLimitStore
+	// Migrate runs a migration command against the database and logs
+	// the outcome of every migration it touches.
+	Migrate(ctx context.Context, l *slog.Logger, command string) error
+	Close() error
+}
+
+// Driver picks the driver by the scheme of the database url:
+// libsql://, http(s):// and ws(s):// go to libsql (Turso),
+// postgres:// and postgresql:// go to pgx (PostgreSQL),
+// memory:// keeps everything in process memory,
+// sqlite:// and everything else is a local sqlite3 file.
+func Driver(dbURL string) string {
+	scheme, _, ok := strings.Cut(dbURL, "://")
+	if !ok {
+		return DriverSQLite
+	}
+
+	switch strings.ToLower(scheme) {
+	case "libsql", "http", "https", "ws", "wss":
+		return DriverLibSQL
+	case "postgres", "postgresql":
+		return DriverPostgres
+	case "memory":
+		return DriverMemory
+	default:
+		return DriverSQLite
+	}
+}
+
+// Open connects to the database at dbURL. The driver is picked by Driver
+// unless it is set explicitly.
+func Open(dbURL, driver string) (Storage, error) {
+	const op = "storage.Open"
+
+	if driver == "" {
+		driver = Driver(dbURL)
+	}
+
+	if driver == DriverMemory {
+		db, err := memory.Open(trimScheme(dbURL, "memory://"))
+		if err != nil {
+			return nil, util.OpWrap(op, err)
+		}
+		return memoryStorage{db}, nil
+	}
+
+	var (
+		dialect  goose.Dialect
+		schemaFS fs.FS
+	)
+	switch driver {
+	case DriverLibSQL:
+		dialect, schemaFS = goosedb.DialectTurso, schema.FS
+	case DriverSQLite:
+		dialect, schemaFS = goose.DialectSQLite3, schema.FS
+		dbURL = trimScheme(dbURL, "sqlite3://", "sqlite://")
+	case DriverPostgres:
+		dialect, schemaFS = goose.DialectPostgres, pgschema.FS
+	default:
+		return nil, util.OpWrap(op, fmt.Errorf("%w: %s", ErrUnknownDriver, driver))
+	}
+
+	conn, err := sql.Open(driver, dbURL)
+	if err != nil {
+		return nil, util.OpWrap(op, err)
+	}
+
+	var db backend
+	if driver == DriverPostgres {
+		db = postgres.Create(conn)
+	} else {
+		db = database.Create(conn)
+	}
+
+	return &sqlStorage{
+		backend: db,
+		conn:    conn,
+		dialect: dialect,
+		schema:  schemaFS,
+	}, nil
+}
+
+// backend is a sqlc adapter of one of the supported databases.
+type backend interface {
+	urls.URLStorage
+	urls.AliasStorage
+	expiry.Storage
+	analytics.Storage
+	auth.Storage
+	idempotency.Storage
+	middleware.RateLimitStore
+}
+
+type sqlStorage struct {
+	backend
+	conn    *sql.DB
+	dialect goose.Dialect
+	schema  fs.FS
+}
+
+func (s *sqlStorage) Migrate(ctx context.Context, l *slog.Logger, command string) error {
+	const op = "storage.Migrate"
+
+	provider, err := goose.NewProvider(s.dialect, s.conn, s.schema)
+	if err != nil {
+		return util.OpWrap(op, err)
+	}
+
+	switch command {
+	case MigrateUp:
+		results, err := provider.Up(ctx)
+		for _, res := range results {
+			logMigration(l, res)
+		}
+		if err != nil {
+			return util.OpWrap(op, err)
+		}
+		if len(results) == 0 {
+			l.Info("no pending migrations")
+		}
+	case MigrateDown:
+		res, err := provider.Down(ctx)
+		if res != nil {
+			logMigration(l, res)
+		}
+		if err != nil {
+			return util.OpWrap(op, err)
+		}
+	case MigrateReset:
+		results, err := provider.DownTo(ctx, 0)
+		for _, res := range results {
+			logMigration(l, res)
+		}
+		if err != nil {
+			return util.OpWrap(op, err)
+		}
+	case MigrateStatus:
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return util.OpWrap(op, err)
+		}
+		for _, st := range statuses {
+			attrs := []any{
+				slog.Int64("version", st.Source.Version),
+				slog.String("path", st.Source.Path),
+				slog.String("state", string(st.State)),
+			}
+			if !st.AppliedAt.IsZero() {
+				attrs = append(attrs, slog.String("applied_at", st.AppliedAt.Format(time.RFC3339)))
+			}
+			l.Info("migration status", attrs...)
+		}
+	default:
+		return util.OpWrap(op, ErrUnknownCommand)
+	}
+	return nil
+}
+
+func (s *sqlStorage) Close() error {
+	return s.conn.Close()
+}
+
+// memoryStorage has no schema, so there is nothing to migrate. The path of
+// memory:// url is the snapshot file written on Close.
+type memoryStorage struct {
+	*memory.DB
+}
+
+func (memoryStorage) Migrate(_ context.Context, l *slog.Logger, command string) error {
+	const op = "storage.Migrate"
+
+	switch command {
+	case MigrateUp, MigrateDown, MigrateReset, MigrateStatus:
+		l.Info("memory storage has no migrations")
+		return nil
+	default:
+		return util.OpWrap(op, ErrUnknownCommand)
+	}
+}
+
+func logMigration(l *slog.Logger, res *goose.MigrationResult) {
+	attrs := []any{
+		slog.Int64("version", res.Source.Version),
+		slog.String("path", res.Source.Path),
+		slog.String("direction", res.Direction),
+		slog.Duration("duration", res.Duration),
+	}
+	if res.Error != nil {
+		l.Error("migration failed", append(attrs, util.SlErr(res.Error))...)
+		return
+	}
+	l.Info("migration applied", attrs...)
+}
+
+func trimScheme(dbURL string, schemes ...string) string {
+	for _, scheme := range schemes {
+		if path, ok := strings.CutPrefix(dbURL, scheme); ok {
+			return path
+		}
+	}
+	return dbURL
+}
@@ -0,0 +1,666 @@
+// Package storagetest is the behavioral test suite every storage backend
+// has to pass.
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/analytics"
+	"github.com/5aradise/link-forge/internal/auth"
+	"github.com/5aradise/link-forge/internal/database"
+	"github.com/5aradise/link-forge/internal/expiry"
+	"github.com/5aradise/link-forge/internal/handlers/urls"
+	"github.com/5aradise/link-forge/internal/idempotency"
+	"github.com/5aradise/link-forge/internal/types"
+	"github.com/5aradise/link-forge/pkg/middleware"
+)
+
+type Storage interface {
+	urls.URLStorage
+	urls.AliasStorage
+	expiry.Storage
+	analytics.Storage
+	auth.Storage
+	idempotency.Storage
+	middleware.RateLimitStore
+}
+
+// Run runs the suite, newStorage must return an empty migrated storage
+// on every call.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Run("URLs", func(t *testing.T) {
+		testURLs(t, newStorage(t))
+	})
+	t.Run("Batch", func(t *testing.T) {
+		testBatch(t, newStorage(t))
+	})
+	t.Run("Update", func(t *testing.T) {
+		testUpdate(t, newStorage(t))
+	})
+	t.Run("List", func(t *testing.T) {
+		testList(t, newStorage(t))
+	})
+	t.Run("Expiry", func(t *testing.T) {
+		testExpiry(t, newStorage(t))
+	})
+	t.Run("Clicks", func(t *testing.T) {
+		testClicks(t, newStorage(t))
+	})
+	t.Run("Click_stats", func(t *testing.T) {
+		testClickStats(t, newStorage(t))
+	})
+	t.Run("API_keys", func(t *testing.T) {
+		testAPIKeys(t, newStorage(t))
+	})
+	t.Run("Owners", func(t *testing.T) {
+		testOwners(t, newStorage(t))
+	})
+	t.Run("Idempotency_keys", func(t *testing.T) {
+		testIdempotencyKeys(t, newStorage(t))
+	})
+	t.Run("Rate_limits", func(t *testing.T) {
+		testRateLimits(t, newStorage(t))
+	})
+	t.Run("Lease", func(t *testing.T) {
+		testLease(t, newStorage(t))
+	})
+	t.Run("Concurrent_lease", func(t *testing.T) {
+		testConcurrentLease(t, newStorage(t))
+	})
+}
+
+func testURLs(t *testing.T, s Storage) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	all := types.ListURLsParams{Limit: 100}
+
+	list, err := s.ListURLs(ctx, all)
+	require.NoError(err)
+	assert.Empty(list)
+
+	first, err := s.CreateURL(ctx, types.NewURL{Alias: "first", Url: "https://first.com"})
+	require.NoError(err)
+	assert.Positive(first.Id)
+	assert.Equal("first", first.Alias)
+	assert.Equal("https://first.com", first.Url)
+
+	second, err := s.CreateURL(ctx, types.NewURL{Alias: "second", Url: "https://second.com"})
+	require.NoError(err)
+	assert.Greater(second.Id, first.Id)
+
+	_, err = s.CreateURL(ctx, types.NewURL{Alias: "first", Url: "https://other.com"})
+	require.ErrorIs(err, database.ErrAliasExists)
+
+	got, err := s.GetURLByAlias(ctx, "first")
+	require.NoError(err)
+	assert.Equal(first, got)
+
+	_, err = s.GetURLByAlias(ctx, "unknown")
+	require.ErrorIs(err, database.ErrURLUnfound)
+
+	list, err = s.ListURLs(ctx, all)
+	require.NoError(err)
+	assert.Equal([]types.URL{first, second}, list)
+
+	deleted, err := s.DeleteURLByAlias(ctx, "first", "")
+	require.NoError(err)
+	assert.Equal(first, deleted)
+
+	_, err = s.DeleteURLByAlias(ctx, "first", "")
+	require.ErrorIs(err, database.ErrURLUnfound)
+
+	_, err = s.GetURLByAlias(ctx, "first")
+	require.ErrorIs(err, database.ErrURLUnfound)
+
+	list, err = s.ListURLs(ctx, all)
+	require.NoError(err)
+	assert.Equal([]types.URL{second}, list)
+}
+
+func testBatch(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.CreateURL(ctx, types.NewURL{Alias: "taken", Url: "https://taken.com"})
+	require.NoError(t, err)
+
+	batch := []types.NewURL{
+		{Alias: "first", Url: "https://first.com", Owner: "alice"},
+		{Alias: "taken", Url: "https://other.com"},
+		{Alias: "second", Url: "https://second.com"},
+		{Alias: "first", Url: "https://twice.com"},
+	}
+
+	urls, err := s.CreateURLs(ctx, batch, true)
+	require.ErrorIs(t, err, database.ErrAliasExists)
+	require.Len(t, urls, 4)
+	assert.Zero(t, urls[1].Id)
+	assert.Zero(t, urls[3].Id)
+	_, err = s.GetURLByAlias(ctx, "first")
+	require.ErrorIs(t, err, database.ErrURLUnfound, "atomic batch is rolled back")
+
+	urls, err = s.CreateURLs(ctx, batch, false)
+	require.NoError(t, err)
+	require.Len(t, urls, 4)
+	assert.Equal(t, "first", urls[0].Alias)
+	assert.Equal(t, "alice", urls[0].Owner)
+	assert.Zero(t, urls[1].Id)
+	assert.Equal(t, "second", urls[2].Alias)
+	assert.Zero(t, urls[3].Id)
+
+	url, err := s.GetURLByAlias(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, urls[0], url)
+	url, err = s.GetURLByAlias(ctx, "taken")
+	require.NoError(t, err)
+	assert.Equal(t, "https://taken.com", url.Url)
+
+	count, err := s.CountURLs(ctx, types.URLFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func testUpdate(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Second)
+	created, err := s.CreateURL(ctx, types.NewURL{Alias: "alias", Url: "https://first.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), created.Version)
+	assert.WithinRange(t, created.CreatedAt, before, time.Now().Add(time.Second))
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	updated, err := s.UpdateURL(ctx, "alias", "https://second.com", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, created.Id, updated.Id)
+	assert.Equal(t, "https://second.com", updated.Url)
+	assert.Equal(t, int64(2), updated.Version)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+
+	updated, err = s.UpdateURL(ctx, "alias", "https://third.com", updated.Version, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+
+	_, err = s.UpdateURL(ctx, "alias", "https://fourth.com", 2, "")
+	require.ErrorIs(t, err, database.ErrVersionMismatch)
+
+	_, err = s.UpdateURL(ctx, "unknown", "https://fourth.com", 0, "")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+
+	_, err = s.UpdateURL(ctx, "unknown", "https://fourth.com", 1, "")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+
+	got, err := s.GetURLByAlias(ctx, "alias")
+	require.NoError(t, err)
+	assert.Equal(t, updated, got)
+
+	owned, err := s.CreateURL(ctx, types.NewURL{Alias: "owned", Url: "https://first.com", Owner: "alice"})
+	require.NoError(t, err)
+
+	_, err = s.UpdateURL(ctx, "owned", "https://second.com", 0, "bob")
+	require.ErrorIs(t, err, database.ErrNotOwner)
+
+	_, err = s.UpdateURL(ctx, "owned", "https://second.com", owned.Version+1, "bob")
+	require.ErrorIs(t, err, database.ErrNotOwner)
+
+	_, err = s.UpdateURL(ctx, "owned", "https://second.com", owned.Version+1, "alice")
+	require.ErrorIs(t, err, database.ErrVersionMismatch)
+
+	_, err = s.UpdateURL(ctx, "unknown", "https://second.com", 0, "alice")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+
+	updated, err = s.UpdateURL(ctx, "owned", "https://second.com", owned.Version, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "https://second.com", updated.Url)
+
+	_, err = s.DeleteURLByAlias(ctx, "owned", "bob")
+	require.ErrorIs(t, err, database.ErrNotOwner)
+
+	_, err = s.DeleteURLByAlias(ctx, "unknown", "bob")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+
+	deleted, err := s.DeleteURLByAlias(ctx, "owned", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, updated, deleted)
+}
+
+func testList(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	var created []types.URL
+	for _, u := range []struct{ alias, url string }{
+		{"ab-1", "https://example.com"},
+		{"ab-2", "https://Example.com:8080/path"},
+		{"Ab-3", "http://example.com?q=1"},
+		{"ab-4", "https://sub.example.com/"},
+		{"cd-5", "https://other.com/?next=https://example.com/"},
+		{"ab-6", "https://example.com#top"},
+		{"ab_7", "https://example.community"},
+	} {
+		url, err := s.CreateURL(ctx, types.NewURL{Alias: u.alias, Url: u.url})
+		require.NoError(t, err)
+		created = append(created, url)
+	}
+
+	pick := func(idx ...int) []types.URL {
+		urls := make([]types.URL, 0, len(idx))
+		for _, i := range idx {
+			urls = append(urls, created[i])
+		}
+		return urls
+	}
+
+	cases := []struct {
+		name   string
+		params types.ListURLsParams
+		want   []types.URL
+	}{
+		{"First_page", types.ListURLsParams{Limit: 3}, pick(0, 1, 2)},
+		{"Next_page", types.ListURLsParams{Limit: 3, After: created[2].Id}, pick(3, 4, 5)},
+		{"Last_page", types.ListURLsParams{Limit: 3, After: created[5].Id}, pick(6)},
+		{"Desc", types.ListURLsParams{Limit: 2, Desc: true}, pick(6, 5)},
+		{"Desc_next_page", types.ListURLsParams{Limit: 2, Desc: true, After: created[5].Id}, pick(4, 3)},
+		{"Alias_prefix", types.ListURLsParams{Limit: 10, URLFilter: types.URLFilter{AliasPrefix: "ab-"}}, pick(0, 1, 3, 5)},
+		{"Host", types.ListURLsParams{Limit: 10, URLFilter: types.URLFilter{Host: "example.com"}}, pick(0, 1, 2, 5)},
+		{"Both", types.ListURLsParams{Limit: 10, After: created[0].Id, URLFilter: types.URLFilter{AliasPrefix: "ab", Host: "example.com"}}, pick(1, 5)},
+		{"Nothing", types.ListURLsParams{Limit: 10, URLFilter: types.URLFilter{Host: "unknown.com"}}, pick()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			list, err := s.ListURLs(ctx, tc.params)
+			require.NoError(t, err)
+			if len(tc.want) == 0 {
+				assert.Empty(t, list)
+				return
+			}
+			assert.Equal(t, tc.want, list)
+
+			count, err := s.CountURLs(ctx, tc.params.URLFilter)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, count, int64(len(tc.want)))
+		})
+	}
+
+	count, err := s.CountURLs(ctx, types.URLFilter{Host: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	count, err = s.CountURLs(ctx, types.URLFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(created)), count)
+}
+
+func testExpiry(t *testing.T, s Storage) {
+	ctx := context.Background()
+	hourAgo := time.Now().Add(-time.Hour)
+	inHour := time.Now().Add(time.Hour)
+	two := int64(2)
+
+	budget, err := s.CreateURL(ctx, types.NewURL{Alias: "budget", Url: "https://budget.com", MaxClicks: &two})
+	require.NoError(t, err)
+	assert.Equal(t, &two, budget.MaxClicks)
+	assert.Nil(t, budget.ExpiresAt)
+
+	timed, err := s.CreateURL(ctx, types.NewURL{Alias: "timed", Url: "https://timed.com", ExpiresAt: &inHour})
+	require.NoError(t, err)
+	require.NotNil(t, timed.ExpiresAt)
+	assert.WithinDuration(t, inHour, *timed.ExpiresAt, time.Millisecond)
+
+	expired, err := s.CreateURL(ctx, types.NewURL{Alias: "expired", Url: "https://expired.com", ExpiresAt: &hourAgo, MaxClicks: &two})
+	require.NoError(t, err)
+	assert.True(t, expired.Expired(time.Now()))
+
+	_, err = s.CreateURL(ctx, types.NewURL{Alias: "forever", Url: "https://forever.com"})
+	require.NoError(t, err)
+
+	used, err := s.ConsumeClick(ctx, "budget")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), used.UsedClicks)
+	assert.False(t, used.Expired(time.Now()))
+
+	used, err = s.ConsumeClick(ctx, "budget")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), used.UsedClicks)
+	assert.True(t, used.Expired(time.Now().Add(time.Millisecond)), "last click expires the url")
+
+	_, err = s.ConsumeClick(ctx, "budget")
+	require.ErrorIs(t, err, database.ErrURLExpired)
+	_, err = s.ConsumeClick(ctx, "expired")
+	require.ErrorIs(t, err, database.ErrURLExpired)
+	_, err = s.ConsumeClick(ctx, "unknown")
+	require.ErrorIs(t, err, database.ErrURLUnfound)
+
+	n, err := s.SweepExpiredURLs(ctx, time.Now().Add(-2*time.Hour), false)
+	require.NoError(t, err)
+	assert.Zero(t, n, "retention keeps recently expired urls")
+
+	n, err = s.SweepExpiredURLs(ctx, time.Now().Add(time.Second), true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	for _, alias := range []string{"budget", "expired"} {
+		_, err = s.GetURLByAlias(ctx, alias)
+		require.ErrorIs(t, err, database.ErrURLUnfound)
+	}
+	for _, alias := range []string{"timed", "forever"} {
+		_, err = s.GetURLByAlias(ctx, alias)
+		require.NoError(t, err)
+	}
+
+	_, err = s.CreateURL(ctx, types.NewURL{Alias: "expired", Url: "https://reused.com"})
+	require.NoError(t, err, "alias of a swept url is free")
+}
+
+func testClicks(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	url, err := s.CreateURL(ctx, types.NewURL{Alias: "clicked", Url: "https://clicked.com"})
+	require.NoError(t, err)
+
+	count, err := s.CountClicks(ctx, url.Id)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	click := types.Click{
+		URLID:      url.Id,
+		Alias:      url.Alias,
+		At:         time.Now().UTC(),
+		Referrer:   "https://referrer.com",
+		UserAgent:  "curl/8.0",
+		RemoteAddr: "127.0.0.1",
+		RequestID:  "request",
+	}
+	require.NoError(t, s.InsertClicks(ctx, []types.Click{click, click, click}))
+	require.NoError(t, s.InsertClicks(ctx, []types.Click{{URLID: url.Id + 1, Alias: "other", At: time.Now().UTC()}}))
+
+	count, err = s.CountClicks(ctx, url.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func testClickStats(t *testing.T, s Storage) {
+	ctx := context.Background()
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, time.January, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	url, err := s.CreateURL(ctx, types.NewURL{Alias: "stats", Url: "https://stats.com"})
+	require.NoError(t, err)
+
+	// 2024-01-01 is a Monday.
+	click := func(at time.Time, visitor, referrer, country, device string) types.Click {
+		return types.Click{URLID: url.Id, Alias: url.Alias, At: at, Visitor: visitor, ReferrerHost: referrer, Country: country, Device: device}
+	}
+	require.NoError(t, s.InsertClicks(ctx, []types.Click{
+		click(at(1, 10), "a", "news.com", "UA", "mobile"),
+		click(at(1, 11), "a", "news.com", "UA", "mobile"),
+		click(at(1, 12), "b", "", "PL", "desktop"),
+		click(at(8, 0), "c", "news.com", "UA", "mobile"),
+		click(at(9, 23), "", "blog.com", "", ""),
+		// Out of the range.
+		click(at(20, 0), "d", "news.com", "UA", "mobile"),
+		{URLID: url.Id + 1, Alias: "other", At: at(2, 0), Visitor: "e"},
+	}))
+
+	stats, err := s.ClickStats(ctx, types.ClickStatsParams{
+		URLID:  url.Id,
+		From:   at(1, 0),
+		To:     at(15, 0),
+		Bucket: 7 * 24 * time.Hour,
+		Top:    2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), stats.Clicks)
+	assert.Equal(t, int64(3), stats.Visitors)
+	assert.Equal(t, []types.ClickBucket{
+		{Start: at(1, 0), Clicks: 3},
+		{Start: at(8, 0), Clicks: 2},
+	}, stats.Series)
+	assert.Equal(t, []types.ClickCount{{Value: "news.com", Clicks: 3}, {Value: "", Clicks: 1}}, stats.Referrers)
+	assert.Equal(t, []types.ClickCount{{Value: "UA", Clicks: 3}, {Value: "", Clicks: 1}}, stats.Countries)
+	assert.Equal(t, []types.ClickCount{{Value: "mobile", Clicks: 3}, {Value: "", Clicks: 1}}, stats.Devices)
+
+	stats, err = s.ClickStats(ctx, types.ClickStatsParams{
+		URLID:  url.Id,
+		From:   at(1, 0),
+		To:     at(2, 0),
+		Bucket: time.Hour,
+		Top:    10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []types.ClickBucket{
+		{Start: at(1, 10), Clicks: 1},
+		{Start: at(1, 11), Clicks: 1},
+		{Start: at(1, 12), Clicks: 1},
+	}, stats.Series)
+}
+
+func testAPIKeys(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetAPIKeyByHash(ctx, "unknown")
+	require.ErrorIs(t, err, database.ErrKeyUnfound)
+
+	created, err := s.CreateAPIKey(ctx, "alice", "hash-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", created.Name)
+	assert.False(t, created.Admin)
+
+	admin, err := s.CreateAPIKey(ctx, "root", "hash-2", true)
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ID, admin.ID)
+
+	got, err := s.GetAPIKeyByHash(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.WithinDuration(t, created.CreatedAt, got.CreatedAt, time.Millisecond)
+
+	got, err = s.GetAPIKeyByHash(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.True(t, got.Admin)
+}
+
+func testOwners(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	for alias, owner := range map[string]string{"a1": "alice", "a2": "alice", "b1": "bob", "none": ""} {
+		url, err := s.CreateURL(ctx, types.NewURL{Alias: alias, Url: "https://" + alias + ".com", Owner: owner})
+		require.NoError(t, err)
+		assert.Equal(t, owner, url.Owner)
+	}
+
+	url, err := s.GetURLByAlias(ctx, "b1")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", url.Owner)
+
+	list, err := s.ListURLs(ctx, types.ListURLsParams{URLFilter: types.URLFilter{Owner: "alice"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	for _, url := range list {
+		assert.Equal(t, "alice", url.Owner)
+	}
+
+	list, err = s.ListURLs(ctx, types.ListURLsParams{URLFilter: types.URLFilter{Owner: "alice"}, Limit: 10, Desc: true})
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	count, err := s.CountURLs(ctx, types.URLFilter{Owner: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = s.CountURLs(ctx, types.URLFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+}
+
+func testIdempotencyKeys(t *testing.T, s Storage) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	req := types.IdempotentRequest{Owner: "alice", Key: "k1", RequestHash: "hash-1", CreatedAt: now}
+
+	claim, claimed, err := s.ClaimIdempotencyKey(ctx, req, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, 0, claim.StatusCode)
+
+	// The key of another owner is another key.
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, types.IdempotentRequest{Owner: "bob", Key: "k1", RequestHash: "hash-2", CreatedAt: now}, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	got, claimed, err := s.ClaimIdempotencyKey(ctx, types.IdempotentRequest{Owner: "alice", Key: "k1", RequestHash: "hash-3", CreatedAt: now}, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "hash-1", got.RequestHash)
+	assert.Equal(t, 0, got.StatusCode)
+
+	// A claim the key was taken from completes and releases nothing.
+	stale := claim
+	stale.CreatedAt = now.Add(-2 * time.Minute)
+	require.NoError(t, s.CompleteIdempotencyKey(ctx, stale, 500, []byte(`{}`)))
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, stale))
+
+	require.NoError(t, s.CompleteIdempotencyKey(ctx, claim, 201, []byte(`{"status":"OK"}`)))
+	got, claimed, err = s.ClaimIdempotencyKey(ctx, req, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, 201, got.StatusCode)
+	assert.Equal(t, []byte(`{"status":"OK"}`), got.Response)
+	assert.WithinDuration(t, now, got.CreatedAt, time.Millisecond)
+
+	// A request in progress for longer than the lease is abandoned, a
+	// completed one is kept until it expires.
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, types.IdempotentRequest{Owner: "bob", Key: "k1", RequestHash: "hash-5", CreatedAt: now}, now.Add(-time.Hour), now.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, req, now.Add(-time.Hour), now.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	// An expired key is claimed again.
+	later := now.Add(2 * time.Hour)
+	got, claimed, err = s.ClaimIdempotencyKey(ctx, types.IdempotentRequest{Owner: "alice", Key: "k1", RequestHash: "hash-4", CreatedAt: later}, later.Add(-time.Hour), later.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, "hash-4", got.RequestHash)
+	assert.Equal(t, 0, got.StatusCode)
+	assert.Empty(t, got.Response)
+
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, claim))
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, req, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "the first claim no longer holds the key")
+
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, got))
+	_, claimed, err = s.ClaimIdempotencyKey(ctx, req, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	n, err := s.DeleteExpiredIdempotencyKeys(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func testRateLimits(t *testing.T, s Storage) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	// 3 requests per 3 seconds.
+	interval, burst := time.Second, 3*time.Second
+
+	for i := 1; i <= 3; i++ {
+		full, ok, err := s.TakeRateLimitToken(ctx, "a", now, interval, burst)
+		require.NoError(t, err)
+		assert.True(t, ok, "token %d", i)
+		assert.WithinDuration(t, now.Add(time.Duration(i)*interval), full, time.Millisecond)
+	}
+	full, ok, err := s.TakeRateLimitToken(ctx, "a", now, interval, burst)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.WithinDuration(t, now.Add(burst), full, time.Millisecond)
+
+	// Other buckets are untouched.
+	_, ok, err = s.TakeRateLimitToken(ctx, "b", now, interval, burst)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// A token is back an interval later.
+	later := now.Add(interval)
+	full, ok, err = s.TakeRateLimitToken(ctx, "a", later, interval, burst)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.WithinDuration(t, now.Add(burst+interval), full, time.Millisecond)
+	_, ok, err = s.TakeRateLimitToken(ctx, "a", later, interval, burst)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	n, err := s.DeleteExpiredRateLimits(ctx, now.Add(2*interval))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// A removed bucket is full.
+	full, ok, err = s.TakeRateLimitToken(ctx, "b", later, interval, burst)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.WithinDuration(t, later.Add(interval), full, time.Millisecond)
+}
+
+func testLease(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	start, err := s.LeaseAliases(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), start)
+
+	start, err = s.LeaseAliases(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(10), start)
+
+	start, err = s.LeaseAliases(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(15), start)
+}
+
+func testConcurrentLease(t *testing.T, s Storage) {
+	const (
+		workers   = 8
+		perWorker = 10
+		size      = 3
+	)
+
+	var (
+		mu     sync.Mutex
+		starts = make(map[uint32]struct{}, workers*perWorker)
+		wg     sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				start, err := s.LeaseAliases(context.Background(), size)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				mu.Lock()
+				starts[start] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, starts, workers*perWorker)
+	for start := range starts {
+		assert.Zero(t, start%size, "range starting at %d overlaps another one", start)
+	}
+}
@@ -0,0 +1,320 @@
+// Package transfer reads and writes links in the formats of bulk imports
+// and exports: CSV, JSON Lines and the CSV exports of Bitly and YOURLS.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatJSONL  = "jsonl"
+	FormatBitly  = "bitly"
+	FormatYOURLS = "yourls"
+
+	// maxLineSize is the size of the longest JSON line read.
+	maxLineSize = 1 << 20
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrNoURLColumn   = errors.New("header has no url column")
+)
+
+// Row is a link read from an import. Err is set when the row can't be
+// parsed, the following rows are still read.
+type Row struct {
+	Line      int
+	Alias     string
+	URL       string
+	ExpiresAt *time.Time
+	MaxClicks *int64
+	Owner     string
+	Err       error
+}
+
+type Reader interface {
+	// Read returns the next row or io.EOF after the last one.
+	Read() (Row, error)
+}
+
+// Writer writes urls in one of the export formats, buffered until Flush.
+type Writer interface {
+	Write(url types.URL) error
+	Flush() error
+}
+
+// columns are the accepted header names of the fields of a CSV format,
+// compared case insensitively.
+type columns struct {
+	alias     []string
+	url       []string
+	expiresAt []string
+	maxClicks []string
+	owner     []string
+	// shortLink is set when the alias column holds the short link, the
+	// alias is its last path segment.
+	shortLink bool
+}
+
+var csvColumns = map[string]columns{
+	FormatCSV: {
+		alias:     []string{"alias"},
+		url:       []string{"url"},
+		expiresAt: []string{"expires_at"},
+		maxClicks: []string{"max_clicks"},
+		owner:     []string{"owner"},
+	},
+	FormatBitly: {
+		alias:     []string{"bitlink", "link", "short_url", "short link", "id"},
+		url:       []string{"long_url", "long url", "destination url", "original url"},
+		shortLink: true,
+	},
+	FormatYOURLS: {
+		alias: []string{"keyword"},
+		url:   []string{"url", "long url"},
+	},
+}
+
+// Formats returns the import formats.
+func Formats() []string {
+	return []string{FormatCSV, FormatJSONL, FormatBitly, FormatYOURLS}
+}
+
+// NewReader returns a reader of the rows of r. CSV formats must start with
+// a header, which is read right away.
+func NewReader(r io.Reader, format string) (Reader, error) {
+	if format == FormatJSONL {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		return &jsonlReader{sc: sc}, nil
+	}
+
+	cols, ok := csvColumns[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ErrNoURLColumn
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	reader := &csvReader{
+		r:         cr,
+		alias:     index(header, cols.alias),
+		url:       index(header, cols.url),
+		expiresAt: index(header, cols.expiresAt),
+		maxClicks: index(header, cols.maxClicks),
+		owner:     index(header, cols.owner),
+		shortLink: cols.shortLink,
+	}
+	if reader.url < 0 {
+		return nil, ErrNoURLColumn
+	}
+	return reader, nil
+}
+
+// index returns the position of the first column named one of names, or -1.
+func index(header, names []string) int {
+	for _, name := range names {
+		for i, col := range header {
+			if strings.EqualFold(strings.TrimSpace(col), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+type csvReader struct {
+	r         *csv.Reader
+	alias     int
+	url       int
+	expiresAt int
+	maxClicks int
+	owner     int
+	shortLink bool
+}
+
+func (c *csvReader) Read() (Row, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{Line: parseErr.Line, Err: parseErr.Err}, nil
+		}
+		return Row{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	row := Row{
+		Line:  line,
+		Alias: field(record, c.alias),
+		URL:   field(record, c.url),
+		Owner: field(record, c.owner),
+	}
+	if c.shortLink && row.Alias != "" {
+		row.Alias = row.Alias[strings.LastIndexByte(row.Alias, '/')+1:]
+	}
+
+	if v := field(record, c.expiresAt); v != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			row.Err = errors.New("expires_at must be an RFC 3339 time")
+			return row, nil
+		}
+		row.ExpiresAt = &expiresAt
+	}
+	if v := field(record, c.maxClicks); v != "" {
+		maxClicks, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			row.Err = errors.New("max_clicks must be an integer")
+			return row, nil
+		}
+		row.MaxClicks = &maxClicks
+	}
+	return row, nil
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+type jsonlReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+// jsonlRow is a line of JSON Lines, the fields of types.URL that are
+// imported.
+type jsonlRow struct {
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxClicks *int64     `json:"max_clicks"`
+	Owner     string     `json:"owner"`
+}
+
+func (j *jsonlReader) Read() (Row, error) {
+	for j.sc.Scan() {
+		j.line++
+		data := j.sc.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		var v jsonlRow
+		err := json.Unmarshal(data, &v)
+		if err != nil {
+			return Row{Line: j.line, Err: errors.New("invalid json")}, nil
+		}
+		return Row{
+			Line:      j.line,
+			Alias:     v.Alias,
+			URL:       v.URL,
+			ExpiresAt: v.ExpiresAt,
+			MaxClicks: v.MaxClicks,
+			Owner:     v.Owner,
+		}, nil
+	}
+
+	err := j.sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return Row{}, err
+}
+
+// NewWriter returns a writer of urls to w. Only FormatCSV and FormatJSONL
+// are written, the files of both can be imported back.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		err := cw.Write([]string{"alias", "url", "expires_at", "max_clicks", "owner", "created_at"})
+		if err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// ContentType returns the media type of the files written in format.
+func ContentType(format string) string {
+	if format == FormatJSONL {
+		return "application/jsonl"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(url types.URL) error {
+	return j.enc.Encode(url)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(url types.URL) error {
+	var expiresAt, maxClicks string
+	if url.ExpiresAt != nil {
+		expiresAt = url.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	if url.MaxClicks != nil {
+		maxClicks = strconv.FormatInt(*url.MaxClicks, 10)
+	}
+	return c.w.Write([]string{
+		url.Alias,
+		url.Url,
+		expiresAt,
+		maxClicks,
+		url.Owner,
+		url.CreatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
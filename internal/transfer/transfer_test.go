@@ -0,0 +1,150 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/internal/types"
+)
+
+func TestReader(t *testing.T) {
+	expiresAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxClicks := int64(5)
+
+	cases := []struct {
+		name   string
+		format string
+		input  string
+		rows   []Row
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			input: "alias,url,expires_at,max_clicks\n" +
+				"docs,https://go.dev/doc,2030-01-01T00:00:00Z,5\n" +
+				",https://go.dev\n" +
+				"bad,https://go.dev,tomorrow,\n",
+			rows: []Row{
+				{Line: 2, Alias: "docs", URL: "https://go.dev/doc", ExpiresAt: &expiresAt, MaxClicks: &maxClicks},
+				{Line: 3, URL: "https://go.dev"},
+				{Line: 4, Alias: "bad", URL: "https://go.dev", Err: errors.New("expires_at must be an RFC 3339 time")},
+			},
+		},
+		{
+			name:   "CSV_url_only",
+			format: FormatCSV,
+			input:  "\ufeffURL\nhttps://go.dev\n",
+			rows: []Row{
+				{Line: 2, URL: "https://go.dev"},
+			},
+		},
+		{
+			name:   "JSONL",
+			format: FormatJSONL,
+			input: `{"alias":"docs","url":"https://go.dev/doc","expires_at":"2030-01-01T00:00:00Z","max_clicks":5,"owner":"alice"}` + "\n" +
+				"\n" +
+				"{broken\n" +
+				`{"url":"https://go.dev"}`,
+			rows: []Row{
+				{Line: 1, Alias: "docs", URL: "https://go.dev/doc", ExpiresAt: &expiresAt, MaxClicks: &maxClicks, Owner: "alice"},
+				{Line: 3, Err: errors.New("invalid json")},
+				{Line: 4, URL: "https://go.dev"},
+			},
+		},
+		{
+			name:   "Bitly",
+			format: FormatBitly,
+			input: "Created,Title,Long URL,Bitlink\n" +
+				"2024-01-01,Docs,https://go.dev/doc,bit.ly/3xYz1Ab\n" +
+				"2024-01-02,Blog,https://go.dev/blog,https://example.link/blog\n",
+			rows: []Row{
+				{Line: 2, Alias: "3xYz1Ab", URL: "https://go.dev/doc"},
+				{Line: 3, Alias: "blog", URL: "https://go.dev/blog"},
+			},
+		},
+		{
+			name:   "YOURLS",
+			format: FormatYOURLS,
+			input: "keyword,url,title,timestamp,ip,clicks\n" +
+				"docs,https://go.dev/doc,Docs,2024-01-01 00:00:00,127.0.0.1,42\n",
+			rows: []Row{
+				{Line: 2, Alias: "docs", URL: "https://go.dev/doc"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tc.input), tc.format)
+			require.NoError(t, err)
+
+			var rows []Row
+			for {
+				row, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				rows = append(rows, row)
+			}
+			assert.Equal(t, tc.rows, rows)
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, err := NewReader(strings.NewReader("alias,url\n"), "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	_, err = NewReader(strings.NewReader("keyword,title\nabc,ABC\n"), FormatYOURLS)
+	assert.ErrorIs(t, err, ErrNoURLColumn)
+
+	_, err = NewReader(strings.NewReader(""), FormatCSV)
+	assert.ErrorIs(t, err, ErrNoURLColumn)
+}
+
+func TestRoundTrip(t *testing.T) {
+	expiresAt := time.Date(2030, time.January, 1, 12, 30, 0, 500_000_000, time.UTC)
+	maxClicks := int64(5)
+	urls := []types.URL{
+		{Id: 1, Alias: "docs", Url: "https://go.dev/doc?a=1,2", ExpiresAt: &expiresAt, MaxClicks: &maxClicks, Owner: "alice"},
+		{Id: 2, Alias: "blog", Url: "https://go.dev/blog"},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			require.NoError(t, err)
+			for _, url := range urls {
+				require.NoError(t, w.Write(url))
+			}
+			require.NoError(t, w.Flush())
+
+			r, err := NewReader(&buf, format)
+			require.NoError(t, err)
+			for _, url := range urls {
+				row, err := r.Read()
+				require.NoError(t, err)
+				require.NoError(t, row.Err)
+				assert.Equal(t, url.Alias, row.Alias)
+				assert.Equal(t, url.Url, row.URL)
+				assert.Equal(t, url.ExpiresAt, row.ExpiresAt)
+				assert.Equal(t, url.MaxClicks, row.MaxClicks)
+				assert.Equal(t, url.Owner, row.Owner)
+			}
+			_, err = r.Read()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	_, err := NewWriter(io.Discard, FormatBitly)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,56 @@
+package types
+
+import "time"
+
+// Click is a redirect served for a url.
+type Click struct {
+	URLID      int64     `json:"url_id"`
+	Alias      string    `json:"alias"`
+	At         time.Time `json:"at"`
+	Referrer   string    `json:"referrer"`
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	RequestID  string    `json:"request_id"`
+
+	// Derived from the fields above when the click is recorded.
+	Visitor      string `json:"visitor,omitempty"`
+	ReferrerHost string `json:"referrer_host,omitempty"`
+	Country      string `json:"country,omitempty"`
+	Device       string `json:"device,omitempty"`
+}
+
+// BucketOrigin aligns the buckets of click series. It is a Monday
+// midnight, so weekly buckets start on Mondays.
+var BucketOrigin = time.Date(1970, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+// ClickStatsParams selects the clicks of a url made in [From, To).
+type ClickStatsParams struct {
+	URLID    int64
+	From, To time.Time
+	// Bucket is the width of the series buckets.
+	Bucket time.Duration
+	// Top limits the breakdowns.
+	Top int
+}
+
+type ClickStats struct {
+	Clicks   int64 `json:"clicks"`
+	Visitors int64 `json:"visitors"`
+	// Series has only the buckets with clicks, ordered by start.
+	Series    []ClickBucket `json:"series"`
+	Referrers []ClickCount  `json:"referrers"`
+	Countries []ClickCount  `json:"countries"`
+	Devices   []ClickCount  `json:"devices"`
+}
+
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// ClickCount is the number of clicks with a value, an empty value means
+// it is unknown.
+type ClickCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// IdempotentRequest is a request made with an Idempotency-Key header and
+// the response it got. StatusCode is zero while it is in progress.
+type IdempotentRequest struct {
+	Owner       string
+	Key         string
+	RequestHash string
+	CreatedAt   time.Time
+	StatusCode  int
+	Response    []byte
+}
@@ -0,0 +1,11 @@
+package types
+
+import "time"
+
+// APIKey authenticates a principal. Only the hash of the key is stored.
+type APIKey struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package types
+
+// URLFilter narrows a listing of urls. Empty fields match every url.
+type URLFilter struct {
+	// AliasPrefix matches aliases starting with it, case sensitive.
+	AliasPrefix string
+	// Host matches urls whose destination host is equal to it. It must be
+	// lowercase.
+	Host string
+	// Owner matches urls created by the principal with this name.
+	Owner string
+}
+
+// ListURLsParams is a page of urls ordered by id. After is the id of the
+// last url of the previous page, 0 starts from the first url in either
+// order.
+type ListURLsParams struct {
+	URLFilter
+	After int64
+	Limit int
+	Desc  bool
+}
@@ -1,7 +1,37 @@
 package types
 
+import "time"
+
 type URL struct {
 	Id    int64  `json:"id"`
 	Alias string `json:"alias"`
 	Url   string `json:"url"`
+
+	// Version is incremented on every update of the url.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ExpiresAt is set to the time of the last allowed click once
+	// UsedClicks reaches MaxClicks.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	MaxClicks  *int64     `json:"max_clicks,omitempty"`
+	UsedClicks int64      `json:"used_clicks,omitempty"`
+	// Owner is the name of the principal that created the url, urls
+	// created before authentication have none.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Expired reports whether the url is gone by time or by click budget.
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// NewURL is a url to create. Nil fields are unlimited.
+type NewURL struct {
+	Alias     string
+	Url       string
+	ExpiresAt *time.Time
+	MaxClicks *int64
+	Owner     string
 }
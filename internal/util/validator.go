@@ -1,45 +1,299 @@
 package util
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
 	"net/url"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Reasons a url breaks a URLPolicy.
+const (
+	ReasonMalformed     = "malformed"
+	ReasonScheme        = "scheme_not_allowed"
+	ReasonTooLong       = "too_long"
+	ReasonHost          = "invalid_host"
+	ReasonPort          = "invalid_port"
+	ReasonPrivate       = "private_host"
+	ReasonNotAllowed    = "domain_not_allowed"
+	ReasonDenied        = "domain_denied"
+	ReasonSelfReference = "self_reference"
+	ReasonRedirectLoop  = "redirect_loop"
+	ReasonTooManyHops   = "too_many_redirects"
+)
+
+const (
+	maxHostLen          = 253
+	maxLabelLen         = 63
+	defaultMaxURLLength = 2048
 )
 
-func IsURL(str string) bool {
+var ErrDomainGlob = errors.New("invalid domain glob")
+
+// URLViolation is a reason a url breaks a policy, with a human readable
+// detail.
+type URLViolation struct {
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// URLPolicy decides which urls may be shortened.
+type URLPolicy struct {
+	schemes   []string
+	maxLength int
+	// allowPrivate lets private, loopback and link-local addresses and
+	// single label hosts such as intranet names through. Only ip literals
+	// and names are checked, hostnames are not resolved: a public name
+	// pointing to a private address such as 127.0.0.1.nip.io passes.
+	allowPrivate bool
+	allow        []string
+	deny         []string
+	// self are the public hostnames of the server, links to them would
+	// redirect to another link or to themselves.
+	self []string
+}
+
+// NewURLPolicy returns a policy accepting urls of the schemes up to
+// maxLength bytes once normalized. Hosts must match one of the allow globs
+// when there are some and none of the deny globs. A glob is a domain where
+// "*" stands for any part of it, "*.example.com" matches the subdomains of
+// example.com but not example.com itself. Urls of the self hosts, the
+// public hostnames of the server, are refused whatever their port.
+func NewURLPolicy(schemes []string, maxLength int, allowPrivate bool, allow, deny, self []string) (*URLPolicy, error) {
+	const op = "util.NewURLPolicy"
+
+	p := &URLPolicy{
+		maxLength:    maxLength,
+		allowPrivate: allowPrivate,
+	}
+	for _, scheme := range schemes {
+		p.schemes = append(p.schemes, strings.ToLower(strings.TrimSpace(scheme)))
+	}
+
+	var err error
+	p.allow, err = normalizeGlobs(allow)
+	if err != nil {
+		return nil, OpWrap(op, err)
+	}
+	p.deny, err = normalizeGlobs(deny)
+	if err != nil {
+		return nil, OpWrap(op, err)
+	}
+	p.self = NormalizeHosts(self)
+	return p, nil
+}
+
+// DefaultURLPolicy accepts public http and https urls of up to 2048 bytes.
+func DefaultURLPolicy() *URLPolicy {
+	return &URLPolicy{
+		schemes:   []string{"http", "https"},
+		maxLength: defaultMaxURLLength,
+	}
+}
+
+// Check normalizes str and returns it with the reasons it breaks the
+// policy, none if it is accepted. The host is lowercased and IDNA encoded,
+// and the default port of the scheme is removed.
+func (p *URLPolicy) Check(str string) (string, []URLViolation) {
 	u, err := url.Parse(str)
 	if err != nil {
-		return false
+		return str, []URLViolation{{ReasonMalformed, "url cannot be parsed"}}
 	}
-	if u.Scheme != "http" && u.Scheme != "https" {
-		return false
+	if !u.IsAbs() {
+		return str, []URLViolation{{ReasonMalformed, "url must be absolute"}}
 	}
-	if u.Host == "" {
-		return false
+
+	var violations []URLViolation
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !slices.Contains(p.schemes, u.Scheme) {
+		violations = append(violations, URLViolation{ReasonScheme, fmt.Sprintf("scheme must be one of %s", strings.Join(p.schemes, ", "))})
 	}
-	parts := strings.Split(u.Host, ".")
-	if !(len(parts) == 2 || len(parts) == 3) {
-		return false
+	if u.Opaque != "" {
+		return str, append(violations, URLViolation{ReasonHost, "url must have a host"})
 	}
-	for _, part := range parts {
-		if part == "" {
-			return false
+
+	host, addr, hostViolations := p.checkHost(u)
+	violations = append(violations, hostViolations...)
+
+	port := u.Port()
+	if port != "" {
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || n == 0 {
+			violations = append(violations, URLViolation{ReasonPort, "port must be between 1 and 65535"})
+		}
+		if u.Scheme == "http" && n == 80 || u.Scheme == "https" && n == 443 {
+			port = ""
+		}
+	}
+	if len(hostViolations) == 0 {
+		u.Host = host
+		if addr.Is6() {
+			u.Host = "[" + host + "]"
+		}
+		if port != "" {
+			u.Host += ":" + port
+		}
+	}
+
+	normalized := u.String()
+	if len(normalized) > p.maxLength {
+		violations = append(violations, URLViolation{ReasonTooLong, fmt.Sprintf("url must be at most %d bytes", p.maxLength)})
+	}
+	return normalized, violations
+}
+
+// checkHost returns the normalized host of u, and its address if it is an
+// ip literal.
+func (p *URLPolicy) checkHost(u *url.URL) (string, netip.Addr, []URLViolation) {
+	host := u.Hostname()
+	if host == "" {
+		return "", netip.Addr{}, []URLViolation{{ReasonHost, "url must have a host"}}
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return "", addr, []URLViolation{{ReasonHost, "ip address must not have a zone"}}
+		}
+		addr = addr.Unmap()
+		var violations []URLViolation
+		if !p.allowPrivate && IsPrivateAddr(addr) {
+			violations = append(violations, URLViolation{ReasonPrivate, "private and loopback addresses are not allowed"})
+		}
+		if slices.Contains(p.self, addr.String()) {
+			violations = append(violations, selfReference)
+		}
+		return addr.String(), addr, violations
+	}
+
+	host, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil || !validHostname(host) {
+		return "", netip.Addr{}, []URLViolation{{ReasonHost, "host is not a valid domain name or ip address"}}
+	}
+
+	var violations []URLViolation
+	if !p.allowPrivate && (!strings.Contains(host, ".") || host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		violations = append(violations, URLViolation{ReasonPrivate, "hosts without a top level domain are not allowed"})
+	}
+	if len(p.allow) > 0 && !matchGlobs(p.allow, host) {
+		violations = append(violations, URLViolation{ReasonNotAllowed, "domain is not allowed"})
+	}
+	if matchGlobs(p.deny, host) {
+		violations = append(violations, URLViolation{ReasonDenied, "domain is denied"})
+	}
+	if slices.Contains(p.self, host) {
+		violations = append(violations, selfReference)
+	}
+	return host, netip.Addr{}, violations
+}
+
+var selfReference = URLViolation{ReasonSelfReference, "url points to this link shortener"}
+
+// NormalizeHosts returns hostnames the way urls are compared against them:
+// lowercase, IDNA encoded, without port and brackets.
+func NormalizeHosts(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if u, err := url.Parse("http://" + host); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
 		}
+		host = strings.TrimSuffix(host, ".")
+		if addr, err := netip.ParseAddr(host); err == nil {
+			host = addr.Unmap().String()
+		} else if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+			host = ascii
+		}
+		normalized = append(normalized, host)
 	}
-	lasts := strings.Split(parts[len(parts)-1], ":")
-	tld := lasts[0]
-	if len(tld) < 2 || len(tld) > 63 {
+	return normalized
+}
+
+// validHostname reports whether host is an ascii domain name that cannot
+// be taken for an ip address.
+func validHostname(host string) bool {
+	if len(host) > maxHostLen {
 		return false
 	}
-	if len(lasts) > 2 {
+
+	labels := strings.Split(host, ".")
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLen || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	// Numeric top level domains are ip addresses in another form, such as
+	// 127.1 or 2130706433.
+	tld := labels[len(labels)-1]
+	if strings.Trim(tld, "0123456789") == "" {
 		return false
 	}
-	if len(lasts) == 2 {
-		port, err := strconv.Atoi(lasts[1])
+	return len(labels) == 1 || len(tld) >= 2
+}
+
+// IsPrivateAddr reports whether addr is private, loopback, link-local or
+// unspecified, an address of the network of the server rather than of the
+// internet.
+func IsPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() ||
+		addr.IsLoopback() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsUnspecified()
+}
+
+func normalizeGlobs(globs []string) ([]string, error) {
+	normalized := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+
+		// The labels are encoded one by one, "*" is no valid label.
+		labels := strings.Split(strings.TrimSuffix(glob, "."), ".")
+		for i, label := range labels {
+			if strings.Contains(label, "*") {
+				labels[i] = strings.ToLower(label)
+				continue
+			}
+			ascii, err := idna.Lookup.ToASCII(label)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrDomainGlob, glob)
+			}
+			labels[i] = ascii
+		}
+		glob = strings.Join(labels, ".")
+
+		_, err := path.Match(glob, "")
 		if err != nil {
-			return false
+			return nil, fmt.Errorf("%w: %q", ErrDomainGlob, glob)
+		}
+		normalized = append(normalized, glob)
+	}
+	return normalized, nil
+}
+
+func matchGlobs(globs []string, host string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, host); ok {
+			return true
 		}
-		return port < 65536
 	}
-	return true
+	return false
 }
@@ -1,12 +1,14 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestIsURL(t *testing.T) {
+func TestDefaultURLPolicy(t *testing.T) {
 	testCases := map[string]struct {
 		url  string
 		want bool
@@ -101,6 +103,42 @@ func TestIsURL(t *testing.T) {
 		},
 		"https_with_subdomains": {
 			url:  "https://sub.sub.example.com",
+			want: true,
+		},
+		"idn": {
+			url:  "https://пример.рф",
+			want: true,
+		},
+		"punycode": {
+			url:  "https://xn--e1afmkfd.xn--p1ai",
+			want: true,
+		},
+		"ipv4": {
+			url:  "http://93.184.215.14",
+			want: true,
+		},
+		"ipv6": {
+			url:  "http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:8080/",
+			want: true,
+		},
+		"loopback": {
+			url:  "http://127.0.0.1",
+			want: false,
+		},
+		"private_ipv6": {
+			url:  "http://[fd00::1]",
+			want: false,
+		},
+		"localhost": {
+			url:  "http://localhost:8080",
+			want: false,
+		},
+		"numeric_tld": {
+			url:  "http://127.1",
+			want: false,
+		},
+		"leading_hyphen": {
+			url:  "https://-example.com",
 			want: false,
 		},
 		"https_with_port": {
@@ -126,7 +164,96 @@ func TestIsURL(t *testing.T) {
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			assert.Equal(t, tc.want, IsURL(tc.url))
+			_, violations := DefaultURLPolicy().Check(tc.url)
+			assert.Equal(t, tc.want, len(violations) == 0, violations)
 		})
 	}
 }
+
+func TestURLPolicy(t *testing.T) {
+	policy, err := NewURLPolicy([]string{"https"}, 40, true, []string{"example.com", "*.example.com", "*.пример.рф"}, []string{"evil.example.com"}, []string{"Short.example.COM:8443", "[::1]"})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		url        string
+		normalized string
+		reasons    []string
+	}{
+		"normalized": {
+			url:        "HTTPS://Sub.EXAMPLE.com:443/Path?q=1",
+			normalized: "https://sub.example.com/Path?q=1",
+		},
+		"trailing_dot": {
+			url:        "https://example.com./",
+			normalized: "https://example.com/",
+		},
+		"idn_glob": {
+			url:        "https://a.Пример.рф",
+			normalized: "https://a.xn--e1afmkfd.xn--p1ai",
+		},
+		"other_port": {
+			url:        "https://example.com:8443",
+			normalized: "https://example.com:8443",
+		},
+		"intranet": {
+			url:     "https://wiki",
+			reasons: []string{ReasonNotAllowed},
+		},
+		"private_allowed": {
+			url:        "https://[::ffff:10.0.0.1]",
+			normalized: "https://10.0.0.1",
+		},
+		"scheme": {
+			url:     "http://example.com",
+			reasons: []string{ReasonScheme},
+		},
+		"not_allowed": {
+			url:     "https://example.org",
+			reasons: []string{ReasonNotAllowed},
+		},
+		"denied": {
+			url:     "https://evil.example.com",
+			reasons: []string{ReasonDenied},
+		},
+		"too_long": {
+			url:     "https://example.com/" + strings.Repeat("a", 21),
+			reasons: []string{ReasonTooLong},
+		},
+		"self_reference": {
+			url:     "https://short.example.com/abc",
+			reasons: []string{ReasonSelfReference},
+		},
+		"self_reference_ip": {
+			url:     "https://[::1]:8080/abc",
+			reasons: []string{ReasonSelfReference},
+		},
+		"zero_port": {
+			url:     "https://example.com:0",
+			reasons: []string{ReasonPort},
+		},
+		"mailto": {
+			url:     "mailto:someone@example.com",
+			reasons: []string{ReasonScheme, ReasonHost},
+		},
+		"malformed": {
+			url:     "example.com",
+			reasons: []string{ReasonMalformed},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			normalized, violations := policy.Check(tc.url)
+			var reasons []string
+			for _, v := range violations {
+				reasons = append(reasons, v.Reason)
+			}
+			assert.Equal(t, tc.reasons, reasons)
+			if tc.normalized != "" {
+				assert.Equal(t, tc.normalized, normalized)
+			}
+		})
+	}
+
+	_, err = NewURLPolicy([]string{"https"}, 100, false, []string{"[example.com"}, nil, nil)
+	assert.ErrorIs(t, err, ErrDomainGlob)
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/5aradise/link-forge/pkg/api"
+)
+
+var ErrUnknownKey = errors.New("unknown api key")
+
+// Principal is who a request is made by.
+type Principal struct {
+	Name  string
+	Admin bool
+}
+
+// KeyLookup returns the principal of the api key with the given hash, or
+// ErrUnknownKey.
+type KeyLookup func(ctx context.Context, keyHash string) (Principal, error)
+
+type ctxKeyPrincipal int
+
+const PrincipalKey ctxKeyPrincipal = iota
+
+// HashKey is the form api keys are stored and looked up in.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Auth authenticates requests with an "Authorization: Bearer <key>"
+// header and attaches the principal of the key to the request context.
+// Requests without the header pass through anonymous, handlers decide
+// what they allow them. Requests to the public routes, http.ServeMux
+// patterns such as "GET /urls/{alias}", pass through anonymous as well
+// when their credentials fail: a stale key or an unavailable storage must
+// not break what anyone may do.
+func Auth(l *slog.Logger, lookup KeyLookup, public ...string) Middleware {
+	l.Info("auth middleware enabled", slog.Int("public_routes", len(public)))
+
+	// The routes are matched the way the router matches them.
+	routes := http.NewServeMux()
+	for _, pattern := range public {
+		routes.Handle(pattern, http.NotFoundHandler())
+	}
+	isPublic := func(r *http.Request) bool {
+		_, pattern := routes.Handler(r)
+		return pattern != ""
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, key, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || key == "" {
+				if isPublic(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				unauthorized(l, w, r, "invalid authorization header")
+				return
+			}
+
+			principal, err := lookup(r.Context(), HashKey(key))
+			if err != nil {
+				if isPublic(r) {
+					l.Info("auth middleware, public route served anonymously",
+						slog.String("error", err.Error()),
+						slog.String("id", GetRequestID(r)),
+					)
+					next.ServeHTTP(w, r)
+					return
+				}
+				if errors.Is(err, ErrUnknownKey) {
+					unauthorized(l, w, r, "invalid api key")
+					return
+				}
+				l.Error("auth middleware",
+					slog.String("error", err.Error()),
+					slog.String("id", GetRequestID(r)),
+				)
+				err = api.WriteError(w, http.StatusServiceUnavailable, "failed to authenticate")
+				if err != nil {
+					l.Error("failed to write response", slog.String("error", err.Error()))
+				}
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func unauthorized(l *slog.Logger, w http.ResponseWriter, r *http.Request, msg string) {
+	l.Info("auth middleware",
+		slog.String("error", msg),
+		slog.String("id", GetRequestID(r)),
+	)
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="link-forge"`)
+	err := api.WriteError(w, http.StatusUnauthorized, msg)
+	if err != nil {
+		l.Error("failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, PrincipalKey, p)
+}
+
+// GetPrincipal returns the principal of an authenticated request.
+func GetPrincipal(r *http.Request) (Principal, bool) {
+	p, ok := r.Context().Value(PrincipalKey).(Principal)
+	return p, ok
+}
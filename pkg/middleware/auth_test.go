@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+func TestAuth(t *testing.T) {
+	keys := map[string]Principal{
+		HashKey("user-key"):  {Name: "user"},
+		HashKey("admin-key"): {Name: "root", Admin: true},
+	}
+	lookup := func(_ context.Context, keyHash string) (Principal, error) {
+		if keyHash == HashKey("broken-key") {
+			return Principal{}, errors.New("connection refused")
+		}
+		p, ok := keys[keyHash]
+		if !ok {
+			return Principal{}, ErrUnknownKey
+		}
+		return p, nil
+	}
+
+	cases := []struct {
+		name      string
+		path      string
+		header    string
+		code      int
+		principal *Principal
+	}{
+		{"Anonymous", "/urls", "", http.StatusOK, nil},
+		{"User", "/urls", "Bearer user-key", http.StatusOK, &Principal{Name: "user"}},
+		{"Admin", "/urls", "bearer admin-key", http.StatusOK, &Principal{Name: "root", Admin: true}},
+		{"Unknown_key", "/urls", "Bearer other-key", http.StatusUnauthorized, nil},
+		{"Basic", "/urls", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, nil},
+		{"Empty_key", "/urls", "Bearer ", http.StatusUnauthorized, nil},
+		{"Storage_down", "/urls", "Bearer broken-key", http.StatusServiceUnavailable, nil},
+		{"Public_user", "/urls/abc", "Bearer user-key", http.StatusOK, &Principal{Name: "user"}},
+		{"Public_unknown_key", "/urls/abc", "Bearer other-key", http.StatusOK, nil},
+		{"Public_basic", "/urls/abc", "Basic dXNlcjpwYXNz", http.StatusOK, nil},
+		{"Public_storage_down", "/urls/abc", "Bearer broken-key", http.StatusOK, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var got *Principal
+			h := Auth(logger.NewMock(), lookup, "GET /urls/{alias}")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p, ok := GetPrincipal(r); ok {
+					got = &p
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(tc.code, rec.Code)
+			assert.Equal(tc.principal, got)
+			if tc.code == http.StatusUnauthorized {
+				assert.NotEmpty(rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -11,9 +11,10 @@ func Cors(l *slog.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "https://*, http://*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "*")
-			w.Header().Set("Access-Control-Expose-Headers", "Link")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, PATCH, DELETE")
+			// The wildcard does not cover Authorization.
+			w.Header().Set("Access-Control-Allow-Headers", "*, Authorization")
+			w.Header().Set("Access-Control-Expose-Headers", "Link, ETag, Idempotent-Replayed, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
 				return
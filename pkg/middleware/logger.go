@@ -29,7 +29,7 @@ func Logger(l *slog.Logger) Middleware {
 			l.Info("request info",
 				slog.Any("status", ww.status),
 				slog.Duration("duration", duration),
-				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("client_ip", GetClientIP(r)),
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.String("id", GetRequestID(r)),
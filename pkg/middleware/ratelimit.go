@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/5aradise/link-forge/pkg/api"
+)
+
+// What requests share a bucket of a rate limit.
+const (
+	// RateLimitByIP gives every client address its own bucket.
+	RateLimitByIP = "ip"
+	// RateLimitByKey gives every api key its own bucket, anonymous
+	// requests are limited by address.
+	RateLimitByKey = "key"
+	// RateLimitByRoute shares one bucket between all the clients.
+	RateLimitByRoute = "route"
+)
+
+// purgeInterval is how often the buckets that are full again are removed.
+const purgeInterval = time.Minute
+
+var ErrInvalidRateLimit = errors.New("rate limit must be <pattern>=<requests>/<period>[:ip|key|route]")
+
+// RateLimit allows Requests requests per Period to the routes matching
+// Pattern, a http.ServeMux pattern such as "POST /api/v1/urls". Bursts of
+// up to Requests requests are allowed, the bucket refills evenly over
+// Period.
+type RateLimit struct {
+	Pattern  string
+	Requests int
+	Period   time.Duration
+	By       string
+}
+
+// ParseRateLimit parses a "<pattern>=<requests>/<period>[:<by>]" limit,
+// e.g. "POST /api/v1/urls=30/1m:key". Requests are limited by ip unless
+// said otherwise.
+func ParseRateLimit(s string) (RateLimit, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return RateLimit{}, fmt.Errorf("%w: %q", ErrInvalidRateLimit, s)
+	}
+	limit := RateLimit{Pattern: strings.TrimSpace(s[:i]), By: RateLimitByIP}
+
+	rate, by, ok := strings.Cut(s[i+1:], ":")
+	if ok {
+		limit.By = by
+	}
+	requests, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("%w: %q", ErrInvalidRateLimit, s)
+	}
+	var err error
+	limit.Requests, err = strconv.Atoi(requests)
+	if err != nil || limit.Requests < 1 {
+		return RateLimit{}, fmt.Errorf("%w: %q", ErrInvalidRateLimit, s)
+	}
+	limit.Period, err = time.ParseDuration(period)
+	if err != nil || limit.Period <= 0 {
+		return RateLimit{}, fmt.Errorf("%w: %q", ErrInvalidRateLimit, s)
+	}
+	if limit.Pattern == "" || limit.By != RateLimitByIP && limit.By != RateLimitByKey && limit.By != RateLimitByRoute {
+		return RateLimit{}, fmt.Errorf("%w: %q", ErrInvalidRateLimit, s)
+	}
+	return limit, nil
+}
+
+// interval is the time a token takes to refill.
+func (limit RateLimit) interval() time.Duration {
+	return limit.Period / time.Duration(limit.Requests)
+}
+
+// RateLimitStore keeps the token buckets of the rate limiter. A bucket is
+// kept as the time it is full again (GCRA): taking a token moves it an
+// interval later, and a bucket full more than burst from now has no token
+// left.
+type RateLimitStore interface {
+	// TakeRateLimitToken takes a token from the bucket of key and returns
+	// the time the bucket is full again. Without a token left it returns
+	// false and leaves the bucket as it is.
+	TakeRateLimitToken(ctx context.Context, key string, now time.Time, interval, burst time.Duration) (time.Time, bool, error)
+	// DeleteExpiredRateLimits removes the buckets full before the given
+	// time, they are no different from new ones.
+	DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error)
+}
+
+// SplitRateLimits separates the limits by ip and by route from the limits
+// by api key. The first ones go in a RateLimiter before Auth, so that
+// requests failing authentication are limited too, the others in one after
+// Auth, which attaches the key they are limited by.
+func SplitRateLimits(limits []RateLimit) (beforeAuth, afterAuth []RateLimit) {
+	for _, limit := range limits {
+		if limit.By == RateLimitByKey {
+			afterAuth = append(afterAuth, limit)
+		} else {
+			beforeAuth = append(beforeAuth, limit)
+		}
+	}
+	return beforeAuth, afterAuth
+}
+
+// RateLimiter answers 429 to requests beyond the limit of their route,
+// every response of a limited route carries the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers. Requests pass through
+// when the store fails, an unavailable store must not take the service
+// down. Limits by api key need Auth to run first, see SplitRateLimits.
+func RateLimiter(l *slog.Logger, store RateLimitStore, limits []RateLimit) (Middleware, error) {
+	const op = "middleware.RateLimiter"
+
+	// The routes are matched the way the router matches them.
+	routes := http.NewServeMux()
+	byPattern := make(map[string]RateLimit, len(limits))
+	for _, limit := range limits {
+		err := handlePattern(routes, limit.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		byPattern[limit.Pattern] = limit
+	}
+
+	l.Info("rate limiter middleware enabled", slog.Int("limits", len(limits)))
+
+	var lastPurge atomic.Int64
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := routes.Handler(r)
+			limit, ok := byPattern[pattern]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			if last := lastPurge.Load(); now.UnixNano()-last >= int64(purgeInterval) && lastPurge.CompareAndSwap(last, now.UnixNano()) {
+				_, err := store.DeleteExpiredRateLimits(r.Context(), now)
+				if err != nil {
+					l.Error("failed to remove expired rate limits", slog.String("error", err.Error()))
+				}
+			}
+
+			interval := limit.interval()
+			full, ok, err := store.TakeRateLimitToken(r.Context(), rateLimitKey(r, limit), now, interval, limit.Period)
+			if err != nil {
+				l.Error("rate limiter middleware",
+					slog.String("error", err.Error()),
+					slog.String("id", GetRequestID(r)),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wait := full.Sub(now)
+			remaining := int((limit.Period - wait) / interval)
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			h.Set("RateLimit-Remaining", strconv.Itoa(max(remaining, 0)))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(wait)))
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			l.Info("rate limiter middleware",
+				slog.String("error", "rate limit exceeded"),
+				slog.String("pattern", limit.Pattern),
+				slog.String("id", GetRequestID(r)),
+			)
+			h.Set("Retry-After", strconv.Itoa(max(seconds(wait+interval-limit.Period), 1)))
+			err = api.WriteError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			if err != nil {
+				l.Error("failed to write response", slog.String("error", err.Error()))
+			}
+		})
+	}, nil
+}
+
+// handlePattern registers pattern, reporting the invalid and conflicting
+// patterns http.ServeMux panics on.
+func handlePattern(mux *http.ServeMux, pattern string) (err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidRateLimit, rvr)
+		}
+	}()
+	mux.Handle(pattern, http.NotFoundHandler())
+	return nil
+}
+
+// rateLimitKey returns the bucket of r under limit.
+func rateLimitKey(r *http.Request, limit RateLimit) string {
+	switch limit.By {
+	case RateLimitByRoute:
+		return limit.Pattern
+	case RateLimitByKey:
+		if p, ok := GetPrincipal(r); ok {
+			return limit.Pattern + "|key:" + p.Name
+		}
+		// Apart from the buckets of a limit of the same pattern by ip.
+		return limit.Pattern + "|anonymous:" + GetClientIP(r)
+	}
+	return limit.Pattern + "|ip:" + GetClientIP(r)
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps the buckets in process memory, each replica
+// limits the requests it gets on its own.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRateLimitStore) TakeRateLimitToken(_ context.Context, key string, now time.Time, interval, burst time.Duration) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	full, ok := takeToken(s.buckets[key], now, interval, burst)
+	if ok {
+		s.buckets[key] = full
+	}
+	return full, ok, nil
+}
+
+func (s *MemoryRateLimitStore) DeleteExpiredRateLimits(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, full := range s.buckets {
+		if full.Before(before) {
+			delete(s.buckets, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// takeToken takes a token from a bucket full at the given time, the zero
+// time for a new one, and returns the time it is full again. Without a
+// token left it returns the bucket as it is and false.
+func takeToken(full, now time.Time, interval, burst time.Duration) (time.Time, bool) {
+	next := full
+	if next.Before(now) {
+		next = now
+	}
+	next = next.Add(interval)
+	if next.Sub(now) > burst {
+		return full, false
+	}
+	return next, true
+}
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	cases := []struct {
+		s     string
+		limit RateLimit
+		err   bool
+	}{
+		{s: "POST /api/v1/urls=30/1m:key", limit: RateLimit{"POST /api/v1/urls", 30, time.Minute, RateLimitByKey}},
+		{s: "/api/=100/1s", limit: RateLimit{"/api/", 100, time.Second, RateLimitByIP}},
+		{s: "GET /urls/{alias}=5/1h:route", limit: RateLimit{"GET /urls/{alias}", 5, time.Hour, RateLimitByRoute}},
+		{s: "POST /api/v1/urls", err: true},
+		{s: "POST /api/v1/urls=30", err: true},
+		{s: "POST /api/v1/urls=0/1m", err: true},
+		{s: "POST /api/v1/urls=30/0s", err: true},
+		{s: "POST /api/v1/urls=30/1m:user", err: true},
+		{s: "=30/1m", err: true},
+	}
+	for _, tc := range cases {
+		limit, err := ParseRateLimit(tc.s)
+		if tc.err {
+			assert.ErrorIs(t, err, ErrInvalidRateLimit, tc.s)
+			continue
+		}
+		require.NoError(t, err, tc.s)
+		assert.Equal(t, tc.limit, limit)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) TakeRateLimitToken(context.Context, string, time.Time, time.Duration, time.Duration) (time.Time, bool, error) {
+	return time.Time{}, false, errors.New("connection refused")
+}
+
+func (failingStore) DeleteExpiredRateLimits(context.Context, time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestRateLimiter(t *testing.T) {
+	type request struct {
+		method     string
+		path       string
+		remoteAddr string
+		principal  *Principal
+
+		code      int
+		remaining string
+	}
+	alice := &Principal{Name: "alice"}
+	bob := &Principal{Name: "bob"}
+
+	cases := []struct {
+		name     string
+		limit    string
+		store    RateLimitStore
+		requests []request
+	}{
+		{
+			name:  "by_ip",
+			limit: "POST /urls=2/1h",
+			requests: []request{
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusOK, remaining: "1"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:2000", code: http.StatusOK, remaining: "0"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusTooManyRequests, remaining: "0"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "2.2.2.2:1000", code: http.StatusOK, remaining: "1"},
+				// Other routes are not limited.
+				{method: http.MethodGet, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusOK},
+			},
+		},
+		{
+			name:  "by_key",
+			limit: "POST /urls=1/1h:key",
+			requests: []request{
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", principal: alice, code: http.StatusOK, remaining: "0"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", principal: bob, code: http.StatusOK, remaining: "0"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "2.2.2.2:1000", principal: alice, code: http.StatusTooManyRequests, remaining: "0"},
+				// Anonymous requests are limited by address.
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusOK, remaining: "0"},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusTooManyRequests, remaining: "0"},
+			},
+		},
+		{
+			name:  "by_route",
+			limit: "/urls/{alias}=2/1h:route",
+			requests: []request{
+				{method: http.MethodGet, path: "/urls/a", remoteAddr: "1.1.1.1:1000", code: http.StatusOK, remaining: "1"},
+				{method: http.MethodDelete, path: "/urls/b", remoteAddr: "2.2.2.2:1000", code: http.StatusOK, remaining: "0"},
+				{method: http.MethodGet, path: "/urls/c", remoteAddr: "3.3.3.3:1000", code: http.StatusTooManyRequests, remaining: "0"},
+			},
+		},
+		{
+			name:  "store_down",
+			limit: "POST /urls=1/1h",
+			store: failingStore{},
+			requests: []request{
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusOK},
+				{method: http.MethodPost, path: "/urls", remoteAddr: "1.1.1.1:1000", code: http.StatusOK},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, err := ParseRateLimit(tc.limit)
+			require.NoError(t, err)
+			store := tc.store
+			if store == nil {
+				store = NewMemoryRateLimitStore()
+			}
+			mw, err := RateLimiter(logger.NewMock(), store, []RateLimit{limit})
+			require.NoError(t, err)
+			h := mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			for i, req := range tc.requests {
+				r := httptest.NewRequest(req.method, req.path, nil)
+				r.RemoteAddr = req.remoteAddr
+				if req.principal != nil {
+					r = r.WithContext(WithPrincipal(r.Context(), *req.principal))
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				assert.Equal(t, req.code, w.Code, "request %d", i)
+				assert.Equal(t, req.remaining, w.Header().Get("RateLimit-Remaining"), "request %d", i)
+				if req.remaining != "" {
+					assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"), "request %d", i)
+				}
+				if req.code == http.StatusTooManyRequests {
+					assert.JSONEq(t, `{"status":"Error","error":"rate limit exceeded"}`, w.Body.String(), "request %d", i)
+					assert.NotEmpty(t, w.Header().Get("Retry-After"), "request %d", i)
+				} else {
+					assert.Empty(t, w.Header().Get("Retry-After"), "request %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	mw, err := RateLimiter(logger.NewMock(), store, []RateLimit{{"/", 2, 100 * time.Millisecond, RateLimitByIP}})
+	require.NoError(t, err)
+	h := mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+	serve()
+	serve()
+	w := serve()
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serve().Code)
+}
+
+func TestRateLimiterInvalidPattern(t *testing.T) {
+	_, err := RateLimiter(logger.NewMock(), NewMemoryRateLimitStore(), []RateLimit{
+		{"POST /urls", 1, time.Second, RateLimitByIP},
+		{"POST /urls", 2, time.Second, RateLimitByIP},
+	})
+	assert.ErrorIs(t, err, ErrInvalidRateLimit)
+}
+
+func TestRateLimiterAroundAuth(t *testing.T) {
+	limits := []RateLimit{
+		{"POST /urls", 3, time.Hour, RateLimitByIP},
+		{"POST /urls", 1, time.Hour, RateLimitByKey},
+	}
+	beforeAuth, afterAuth := SplitRateLimits(limits)
+	assert.Equal(t, limits[:1], beforeAuth)
+	assert.Equal(t, limits[1:], afterAuth)
+
+	// Both limiters share the store like they do in main.
+	store := NewMemoryRateLimitStore()
+	before, err := RateLimiter(logger.NewMock(), store, beforeAuth)
+	require.NoError(t, err)
+	after, err := RateLimiter(logger.NewMock(), store, afterAuth)
+	require.NoError(t, err)
+	lookup := func(_ context.Context, keyHash string) (Principal, error) {
+		if keyHash == HashKey("alice-key") {
+			return Principal{Name: "alice"}, nil
+		}
+		return Principal{}, ErrUnknownKey
+	}
+	h := Use(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), before, Auth(logger.NewMock(), lookup), after)
+
+	requests := []struct {
+		method     string
+		remoteAddr string
+		key        string
+		code       int
+	}{
+		// The limit by key applies to alice alone.
+		{method: http.MethodPost, remoteAddr: "1.1.1.1:1000", key: "alice-key", code: http.StatusOK},
+		{method: http.MethodPost, remoteAddr: "1.1.1.1:1000", key: "alice-key", code: http.StatusTooManyRequests},
+		// Anonymous requests are limited by address, apart from the
+		// limit by ip of the same route.
+		{method: http.MethodPost, remoteAddr: "1.1.1.1:1000", code: http.StatusOK},
+		// Guessing keys uses up the limit by ip before Auth.
+		{method: http.MethodPost, remoteAddr: "1.1.1.1:1000", key: "guess", code: http.StatusTooManyRequests},
+		{method: http.MethodPost, remoteAddr: "2.2.2.2:1000", key: "guess", code: http.StatusUnauthorized},
+		{method: http.MethodPost, remoteAddr: "2.2.2.2:1000", key: "guess", code: http.StatusUnauthorized},
+		{method: http.MethodPost, remoteAddr: "2.2.2.2:1000", key: "guess", code: http.StatusUnauthorized},
+		{method: http.MethodPost, remoteAddr: "2.2.2.2:1000", key: "guess", code: http.StatusTooManyRequests},
+	}
+	for i, req := range requests {
+		r := httptest.NewRequest(req.method, "/urls", nil)
+		r.RemoteAddr = req.remoteAddr
+		if req.key != "" {
+			r.Header.Set("Authorization", "Bearer "+req.key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, req.code, w.Code, "request %d", i)
+	}
+}
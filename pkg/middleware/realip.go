@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var ErrInvalidProxy = errors.New("trusted proxy must be an ip address or a cidr")
+
+// Client is who a request comes from once the proxies in front of the
+// service are accounted for.
+type Client struct {
+	IP     string
+	Scheme string
+	// Proxied is set when the request came through a trusted proxy, so
+	// the headers proxies set may be believed.
+	Proxied bool
+}
+
+type ctxKeyClient int
+
+const ClientKey ctxKeyClient = iota
+
+// ParseProxies parses the trusted proxies, ip addresses or cidrs such as
+// "10.0.0.0/8".
+func ParseProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// RealIP attaches the client of the request to its context. The
+// Forwarded, X-Forwarded-For and X-Real-IP headers, in that order, are
+// only believed when the request comes from one of the trusted proxies.
+// The client is the last address of the chain that is not a trusted proxy,
+// as every address before it could be forged by the client itself.
+func RealIP(l *slog.Logger, trusted []netip.Prefix) Middleware {
+	l.Info("real ip middleware enabled", slog.Int("trusted_proxies", len(trusted)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithClient(r.Context(), realClient(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithClient returns a copy of ctx carrying the client.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, ClientKey, c)
+}
+
+// GetClient returns the client of the request, the peer of the connection
+// when RealIP did not attach one.
+func GetClient(r *http.Request) Client {
+	if c, ok := r.Context().Value(ClientKey).(Client); ok {
+		return c
+	}
+	return peer(r)
+}
+
+// GetClientIP returns the ip address of the client of the request.
+func GetClientIP(r *http.Request) string {
+	return GetClient(r).IP
+}
+
+func peer(r *http.Request) Client {
+	c := Client{IP: r.RemoteAddr, Scheme: "http"}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		c.IP = host
+	}
+	if addr, err := netip.ParseAddr(c.IP); err == nil {
+		c.IP = addr.Unmap().String()
+	}
+	if r.TLS != nil {
+		c.Scheme = "https"
+	}
+	return c
+}
+
+func realClient(r *http.Request, trusted []netip.Prefix) Client {
+	c := peer(r)
+	if !isTrusted(c.IP, trusted) {
+		return c
+	}
+
+	var hops []hop
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = parseForwarded(values)
+	} else if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, addr := range strings.Split(value, ",") {
+				hops = append(hops, hop{addr: parseNode(addr)})
+			}
+		}
+		if proto := lastValue(r.Header.Values("X-Forwarded-Proto")); proto != "" {
+			hops[len(hops)-1].proto = proto
+		}
+	} else if addr := parseNode(r.Header.Get("X-Real-IP")); addr != "" {
+		hops = []hop{{addr: addr, proto: lastValue(r.Header.Values("X-Forwarded-Proto"))}}
+	}
+	if len(hops) == 0 {
+		return c
+	}
+
+	c.Proxied = true
+	// Walk back from the proxy closest to the service, an address that
+	// cannot be read stops the walk at the proxy that reported it.
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		if h.addr == "" {
+			break
+		}
+		c.IP = h.addr
+		if h.proto == "http" || h.proto == "https" {
+			c.Scheme = h.proto
+		}
+		if !isTrusted(h.addr, trusted) {
+			break
+		}
+	}
+	return c
+}
+
+// hop is an address of a forwarding chain and the scheme it was reached
+// by, empty when unknown.
+type hop struct {
+	addr  string
+	proto string
+}
+
+// parseForwarded reads the elements of RFC 7239 Forwarded headers, e.g.
+// `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"`.
+func parseForwarded(values []string) []hop {
+	var hops []hop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var h hop
+			for _, pair := range strings.Split(element, ";") {
+				name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = strings.Trim(val, `"`)
+				switch strings.ToLower(name) {
+				case "for":
+					h.addr = parseNode(val)
+				case "proto":
+					h.proto = strings.ToLower(val)
+				}
+			}
+			hops = append(hops, h)
+		}
+	}
+	return hops
+}
+
+// parseNode returns the ip address of a node, with or without port and
+// brackets, empty for "unknown", obfuscated identifiers and garbage.
+func parseNode(node string) string {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	addr, err := netip.ParseAddr(node)
+	if err != nil || addr.Zone() != "" {
+		return ""
+	}
+	return addr.Unmap().String()
+}
+
+func lastValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	list := strings.Split(values[len(values)-1], ",")
+	return strings.ToLower(strings.TrimSpace(list[len(list)-1]))
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
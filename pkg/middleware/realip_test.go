@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/5aradise/link-forge/pkg/logger"
+)
+
+func TestParseProxies(t *testing.T) {
+	prefixes, err := ParseProxies([]string{"10.0.0.0/8", " 192.0.2.7 ", "2001:db8::/32", "10.1.2.3/16", ""})
+	require.NoError(t, err)
+	var got []string
+	for _, prefix := range prefixes {
+		got = append(got, prefix.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32", "10.1.0.0/16"}, got)
+
+	_, err = ParseProxies([]string{"proxy.local"})
+	assert.ErrorIs(t, err, ErrInvalidProxy)
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseProxies([]string{"10.0.0.0/8", "2001:db8::/32"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		header     http.Header
+		want       Client
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "198.51.100.1:4321",
+			want:       Client{IP: "198.51.100.1", Scheme: "http"},
+		},
+		{
+			name:       "direct_tls",
+			remoteAddr: "198.51.100.1:4321",
+			tls:        true,
+			want:       Client{IP: "198.51.100.1", Scheme: "https"},
+		},
+		{
+			name:       "untrusted_headers_ignored",
+			remoteAddr: "198.51.100.1:4321",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9"}, "X-Forwarded-Proto": {"https"}},
+			want:       Client{IP: "198.51.100.1", Scheme: "http"},
+		},
+		{
+			name:       "trusted_without_headers",
+			remoteAddr: "10.0.0.1:4321",
+			want:       Client{IP: "10.0.0.1", Scheme: "http"},
+		},
+		{
+			name:       "x_forwarded_for",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9"}, "X-Forwarded-Proto": {"https"}},
+			want:       Client{IP: "203.0.113.9", Scheme: "https", Proxied: true},
+		},
+		{
+			name:       "x_forwarded_for_chain",
+			remoteAddr: "10.0.0.1:4321",
+			// The client forged the first address, the second one is
+			// what the trusted proxies saw.
+			header: http.Header{"X-Forwarded-For": {"1.2.3.4, 203.0.113.9", "10.0.0.2"}},
+			want:   Client{IP: "203.0.113.9", Scheme: "http", Proxied: true},
+		},
+		{
+			name:       "x_forwarded_for_all_trusted",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       Client{IP: "10.0.0.3", Scheme: "http", Proxied: true},
+		},
+		{
+			name:       "x_forwarded_for_garbage",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9, nonsense, 10.0.0.2"}},
+			want:       Client{IP: "10.0.0.2", Scheme: "http", Proxied: true},
+		},
+		{
+			name:       "x_real_ip",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"X-Real-Ip": {"203.0.113.9"}},
+			want:       Client{IP: "203.0.113.9", Scheme: "http", Proxied: true},
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "[2001:db8::1]:4321",
+			header: http.Header{
+				"Forwarded":       {`for=192.0.2.43, for="[2001:470::17]:4711";proto=https`, `for=10.0.0.2;proto=http`},
+				"X-Forwarded-For": {"1.2.3.4"},
+			},
+			want: Client{IP: "2001:470::17", Scheme: "https", Proxied: true},
+		},
+		{
+			name:       "forwarded_unknown",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"Forwarded": {"for=unknown;proto=https"}},
+			want:       Client{IP: "10.0.0.1", Scheme: "http", Proxied: true},
+		},
+		{
+			name:       "forwarded_untrusted_hop",
+			remoteAddr: "10.0.0.1:4321",
+			header:     http.Header{"Forwarded": {"for=203.0.113.9;proto=https, for=198.51.100.1"}},
+			want:       Client{IP: "198.51.100.1", Scheme: "http", Proxied: true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Client
+			h := RealIP(logger.NewMock(), trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetClient(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestGetClientWithoutRealIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[::ffff:192.0.2.1]:4321"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	assert.Equal(t, "192.0.2.1", GetClientIP(req))
+}
@@ -1,9 +1,7 @@
 #!/bin/bash
 
 if [ -f .env ]; then
-    source .env
+    export CONFIG_PATH=.env
 fi
 
-cd sql/schema
-goose turso $DATABASE_URL down
-# goose sqlite3 ./../../$DATABASE_URL down
+go run ./cmd/link-forge migrate down
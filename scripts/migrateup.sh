@@ -1,9 +1,7 @@
 #!/bin/bash
 
 if [ -f .env ]; then
-    source .env
+    export CONFIG_PATH=.env
 fi
 
-cd sql/schema
-goose turso $DATABASE_URL up
-# goose sqlite3 ./../../$DATABASE_URL up
+go run ./cmd/link-forge migrate up
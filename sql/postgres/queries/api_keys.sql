@@ -0,0 +1,8 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, key_hash, admin)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1;
@@ -0,0 +1,17 @@
+-- name: TakeRateLimitToken :one
+-- Takes a token from the bucket unless it is full more than burst from now,
+-- a bucket without a token left is not returned.
+INSERT INTO rate_limits (bucket, full_at)
+VALUES (@bucket, @now::timestamptz + @interval_ms::bigint * INTERVAL '1 millisecond')
+ON CONFLICT (bucket) DO UPDATE
+SET full_at = GREATEST(rate_limits.full_at, @now::timestamptz) + @interval_ms::bigint * INTERVAL '1 millisecond'
+WHERE GREATEST(rate_limits.full_at, @now::timestamptz) + @interval_ms::bigint * INTERVAL '1 millisecond' - @now::timestamptz <= @burst_ms::bigint * INTERVAL '1 millisecond'
+RETURNING full_at;
+
+-- name: GetRateLimit :one
+SELECT full_at FROM rate_limits
+WHERE bucket = $1;
+
+-- name: DeleteExpiredRateLimits :execrows
+DELETE FROM rate_limits
+WHERE full_at < $1;
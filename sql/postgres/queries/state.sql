@@ -0,0 +1,5 @@
+-- name: LeaseAliases :one
+UPDATE state
+SET alias_count = alias_count + sqlc.arg(n)
+WHERE id = 1
+RETURNING alias_count;
\ No newline at end of file
@@ -0,0 +1,79 @@
+-- name: CreateURL :one
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: CreateURLIfAbsent :one
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (alias) DO NOTHING
+RETURNING *;
+
+-- name: ListURLsAsc :many
+SELECT * FROM urls
+WHERE id > @after
+  AND starts_with(alias, @alias_prefix)
+  AND (@host::text = '' OR lower(substring(url from '://([^/:?#]*)')) = @host)
+  AND (@owner::text = '' OR owner = @owner)
+ORDER BY id
+LIMIT @page_size;
+
+-- name: ListURLsDesc :many
+SELECT * FROM urls
+WHERE id < @before
+  AND starts_with(alias, @alias_prefix)
+  AND (@host::text = '' OR lower(substring(url from '://([^/:?#]*)')) = @host)
+  AND (@owner::text = '' OR owner = @owner)
+ORDER BY id DESC
+LIMIT @page_size;
+
+-- name: CountURLs :one
+SELECT COUNT(*) FROM urls
+WHERE starts_with(alias, @alias_prefix)
+  AND (@host::text = '' OR lower(substring(url from '://([^/:?#]*)')) = @host)
+  AND (@owner::text = '' OR owner = @owner);
+
+-- name: GetURLByAlias :one
+SELECT * FROM urls
+WHERE alias = $1;
+
+-- name: DeleteURLByAlias :one
+DELETE FROM urls
+WHERE alias = @alias
+  AND (@owner::text = '' OR owner = @owner)
+RETURNING *;
+-- name: UpdateURL :one
+UPDATE urls
+SET url = @url, version = version + 1, updated_at = @updated_at
+WHERE alias = @alias
+  AND (@version::bigint = 0 OR version = @version)
+  AND (@owner::text = '' OR owner = @owner)
+RETURNING *;
+
+-- name: ConsumeClick :one
+UPDATE urls
+SET used_clicks = used_clicks + 1,
+    expires_at = CASE WHEN used_clicks + 1 >= max_clicks THEN @now::timestamptz ELSE expires_at END
+WHERE alias = @alias
+  AND max_clicks IS NOT NULL AND used_clicks < max_clicks
+  AND (expires_at IS NULL OR expires_at > @now)
+RETURNING *;
+
+-- name: ArchiveExpiredURLs :execrows
+WITH expired AS (
+    DELETE FROM urls
+    WHERE expires_at <= @before
+    RETURNING *
+)
+INSERT INTO archived_urls (
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, archived_at
+)
+SELECT
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, @archived_at
+FROM expired;
+
+-- name: DeleteExpiredURLs :execrows
+DELETE FROM urls
+WHERE expires_at <= @before;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE urls (
+    id BIGSERIAL PRIMARY KEY,
+    alias TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE urls;
\ No newline at end of file
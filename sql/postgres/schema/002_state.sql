@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE state (
+    id INTEGER PRIMARY KEY,
+    alias_count BIGINT NOT NULL
+);
+INSERT INTO state (id, alias_count) VALUES (1, 0);
+
+-- +goose Down
+DROP TABLE state;
\ No newline at end of file
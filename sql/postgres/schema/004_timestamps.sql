@@ -0,0 +1,8 @@
+-- +goose Up
+-- Urls created before the migration get its time.
+ALTER TABLE urls ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE urls ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN updated_at;
+ALTER TABLE urls DROP COLUMN created_at;
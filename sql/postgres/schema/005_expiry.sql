@@ -0,0 +1,26 @@
+-- +goose Up
+-- expires_at is set to the time of the last click when max_clicks is used up.
+ALTER TABLE urls ADD COLUMN expires_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN max_clicks BIGINT;
+ALTER TABLE urls ADD COLUMN used_clicks BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX urls_expires_at_idx ON urls (expires_at);
+
+CREATE TABLE archived_urls (
+    id BIGINT NOT NULL,
+    alias TEXT NOT NULL,
+    url TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    max_clicks BIGINT,
+    used_clicks BIGINT NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE archived_urls;
+DROP INDEX urls_expires_at_idx;
+ALTER TABLE urls DROP COLUMN used_clicks;
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
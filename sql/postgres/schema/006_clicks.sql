@@ -0,0 +1,16 @@
+-- +goose Up
+-- url_id tells apart the urls an alias had over time.
+CREATE TABLE clicks (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL,
+    alias TEXT NOT NULL,
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    request_id TEXT NOT NULL
+);
+CREATE INDEX clicks_url_id_clicked_at_idx ON clicks (url_id, clicked_at);
+
+-- +goose Down
+DROP TABLE clicks;
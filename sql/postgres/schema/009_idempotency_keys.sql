@@ -0,0 +1,18 @@
+-- +goose Up
+-- Requests made with an Idempotency-Key header, per principal. status_code
+-- is 0 while the first request is in progress, then the response is kept
+-- for replays until the key expires.
+CREATE TABLE idempotency_keys (
+    owner TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    response BYTEA,
+    PRIMARY KEY (owner, idempotency_key)
+);
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +goose Down
+DROP INDEX idempotency_keys_created_at_idx;
+DROP TABLE idempotency_keys;
@@ -0,0 +1,8 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, key_hash, admin, created_at)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = ?;
@@ -0,0 +1,46 @@
+-- name: InsertClick :exec
+INSERT INTO clicks (
+    url_id, alias, clicked_at, referrer, user_agent, remote_addr, request_id,
+    visitor, referrer_host, country, device
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: CountClicks :one
+SELECT COUNT(*) FROM clicks
+WHERE url_id = ?;
+
+-- name: ClickTotals :one
+SELECT COUNT(*) AS clicks, COUNT(DISTINCT NULLIF(visitor, '')) AS visitors
+FROM clicks
+WHERE url_id = @url_id AND clicked_at >= @from_time AND clicked_at < @to_time;
+
+-- name: ClickSeries :many
+SELECT CAST((clicked_at - @origin) / @width * @width + @origin AS INTEGER) AS bucket, COUNT(*) AS clicks
+FROM clicks
+WHERE url_id = @url_id AND clicked_at >= @from_time AND clicked_at < @to_time
+GROUP BY bucket
+ORDER BY bucket;
+
+-- name: TopReferrers :many
+SELECT referrer_host AS value, COUNT(*) AS clicks
+FROM clicks
+WHERE url_id = @url_id AND clicked_at >= @from_time AND clicked_at < @to_time
+GROUP BY referrer_host
+ORDER BY clicks DESC, value
+LIMIT @top;
+
+-- name: TopCountries :many
+SELECT country AS value, COUNT(*) AS clicks
+FROM clicks
+WHERE url_id = @url_id AND clicked_at >= @from_time AND clicked_at < @to_time
+GROUP BY country
+ORDER BY clicks DESC, value
+LIMIT @top;
+
+-- name: TopDevices :many
+SELECT device AS value, COUNT(*) AS clicks
+FROM clicks
+WHERE url_id = @url_id AND clicked_at >= @from_time AND clicked_at < @to_time
+GROUP BY device
+ORDER BY clicks DESC, value
+LIMIT @top;
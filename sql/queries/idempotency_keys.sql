@@ -0,0 +1,32 @@
+-- name: ClaimIdempotencyKey :one
+-- Stores the request unless a fresh one with the same key is stored,
+-- expired ones and abandoned ones still in progress are replaced.
+INSERT INTO idempotency_keys (owner, idempotency_key, request_hash, created_at)
+VALUES (@owner, @idempotency_key, @request_hash, @created_at)
+ON CONFLICT (owner, idempotency_key) DO UPDATE
+SET request_hash = excluded.request_hash,
+    created_at = excluded.created_at,
+    status_code = 0,
+    response = NULL
+WHERE idempotency_keys.created_at < @expired_before
+   OR idempotency_keys.status_code = 0 AND idempotency_keys.created_at < @abandoned_before
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE owner = ? AND idempotency_key = ?;
+
+-- name: CompleteIdempotencyKey :exec
+-- Leaves a key claimed again by another request alone.
+UPDATE idempotency_keys
+SET status_code = ?, response = ?
+WHERE owner = ? AND idempotency_key = ? AND request_hash = ? AND created_at = ?;
+
+-- name: DeleteIdempotencyKey :exec
+-- Leaves a key claimed again by another request alone.
+DELETE FROM idempotency_keys
+WHERE owner = ? AND idempotency_key = ? AND request_hash = ? AND created_at = ?;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE created_at < ?;
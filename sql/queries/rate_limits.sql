@@ -0,0 +1,17 @@
+-- name: TakeRateLimitToken :one
+-- Takes a token from the bucket unless it is full more than burst from now,
+-- a bucket without a token left is not returned.
+INSERT INTO rate_limits (bucket, full_at)
+VALUES (@bucket, @now + @interval)
+ON CONFLICT (bucket) DO UPDATE
+SET full_at = MAX(rate_limits.full_at, @now) + @interval
+WHERE MAX(rate_limits.full_at, @now) + @interval - @now <= @burst
+RETURNING full_at;
+
+-- name: GetRateLimit :one
+SELECT full_at FROM rate_limits
+WHERE bucket = ?;
+
+-- name: DeleteExpiredRateLimits :execrows
+DELETE FROM rate_limits
+WHERE full_at < ?;
@@ -1,8 +1,5 @@
--- name: LoadState :one
-SELECT alias_count FROM state
-WHERE id = 1;
-
--- name: StoreState :exec
+-- name: LeaseAliases :one
 UPDATE state
-SET alias_count = ?
-WHERE id = 1;
\ No newline at end of file
+SET alias_count = alias_count + sqlc.arg(n)
+WHERE id = 1
+RETURNING alias_count;
\ No newline at end of file
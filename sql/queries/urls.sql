@@ -1,11 +1,40 @@
 -- name: CreateURL :one
-INSERT INTO urls (alias, url)
-VALUES (?, ?)
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES (?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
--- name: ListURLs :many
+-- name: CreateURLIfAbsent :one
+INSERT INTO urls (alias, url, created_at, updated_at, expires_at, max_clicks, owner)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (alias) DO NOTHING
+RETURNING *;
+
+-- name: ListURLsAsc :many
+SELECT * FROM urls
+WHERE id > @after
+  AND substr(alias, 1, length(@alias_prefix)) = @alias_prefix
+  AND (CAST(@host AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE @host || '/%')
+  AND (CAST(@owner AS TEXT) = '' OR owner = @owner)
+ORDER BY id
+LIMIT @page_size;
+
+-- name: ListURLsDesc :many
 SELECT * FROM urls
-ORDER BY id;
+WHERE id < @before
+  AND substr(alias, 1, length(@alias_prefix)) = @alias_prefix
+  AND (CAST(@host AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE @host || '/%')
+  AND (CAST(@owner AS TEXT) = '' OR owner = @owner)
+ORDER BY id DESC
+LIMIT @page_size;
+
+-- name: CountURLs :one
+SELECT COUNT(*) FROM urls
+WHERE substr(alias, 1, length(@alias_prefix)) = @alias_prefix
+  AND (CAST(@host AS TEXT) = ''
+    OR replace(replace(replace(substr(url, instr(url, '://') + 3), ':', '/'), '?', '/'), '#', '/') || '/' LIKE @host || '/%')
+  AND (CAST(@owner AS TEXT) = '' OR owner = @owner);
 
 -- name: GetURLByAlias :one
 SELECT * FROM urls
@@ -13,5 +42,38 @@ WHERE alias = ?;
 
 -- name: DeleteURLByAlias :one
 DELETE FROM urls
-WHERE alias = ?
+WHERE alias = @alias
+  AND (CAST(@owner AS TEXT) = '' OR owner = @owner)
+RETURNING *;
+
+-- name: UpdateURL :one
+UPDATE urls
+SET url = @url, version = version + 1, updated_at = @updated_at
+WHERE alias = @alias
+  AND (CAST(@version AS INTEGER) = 0 OR version = @version)
+  AND (CAST(@owner AS TEXT) = '' OR owner = @owner)
+RETURNING *;
+
+-- name: ConsumeClick :one
+UPDATE urls
+SET used_clicks = used_clicks + 1,
+    expires_at = CASE WHEN used_clicks + 1 >= max_clicks THEN @now ELSE expires_at END
+WHERE alias = @alias
+  AND max_clicks IS NOT NULL AND used_clicks < max_clicks
+  AND (expires_at IS NULL OR expires_at > @now)
 RETURNING *;
+
+-- name: ArchiveExpiredURLs :exec
+INSERT INTO archived_urls (
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, archived_at
+)
+SELECT
+    id, alias, url, version, created_at, updated_at,
+    expires_at, max_clicks, used_clicks, owner, @archived_at
+FROM urls
+WHERE expires_at <= @before;
+
+-- name: DeleteExpiredURLs :execrows
+DELETE FROM urls
+WHERE expires_at <= @before;
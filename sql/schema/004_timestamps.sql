@@ -0,0 +1,11 @@
+-- +goose Up
+-- Unix milliseconds, urls created before the migration get its time.
+ALTER TABLE urls ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+UPDATE urls SET
+    created_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000,
+    updated_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN updated_at;
+ALTER TABLE urls DROP COLUMN created_at;
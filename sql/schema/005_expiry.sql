@@ -0,0 +1,27 @@
+-- +goose Up
+-- expires_at is unix milliseconds, it is set to the time of the last click
+-- when max_clicks is used up.
+ALTER TABLE urls ADD COLUMN expires_at INTEGER;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+ALTER TABLE urls ADD COLUMN used_clicks INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX urls_expires_at_idx ON urls (expires_at);
+
+CREATE TABLE archived_urls (
+    id INTEGER NOT NULL,
+    alias TEXT NOT NULL,
+    url TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    max_clicks INTEGER,
+    used_clicks INTEGER NOT NULL,
+    archived_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE archived_urls;
+DROP INDEX urls_expires_at_idx;
+ALTER TABLE urls DROP COLUMN used_clicks;
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- url_id tells apart the urls an alias had over time, clicked_at is unix
+-- milliseconds.
+CREATE TABLE clicks (
+    id INTEGER PRIMARY KEY,
+    url_id INTEGER NOT NULL,
+    alias TEXT NOT NULL,
+    clicked_at INTEGER NOT NULL,
+    referrer TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    request_id TEXT NOT NULL
+);
+CREATE INDEX clicks_url_id_clicked_at_idx ON clicks (url_id, clicked_at);
+
+-- +goose Down
+DROP TABLE clicks;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- visitor is a hash of the client address and user agent, unique per day.
+ALTER TABLE clicks ADD COLUMN visitor TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN referrer_host TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN device TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE clicks DROP COLUMN device;
+ALTER TABLE clicks DROP COLUMN country;
+ALTER TABLE clicks DROP COLUMN referrer_host;
+ALTER TABLE clicks DROP COLUMN visitor;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- key_hash is the hex SHA-256 of the key, the key itself is never stored.
+-- Keys with the same name belong to the same principal.
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    admin INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL
+);
+
+-- owner is the name of the principal that created the url, urls created
+-- before keys have no owner and are managed by admins only.
+ALTER TABLE urls ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+CREATE INDEX urls_owner_id_idx ON urls (owner, id);
+ALTER TABLE archived_urls ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE archived_urls DROP COLUMN owner;
+DROP INDEX urls_owner_id_idx;
+ALTER TABLE urls DROP COLUMN owner;
+DROP TABLE api_keys;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Token buckets of the rate limiter shared by the replicas, kept as the
+-- time the bucket is full again in unix milliseconds.
+CREATE TABLE rate_limits (
+    bucket TEXT PRIMARY KEY,
+    full_at INTEGER NOT NULL
+);
+CREATE INDEX rate_limits_full_at_idx ON rate_limits (full_at);
+
+-- +goose Down
+DROP INDEX rate_limits_full_at_idx;
+DROP TABLE rate_limits;
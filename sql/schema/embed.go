@@ -0,0 +1,8 @@
+// Package schema embeds the SQLite migrations, so the binary can apply them
+// without goose installed.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS